@@ -0,0 +1,124 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServerRoute matches the calls received by an xDS enabled gRPC server.
+type ServerRoute struct {
+	// Path allows to specfies path matcher for a specific route.
+	Path PathMatcher `json:"path,omitempty"`
+	// Headers allows to match on a specific set of headers.
+	Headers []HeaderMatcher `json:"headers,omitempty"`
+	// Indicates if the matching should be case sensitive.
+	// +kubebuilder:default:=true
+	CaseSensitive bool `json:"caseSensitive,omitempty"`
+	// RBAC overrides the configuration of the server RBAC filter for this route.
+	// +optional
+	RBAC *RBACFilter `json:"rbac,omitempty"`
+}
+
+// ServerTLS configures TLS for the connections accepted by an xDS enabled gRPC server.
+type ServerTLS struct {
+	// Certificate provides the server certificate.
+	// +kubebuilder:validation:Required
+	Certificate CertificateProviderInstance `json:"certificate,omitempty"`
+	// CACertificate provides the CA certificates used to validate the client certificates.
+	// +optional
+	CACertificate *CertificateProviderInstance `json:"caCertificate,omitempty"`
+	// RequireClientCertificate rejects clients not presenting a valid certificate, requires CACertificate to be set.
+	// +optional
+	RequireClientCertificate bool `json:"requireClientCertificate,omitempty"`
+}
+
+// XDSServerSpec defines the desired state of Server
+type XDSServerSpec struct {
+	// PodSelector selects the pods running the xDS enabled gRPC server in the namespace of the XDSServer.
+	// +kubebuilder:validation:Required
+	PodSelector metav1.LabelSelector `json:"podSelector,omitempty"`
+	// Port is the port the gRPC server listens on, by container port name or number.
+	// Listeners are published for each pod IP: servers must bind their pod IP, servers binding 0.0.0.0 or [::] get no listener.
+	// +kubebuilder:validation:Required
+	Port K8sPort `json:"port,omitempty"`
+	// MaxStreamDuration is the total duration to keep alive an HTTP request/response stream.
+	// If the time limit is reached the stream will be reset independent of any other timeouts.
+	// If not specified, this value is not set.
+	MaxStreamDuration *metav1.Duration `json:"maxStreamDuration,omitempty"`
+	// Filters represent the list of filters applied to the calls received by the server.
+	// +optional
+	Filters []Filter `json:"filters,omitempty"`
+	// Routes lists the calls accepted by the server, if empty all calls are accepted.
+	// +optional
+	Routes []ServerRoute `json:"routes,omitempty"`
+	// TLS configures TLS for the connections accepted by the server, plaintext is used if not set.
+	// +optional
+	TLS *ServerTLS `json:"tls,omitempty"`
+}
+
+// XDSServerStatus defines the observed state of Server
+type XDSServerStatus struct {
+	// ObservedGeneration is the generation of the spec the status has been computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// SnapshotVersion is the version the listeners of the server are served with, only set if all the client scopes share the same version.
+	// +optional
+	SnapshotVersion string `json:"snapshotVersion,omitempty"`
+	// ServedVersions lists the version of the listeners served to each client scope.
+	// +optional
+	ServedVersions []ServedVersion `json:"servedVersions,omitempty"`
+	// Listeners is the number of listeners generated for the selected pods.
+	// +optional
+	Listeners int `json:"listeners,omitempty"`
+	// Conditions represent the latest available observations of the server state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Listeners",type=integer,JSONPath=`.status.listeners`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.snapshotVersion`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="Ready")].message`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// XDSServer is the Schema for the servers API
+type XDSServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   XDSServerSpec   `json:"spec,omitempty"`
+	Status XDSServerStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// XDSServerList contains a list of Server
+type XDSServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []XDSServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&XDSServer{}, &XDSServerList{})
+}
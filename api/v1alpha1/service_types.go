@@ -37,6 +37,31 @@ type K8sService struct {
 	Namespace string `json:"namespace,omitempty"`
 	// +kubebuilder:validation:Required
 	Port K8sPort `json:"port,omitempty"`
+	// Cluster is the name of the remote cluster running the service, registered by a kubeconfig Secret.
+	// The service runs in the cluster of kxds if not set.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// StaticEndpoint is an endpoint outside of the cluster.
+type StaticEndpoint struct {
+	// Address of the endpoint, as ip:port.
+	// +kubebuilder:validation:Required
+	Address string `json:"address,omitempty"`
+	// Weight of the endpoint in its locality, defaults to one.
+	// +optional
+	// +kubebuilder:default:=1
+	Weight uint32 `json:"weight,omitempty"`
+}
+
+// DNSEndpoints are the addresses a hostname resolves to.
+type DNSEndpoints struct {
+	// +kubebuilder:validation:Required
+	Hostname string `json:"hostname,omitempty"`
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	Port uint32 `json:"port,omitempty"`
 }
 
 // Locality is a logical group of endpoints for a given cluster.
@@ -50,8 +75,127 @@ type Locality struct {
 	// +optional
 	Priority uint32 `json:"priority,omitempty"`
 	// Services is a reference to a kubernetes service.
+	// Only one of service, static and dns can be set.
 	// +optional
 	Service *K8sService `json:"service,omitempty"`
+	// Static lists endpoints outside of the cluster, like virtual machines.
+	// +optional
+	Static []StaticEndpoint `json:"static,omitempty"`
+	// DNS is a hostname periodically resolved by kxds, each of its addresses is an endpoint.
+	// +optional
+	DNS *DNSEndpoints `json:"dns,omitempty"`
+	// SplitByZone splits the endpoints of the service into one locality per zone and region.
+	// The topology of an endpoint is read from its EndpointSlice zone, or from the labels of the node it runs on.
+	// The generated localities share the priority of this locality, and split its weight in proportion to their endpoints.
+	// +optional
+	SplitByZone bool `json:"splitByZone,omitempty"`
+}
+
+// CertificateProviderInstance references a certificate provider instance defined in the client bootstrap.
+type CertificateProviderInstance struct {
+	// InstanceName is the name of the certificate provider instance, it must be defined in the bootstrap.
+	// +kubebuilder:validation:Required
+	InstanceName string `json:"instanceName,omitempty"`
+	// CertificateName is an opaque name passed to the certificate provider.
+	// +optional
+	CertificateName string `json:"certificateName,omitempty"`
+}
+
+// StringMatcher indicates a match based on a string value.
+type StringMatcher struct {
+	// Value must match exactly.
+	// +optional
+	Exact *string `json:"exact,omitempty"`
+	// Value must have a prefix.
+	// +optional
+	Prefix *string `json:"prefix,omitempty"`
+	// Value must have a suffix.
+	// +optional
+	Suffix *string `json:"suffix,omitempty"`
+	// Value must contain a substring.
+	// +optional
+	Contains *string `json:"contains,omitempty"`
+	// Value must match a regex.
+	// +optional
+	Regex *RegexMatcher `json:"regex,omitempty"`
+	// Indicates if the matching should ignore case, has no effect on regex matching.
+	// +optional
+	IgnoreCase bool `json:"ignoreCase,omitempty"`
+}
+
+// ClusterTLS configures TLS for the connections to the upstream cluster.
+type ClusterTLS struct {
+	// Certificate provides the client certificate used for mTLS, if not set the client does not authenticate.
+	// +optional
+	Certificate *CertificateProviderInstance `json:"certificate,omitempty"`
+	// CACertificate provides the CA certificates used to validate the server certificate.
+	// +kubebuilder:validation:Required
+	CACertificate CertificateProviderInstance `json:"caCertificate,omitempty"`
+	// SubjectAltNames lists the matchers used to validate the server identity, if empty any SAN is accepted.
+	// +optional
+	SubjectAltNames []StringMatcher `json:"subjectAltNames,omitempty"`
+}
+
+type RoundRobinLBPolicy struct{}
+
+// RingHashLBPolicy configures the ring hash load balancer, requests are routed using the hash computed by the route hash policies.
+type RingHashLBPolicy struct {
+	// Minimum hash ring size, defaults to 1024.
+	// +optional
+	MinRingSize *uint64 `json:"minRingSize,omitempty"`
+	// Maximum hash ring size, defaults to 8M.
+	// +optional
+	MaxRingSize *uint64 `json:"maxRingSize,omitempty"`
+}
+
+// WeightedRoundRobinLBPolicy configures the weighted round robin load balancer, endpoints are weighted by the utilization they report through ORCA.
+type WeightedRoundRobinLBPolicy struct {
+	// BlackoutPeriod is how long an endpoint must report its load before its weight is used, defaults to 10s.
+	// +optional
+	BlackoutPeriod *metav1.Duration `json:"blackoutPeriod,omitempty"`
+	// WeightExpirationPeriod is how long the weight of an endpoint which stopped reporting its load is kept, defaults to 3m.
+	// gRPC Go clients currently read it from the blackout period instead.
+	// +optional
+	WeightExpirationPeriod *metav1.Duration `json:"weightExpirationPeriod,omitempty"`
+	// WeightUpdatePeriod is how often the weights are computed again, defaults to 1s, clients raise lower values to 100ms.
+	// +optional
+	WeightUpdatePeriod *metav1.Duration `json:"weightUpdatePeriod,omitempty"`
+}
+
+// LeastRequestLBPolicy configures the least request load balancer, requests go to the endpoint with the fewest outstanding requests among randomly chosen ones.
+// gRPC clients only support it if the GRPC_EXPERIMENTAL_ENABLE_LEAST_REQUEST environment variable is true, others use round robin.
+type LeastRequestLBPolicy struct {
+	// ChoiceCount is the number of endpoints randomly chosen for each request, defaults to 2.
+	// +optional
+	// +kubebuilder:validation:Minimum:=2
+	ChoiceCount *uint32 `json:"choiceCount,omitempty"`
+}
+
+// PickFirstLBPolicy configures the pick first load balancer, all the requests go to the first reachable endpoint of the cluster.
+type PickFirstLBPolicy struct {
+	// ShuffleAddressList makes each client shuffle the endpoints before picking one, spreading the clients over the endpoints.
+	// +optional
+	ShuffleAddressList bool `json:"shuffleAddressList,omitempty"`
+}
+
+// LBPolicy selects the load balancing policy used in a cluster.
+// +kubebuilder:validation:MaxProperties:=1
+type LBPolicy struct {
+	// RoundRobin load balancing, this is the default.
+	// +optional
+	RoundRobin *RoundRobinLBPolicy `json:"roundRobin,omitempty"`
+	// RingHash load balancing, for consistent hashing.
+	// +optional
+	RingHash *RingHashLBPolicy `json:"ringHash,omitempty"`
+	// WeightedRoundRobin load balancing, for backends reporting their utilization.
+	// +optional
+	WeightedRoundRobin *WeightedRoundRobinLBPolicy `json:"weightedRoundRobin,omitempty"`
+	// LeastRequest load balancing, for requests of uneven cost.
+	// +optional
+	LeastRequest *LeastRequestLBPolicy `json:"leastRequest,omitempty"`
+	// PickFirst load balancing, each client sends all its requests to a single endpoint.
+	// +optional
+	PickFirst *PickFirstLBPolicy `json:"pickFirst,omitempty"`
 }
 
 // Cluster is a group of backend servers serving the same services.
@@ -61,6 +205,15 @@ type Cluster struct {
 	Name string `json:"name,omitempty"`
 	// MaxRequests qualifies the maximum number of parallel requests allowd to the upstream cluster.
 	MaxRequests *uint32 `json:"maxRequests,omitempty"`
+	// LBPolicy is the load balancing policy used in this cluster, defaults to round robin.
+	// +optional
+	LBPolicy *LBPolicy `json:"lbPolicy,omitempty"`
+	// TLS configures TLS for the connections to the cluster, plaintext is used if not set.
+	// +optional
+	TLS *ClusterTLS `json:"tls,omitempty"`
+	// LoadReporting makes the clients report their load on this cluster to the kxds load reporting service.
+	// +optional
+	LoadReporting bool `json:"loadReporting,omitempty"`
 	// +kubebuilder:validation:MinItems:=1
 	Localities []Locality `json:"localities,omitempty"`
 }
@@ -168,10 +321,123 @@ type FaultFilter struct {
 	Headers []HeaderMatcher `json:"headers,omitempty"`
 }
 
+// RBACPermission matches the action of a call.
+// +kubebuilder:validation:MaxProperties:=1
+type RBACPermission struct {
+	// Any matches any call.
+	// +optional
+	Any bool `json:"any,omitempty"`
+	// Path matches the path of the call, the gRPC method.
+	// +optional
+	Path *PathMatcher `json:"path,omitempty"`
+	// Header matches a header of the call.
+	// +optional
+	Header *HeaderMatcher `json:"header,omitempty"`
+}
+
+// RBACPrincipal matches the identity of the caller.
+// +kubebuilder:validation:MaxProperties:=1
+type RBACPrincipal struct {
+	// Any matches any caller.
+	// +optional
+	Any bool `json:"any,omitempty"`
+	// Authenticated matches the SAN of the certificate presented by the caller, requires mTLS.
+	// +optional
+	Authenticated *StringMatcher `json:"authenticated,omitempty"`
+	// Header matches a header of the call.
+	// +optional
+	Header *HeaderMatcher `json:"header,omitempty"`
+}
+
+// RBACPolicy matches a call if any of its permissions and any of its principals match.
+type RBACPolicy struct {
+	// Name of the policy.
+	// +kubebuilder:validation:Required
+	Name string `json:"name,omitempty"`
+	// Permissions lists the actions matched by the policy.
+	// +kubebuilder:validation:MinItems:=1
+	Permissions []RBACPermission `json:"permissions,omitempty"`
+	// Principals lists the callers matched by the policy.
+	// +kubebuilder:validation:MinItems:=1
+	Principals []RBACPrincipal `json:"principals,omitempty"`
+}
+
+// RBACFilter allows or denies calls based on their permissions and principals.
+// Only xDS enabled gRPC servers support this filter.
+type RBACFilter struct {
+	// Action applied to the calls matching any policy, the opposite action is applied to the others.
+	// +kubebuilder:validation:Enum:=allow;deny
+	// +kubebuilder:default:=allow
+	Action string `json:"action,omitempty"`
+	// Policies lists the policies of the filter. If empty, allow denies all calls and deny allows all calls.
+	// +optional
+	Policies []RBACPolicy `json:"policies,omitempty"`
+}
+
 type Filter struct {
 	// Fault Filter configuration.
 	// +optional
 	Fault *FaultFilter `json:"fault,omitempty"`
+	// RBAC Filter configuration.
+	// +optional
+	RBAC *RBACFilter `json:"rbac,omitempty"`
+}
+
+// HeaderHashPolicy computes the request hash from the value of a header.
+type HeaderHashPolicy struct {
+	// Name of the header to hash.
+	// +kubebuilder:validation:Required
+	Name string `json:"name,omitempty"`
+}
+
+// FilterStateHashPolicy computes the request hash from a filter state key.
+type FilterStateHashPolicy struct {
+	// Key of the filter state to hash, gRPC only supports the channel id.
+	// +kubebuilder:validation:Enum:=io.grpc.channel_id
+	// +kubebuilder:default:=io.grpc.channel_id
+	Key string `json:"key,omitempty"`
+}
+
+// HashPolicy specifies how to compute the hash of a request for the ring hash load balancer.
+type HashPolicy struct {
+	// Hash on a header value.
+	// +optional
+	Header *HeaderHashPolicy `json:"header,omitempty"`
+	// Hash on a filter state key.
+	// +optional
+	FilterState *FilterStateHashPolicy `json:"filterState,omitempty"`
+	// If set and the policy produced a hash, the following policies are skipped.
+	// +optional
+	Terminal bool `json:"terminal,omitempty"`
+}
+
+// RetryOn is a gRPC status code that triggers a retry.
+// +kubebuilder:validation:Enum:=cancelled;deadline-exceeded;internal;resource-exhausted;unavailable
+type RetryOn string
+
+// RetryBackOff configures the exponential backoff between retries.
+type RetryBackOff struct {
+	// BaseInterval is the base interval between retries, defaults to 25ms.
+	// +optional
+	// +kubebuilder:default:="25ms"
+	BaseInterval *metav1.Duration `json:"baseInterval,omitempty"`
+	// MaxInterval is the maximum interval between retries, defaults to 10 times the BaseInterval.
+	// +optional
+	MaxInterval *metav1.Duration `json:"maxInterval,omitempty"`
+}
+
+// RetryPolicy indicates how to retry a failed call.
+type RetryPolicy struct {
+	// RetryOn lists the gRPC status codes that trigger a retry.
+	// +kubebuilder:validation:MinItems:=1
+	RetryOn []RetryOn `json:"retryOn,omitempty"`
+	// NumRetries is the maximum number of retries, defaults to one.
+	// +optional
+	// +kubebuilder:default:=1
+	NumRetries *uint32 `json:"numRetries,omitempty"`
+	// BackOff configures the interval between retries.
+	// +optional
+	BackOff *RetryBackOff `json:"backOff,omitempty"`
 }
 
 // Route allows to match an outoing request to a specific cluster, it allows to do HTTP level manipulation on the outgoing requests as well as matching.
@@ -193,6 +459,12 @@ type Route struct {
 	// *max_stream_duration*, but limit the applied timeout to the maximum value specified here.
 	// If set to 0, the `grpc-timeout` header is used without modification.
 	GrpcTimeoutHeaderMax *metav1.Duration `json:"grpcTimeoutHeaderMax,omitempty"`
+	// HashPolicy lists the policies used to compute the hash of a request, when using ring hash load balancing.
+	// +optional
+	HashPolicy []HashPolicy `json:"hashPolicy,omitempty"`
+	// RetryPolicy indicates how to retry failed calls on that route, overrides the service retry policy.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 	// Cluster carries the reference to a cluster name.
 	Clusters []ClusterRef `json:"clusters,omitempty"`
 }
@@ -203,6 +475,9 @@ type XDSServiceSpec struct {
 	// If the time limit is reached the stream will be reset independent of any other timeouts.
 	// If not specified, this value is not set.
 	MaxStreamDuration *metav1.Duration `json:"maxStreamDuration,omitempty"`
+	// RetryPolicy is the default retry policy applied to all routes of the service.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 	// Filters represent the list of filters applied in that service.
 	// +optional
 	Filters []Filter `json:"filters,omitempty"`
@@ -212,17 +487,97 @@ type XDSServiceSpec struct {
 	// Routes lists all the  clusters defined for an XDSService.
 	// +kubebuilder:validation:MinItems:=1
 	Clusters []Cluster `json:"clusters,omitempty"`
+	// Scopes lists the namespaces of the clients allowed to see this service, the scope of a client is the namespace of the ServiceAccount it authenticated as.
+	// The service is visible to all clients if empty.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+const (
+	// ConditionReady indicates that the XDSService has been translated and published in the latest snapshot.
+	ConditionReady = "Ready"
+	// ConditionDegraded indicates that the XDSService could not be translated and is missing from the latest snapshot,
+	// or that it has been published without some of its endpoints.
+	ConditionDegraded = "Degraded"
+	// ConditionRejected indicates that an xDS client rejected the resources of the XDSService.
+	ConditionRejected = "Rejected"
+
+	// ReasonPublished is set when the XDSService has been published in a snapshot.
+	ReasonPublished = "Published"
+	// ReasonTranslationFailed is set when the XDSService spec could not be translated to xDS resources.
+	ReasonTranslationFailed = "TranslationFailed"
+	// ReasonEndpointsUnavailable is set when the XDSService has been published without the endpoints of some localities.
+	ReasonEndpointsUnavailable = "EndpointsUnavailable"
+	// ReasonRejectedByClient is set when an xDS client NACKed a resource of the XDSService.
+	ReasonRejectedByClient = "RejectedByClient"
+	// ReasonAcceptedByClient is set when an xDS client ACKed the resources of a previously rejected XDSService.
+	ReasonAcceptedByClient = "AcceptedByClient"
+	// ReasonRejectionExpired is set when the clients rejecting the resources of an XDSService are gone, or its resources are no longer published.
+	ReasonRejectionExpired = "RejectionExpired"
+)
+
+// XDSServiceStatus defines the observed state of Service
+type XDSServiceStatus struct {
+	// ObservedGeneration is the generation of the spec the status has been computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// SnapshotVersion is the version the resources of the service are served with, only set if all of them share the same version.
+	// +optional
+	SnapshotVersion string `json:"snapshotVersion,omitempty"`
+	// ServedVersions lists the version of each resource type served to each client scope the service is published to.
+	// +optional
+	ServedVersions []ServedVersion `json:"servedVersions,omitempty"`
+	// Rejections lists the resources of the service currently rejected by the xDS clients of each kxds replica.
+	// +optional
+	Rejections []ClientRejection `json:"rejections,omitempty"`
+	// Conditions represent the latest available observations of the service state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClientRejection is the rejection of a resource of the service by an xDS client.
+type ClientRejection struct {
+	// Replica is the namespace and name of the kxds pod the client is connected to.
+	// +optional
+	Replica string `json:"replica,omitempty"`
+	// Node is the ID of the client.
+	Node string `json:"node"`
+	// Type is the type URL of the rejected resource.
+	Type string `json:"type"`
+	// Resource is the name of the rejected resource.
+	Resource string `json:"resource"`
+	// Message is the error detail sent by the client.
+	Message string `json:"message"`
+}
+
+// ServedVersion is the version of a resource type served to the xDS clients of a scope.
+type ServedVersion struct {
+	// Scope is the scope of the clients served this version, empty for the clients without scope.
+	// +optional
+	Scope string `json:"scope,omitempty"`
+	// Type is the type URL of the resources.
+	Type string `json:"type"`
+	// Version is the version of the resources of this type served to the clients of the scope.
+	Version string `json:"version"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.snapshotVersion`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="Ready")].message`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // XDSService is the Schema for the services API
 type XDSService struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec XDSServiceSpec `json:"spec,omitempty"`
+	Spec   XDSServiceSpec   `json:"spec,omitempty"`
+	Status XDSServiceStatus `json:"status,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,137 @@
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	defaultWeight         = 1
+	defaultRegexEngine    = "re2"
+	defaultPathPrefix     = "/"
+	defaultDenominator    = "hundred"
+	defaultFilterStateKey = "io.grpc.channel_id"
+	defaultNumRetries     = 1
+	defaultBaseInterval   = 25 * time.Millisecond
+)
+
+//+kubebuilder:webhook:path=/mutate-api-kxds-dev-v1alpha1-xdsservice,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.kxds.dev,resources=xdsservices,verbs=create;update,versions=v1alpha1,name=mxdsservice.kxds.dev,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &XDSService{}
+
+// Default applies the defaults which depend on other fields, that the kubebuilder markers can't express:
+// a route path only defaults to the "/" prefix if it sets neither an exact path nor a regex.
+// The defaults declared by the markers are repeated, for Default to return a fully defaulted object without the schema defaulting of the API server.
+// Booleans defaulting to true are left aside, as unset can't be told apart from false.
+func (s *XDSService) Default() {
+	if s.Spec.RetryPolicy != nil {
+		defaultRetryPolicy(s.Spec.RetryPolicy)
+	}
+
+	for i := range s.Spec.Filters {
+		if s.Spec.Filters[i].Fault != nil {
+			defaultFaultFilter(s.Spec.Filters[i].Fault)
+		}
+	}
+
+	for i := range s.Spec.Routes {
+		defaultRoute(&s.Spec.Routes[i])
+	}
+
+	for i := range s.Spec.Clusters {
+		for j := range s.Spec.Clusters[i].Localities {
+			defaultLocality(&s.Spec.Clusters[i].Localities[j])
+		}
+	}
+}
+
+func defaultLocality(l *Locality) {
+	if l.Weight == 0 {
+		l.Weight = defaultWeight
+	}
+
+	for i := range l.Static {
+		if l.Static[i].Weight == 0 {
+			l.Static[i].Weight = defaultWeight
+		}
+	}
+}
+
+func defaultRoute(r *Route) {
+	if r.Path.Path == "" && r.Path.Prefix == "" && r.Path.Regex == nil {
+		r.Path.Prefix = defaultPathPrefix
+	}
+
+	if r.Path.Regex != nil {
+		defaultRegexMatcher(r.Path.Regex)
+	}
+
+	for i := range r.Headers {
+		defaultHeaderMatcher(&r.Headers[i])
+	}
+
+	if r.RuntimeFraction != nil {
+		defaultFraction(r.RuntimeFraction)
+	}
+
+	for i := range r.HashPolicy {
+		if r.HashPolicy[i].FilterState != nil && r.HashPolicy[i].FilterState.Key == "" {
+			r.HashPolicy[i].FilterState.Key = defaultFilterStateKey
+		}
+	}
+
+	if r.RetryPolicy != nil {
+		defaultRetryPolicy(r.RetryPolicy)
+	}
+
+	for i := range r.Clusters {
+		if r.Clusters[i].Weight == 0 {
+			r.Clusters[i].Weight = defaultWeight
+		}
+	}
+}
+
+func defaultFaultFilter(f *FaultFilter) {
+	if f.Delay != nil && f.Delay.Percentage != nil {
+		defaultFraction(f.Delay.Percentage)
+	}
+
+	if f.Abort != nil && f.Abort.Percentage != nil {
+		defaultFraction(f.Abort.Percentage)
+	}
+
+	for i := range f.Headers {
+		defaultHeaderMatcher(&f.Headers[i])
+	}
+}
+
+func defaultHeaderMatcher(h *HeaderMatcher) {
+	if h.Regex != nil {
+		defaultRegexMatcher(h.Regex)
+	}
+}
+
+func defaultRegexMatcher(r *RegexMatcher) {
+	if r.Engine == "" {
+		r.Engine = defaultRegexEngine
+	}
+}
+
+func defaultFraction(f *Fraction) {
+	if f.Denominator == "" {
+		f.Denominator = defaultDenominator
+	}
+}
+
+func defaultRetryPolicy(p *RetryPolicy) {
+	if p.NumRetries == nil {
+		numRetries := uint32(defaultNumRetries)
+		p.NumRetries = &numRetries
+	}
+
+	if p.BackOff != nil && p.BackOff.BaseInterval == nil {
+		p.BackOff.BaseInterval = &metav1.Duration{Duration: defaultBaseInterval}
+	}
+}
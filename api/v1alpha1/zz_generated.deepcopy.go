@@ -26,6 +26,36 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateProviderInstance) DeepCopyInto(out *CertificateProviderInstance) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateProviderInstance.
+func (in *CertificateProviderInstance) DeepCopy() *CertificateProviderInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateProviderInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientRejection) DeepCopyInto(out *ClientRejection) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientRejection.
+func (in *ClientRejection) DeepCopy() *ClientRejection {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientRejection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Cluster) DeepCopyInto(out *Cluster) {
 	*out = *in
@@ -34,6 +64,16 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 		*out = new(uint32)
 		**out = **in
 	}
+	if in.LBPolicy != nil {
+		in, out := &in.LBPolicy, &out.LBPolicy
+		*out = new(LBPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(ClusterTLS)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Localities != nil {
 		in, out := &in.Localities, &out.Localities
 		*out = make([]Locality, len(*in))
@@ -68,6 +108,49 @@ func (in *ClusterRef) DeepCopy() *ClusterRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTLS) DeepCopyInto(out *ClusterTLS) {
+	*out = *in
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = new(CertificateProviderInstance)
+		**out = **in
+	}
+	out.CACertificate = in.CACertificate
+	if in.SubjectAltNames != nil {
+		in, out := &in.SubjectAltNames, &out.SubjectAltNames
+		*out = make([]StringMatcher, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTLS.
+func (in *ClusterTLS) DeepCopy() *ClusterTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSEndpoints) DeepCopyInto(out *DNSEndpoints) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSEndpoints.
+func (in *DNSEndpoints) DeepCopy() *DNSEndpoints {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSEndpoints)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FaultAbort) DeepCopyInto(out *FaultAbort) {
 	*out = *in
@@ -178,6 +261,11 @@ func (in *Filter) DeepCopyInto(out *Filter) {
 		*out = new(FaultFilter)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.RBAC != nil {
+		in, out := &in.RBAC, &out.RBAC
+		*out = new(RBACFilter)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Filter.
@@ -190,6 +278,21 @@ func (in *Filter) DeepCopy() *Filter {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilterStateHashPolicy) DeepCopyInto(out *FilterStateHashPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilterStateHashPolicy.
+func (in *FilterStateHashPolicy) DeepCopy() *FilterStateHashPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(FilterStateHashPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Fraction) DeepCopyInto(out *Fraction) {
 	*out = *in
@@ -205,6 +308,31 @@ func (in *Fraction) DeepCopy() *Fraction {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashPolicy) DeepCopyInto(out *HashPolicy) {
+	*out = *in
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(HeaderHashPolicy)
+		**out = **in
+	}
+	if in.FilterState != nil {
+		in, out := &in.FilterState, &out.FilterState
+		*out = new(FilterStateHashPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashPolicy.
+func (in *HashPolicy) DeepCopy() *HashPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(HashPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HeaderFault) DeepCopyInto(out *HeaderFault) {
 	*out = *in
@@ -220,6 +348,21 @@ func (in *HeaderFault) DeepCopy() *HeaderFault {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HeaderHashPolicy) DeepCopyInto(out *HeaderHashPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HeaderHashPolicy.
+func (in *HeaderHashPolicy) DeepCopy() *HeaderHashPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(HeaderHashPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HeaderMatcher) DeepCopyInto(out *HeaderMatcher) {
 	*out = *in
@@ -296,6 +439,66 @@ func (in *K8sService) DeepCopy() *K8sService {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LBPolicy) DeepCopyInto(out *LBPolicy) {
+	*out = *in
+	if in.RoundRobin != nil {
+		in, out := &in.RoundRobin, &out.RoundRobin
+		*out = new(RoundRobinLBPolicy)
+		**out = **in
+	}
+	if in.RingHash != nil {
+		in, out := &in.RingHash, &out.RingHash
+		*out = new(RingHashLBPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WeightedRoundRobin != nil {
+		in, out := &in.WeightedRoundRobin, &out.WeightedRoundRobin
+		*out = new(WeightedRoundRobinLBPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LeastRequest != nil {
+		in, out := &in.LeastRequest, &out.LeastRequest
+		*out = new(LeastRequestLBPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PickFirst != nil {
+		in, out := &in.PickFirst, &out.PickFirst
+		*out = new(PickFirstLBPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LBPolicy.
+func (in *LBPolicy) DeepCopy() *LBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(LBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LeastRequestLBPolicy) DeepCopyInto(out *LeastRequestLBPolicy) {
+	*out = *in
+	if in.ChoiceCount != nil {
+		in, out := &in.ChoiceCount, &out.ChoiceCount
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LeastRequestLBPolicy.
+func (in *LeastRequestLBPolicy) DeepCopy() *LeastRequestLBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(LeastRequestLBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Locality) DeepCopyInto(out *Locality) {
 	*out = *in
@@ -304,6 +507,16 @@ func (in *Locality) DeepCopyInto(out *Locality) {
 		*out = new(K8sService)
 		**out = **in
 	}
+	if in.Static != nil {
+		in, out := &in.Static, &out.Static
+		*out = make([]StaticEndpoint, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(DNSEndpoints)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Locality.
@@ -336,6 +549,122 @@ func (in *PathMatcher) DeepCopy() *PathMatcher {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PickFirstLBPolicy) DeepCopyInto(out *PickFirstLBPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PickFirstLBPolicy.
+func (in *PickFirstLBPolicy) DeepCopy() *PickFirstLBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PickFirstLBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBACFilter) DeepCopyInto(out *RBACFilter) {
+	*out = *in
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]RBACPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBACFilter.
+func (in *RBACFilter) DeepCopy() *RBACFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(RBACFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBACPermission) DeepCopyInto(out *RBACPermission) {
+	*out = *in
+	if in.Path != nil {
+		in, out := &in.Path, &out.Path
+		*out = new(PathMatcher)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(HeaderMatcher)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBACPermission.
+func (in *RBACPermission) DeepCopy() *RBACPermission {
+	if in == nil {
+		return nil
+	}
+	out := new(RBACPermission)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBACPolicy) DeepCopyInto(out *RBACPolicy) {
+	*out = *in
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]RBACPermission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Principals != nil {
+		in, out := &in.Principals, &out.Principals
+		*out = make([]RBACPrincipal, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBACPolicy.
+func (in *RBACPolicy) DeepCopy() *RBACPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RBACPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBACPrincipal) DeepCopyInto(out *RBACPrincipal) {
+	*out = *in
+	if in.Authenticated != nil {
+		in, out := &in.Authenticated, &out.Authenticated
+		*out = new(StringMatcher)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(HeaderMatcher)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBACPrincipal.
+func (in *RBACPrincipal) DeepCopy() *RBACPrincipal {
+	if in == nil {
+		return nil
+	}
+	out := new(RBACPrincipal)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RangeMatcher) DeepCopyInto(out *RangeMatcher) {
 	*out = *in
@@ -366,6 +695,101 @@ func (in *RegexMatcher) DeepCopy() *RegexMatcher {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryBackOff) DeepCopyInto(out *RetryBackOff) {
+	*out = *in
+	if in.BaseInterval != nil {
+		in, out := &in.BaseInterval, &out.BaseInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxInterval != nil {
+		in, out := &in.MaxInterval, &out.MaxInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryBackOff.
+func (in *RetryBackOff) DeepCopy() *RetryBackOff {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryBackOff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.RetryOn != nil {
+		in, out := &in.RetryOn, &out.RetryOn
+		*out = make([]RetryOn, len(*in))
+		copy(*out, *in)
+	}
+	if in.NumRetries != nil {
+		in, out := &in.NumRetries, &out.NumRetries
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.BackOff != nil {
+		in, out := &in.BackOff, &out.BackOff
+		*out = new(RetryBackOff)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RingHashLBPolicy) DeepCopyInto(out *RingHashLBPolicy) {
+	*out = *in
+	if in.MinRingSize != nil {
+		in, out := &in.MinRingSize, &out.MinRingSize
+		*out = new(uint64)
+		**out = **in
+	}
+	if in.MaxRingSize != nil {
+		in, out := &in.MaxRingSize, &out.MaxRingSize
+		*out = new(uint64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RingHashLBPolicy.
+func (in *RingHashLBPolicy) DeepCopy() *RingHashLBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RingHashLBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoundRobinLBPolicy) DeepCopyInto(out *RoundRobinLBPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoundRobinLBPolicy.
+func (in *RoundRobinLBPolicy) DeepCopy() *RoundRobinLBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RoundRobinLBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Route) DeepCopyInto(out *Route) {
 	*out = *in
@@ -392,6 +816,18 @@ func (in *Route) DeepCopyInto(out *Route) {
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.HashPolicy != nil {
+		in, out := &in.HashPolicy, &out.HashPolicy
+		*out = make([]HashPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Clusters != nil {
 		in, out := &in.Clusters, &out.Clusters
 		*out = make([]ClusterRef, len(*in))
@@ -409,12 +845,289 @@ func (in *Route) DeepCopy() *Route {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServedVersion) DeepCopyInto(out *ServedVersion) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServedVersion.
+func (in *ServedVersion) DeepCopy() *ServedVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(ServedVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerRoute) DeepCopyInto(out *ServerRoute) {
+	*out = *in
+	in.Path.DeepCopyInto(&out.Path)
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]HeaderMatcher, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RBAC != nil {
+		in, out := &in.RBAC, &out.RBAC
+		*out = new(RBACFilter)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerRoute.
+func (in *ServerRoute) DeepCopy() *ServerRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerTLS) DeepCopyInto(out *ServerTLS) {
+	*out = *in
+	out.Certificate = in.Certificate
+	if in.CACertificate != nil {
+		in, out := &in.CACertificate, &out.CACertificate
+		*out = new(CertificateProviderInstance)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerTLS.
+func (in *ServerTLS) DeepCopy() *ServerTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticEndpoint) DeepCopyInto(out *StaticEndpoint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticEndpoint.
+func (in *StaticEndpoint) DeepCopy() *StaticEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StringMatcher) DeepCopyInto(out *StringMatcher) {
+	*out = *in
+	if in.Exact != nil {
+		in, out := &in.Exact, &out.Exact
+		*out = new(string)
+		**out = **in
+	}
+	if in.Prefix != nil {
+		in, out := &in.Prefix, &out.Prefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Suffix != nil {
+		in, out := &in.Suffix, &out.Suffix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Contains != nil {
+		in, out := &in.Contains, &out.Contains
+		*out = new(string)
+		**out = **in
+	}
+	if in.Regex != nil {
+		in, out := &in.Regex, &out.Regex
+		*out = new(RegexMatcher)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StringMatcher.
+func (in *StringMatcher) DeepCopy() *StringMatcher {
+	if in == nil {
+		return nil
+	}
+	out := new(StringMatcher)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WeightedRoundRobinLBPolicy) DeepCopyInto(out *WeightedRoundRobinLBPolicy) {
+	*out = *in
+	if in.BlackoutPeriod != nil {
+		in, out := &in.BlackoutPeriod, &out.BlackoutPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.WeightExpirationPeriod != nil {
+		in, out := &in.WeightExpirationPeriod, &out.WeightExpirationPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.WeightUpdatePeriod != nil {
+		in, out := &in.WeightUpdatePeriod, &out.WeightUpdatePeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WeightedRoundRobinLBPolicy.
+func (in *WeightedRoundRobinLBPolicy) DeepCopy() *WeightedRoundRobinLBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(WeightedRoundRobinLBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *XDSServer) DeepCopyInto(out *XDSServer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServer.
+func (in *XDSServer) DeepCopy() *XDSServer {
+	if in == nil {
+		return nil
+	}
+	out := new(XDSServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *XDSServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *XDSServerList) DeepCopyInto(out *XDSServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]XDSServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServerList.
+func (in *XDSServerList) DeepCopy() *XDSServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(XDSServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *XDSServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *XDSServerSpec) DeepCopyInto(out *XDSServerSpec) {
+	*out = *in
+	in.PodSelector.DeepCopyInto(&out.PodSelector)
+	out.Port = in.Port
+	if in.MaxStreamDuration != nil {
+		in, out := &in.MaxStreamDuration, &out.MaxStreamDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Filters != nil {
+		in, out := &in.Filters, &out.Filters
+		*out = make([]Filter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]ServerRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(ServerTLS)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServerSpec.
+func (in *XDSServerSpec) DeepCopy() *XDSServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(XDSServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *XDSServerStatus) DeepCopyInto(out *XDSServerStatus) {
+	*out = *in
+	if in.ServedVersions != nil {
+		in, out := &in.ServedVersions, &out.ServedVersions
+		*out = make([]ServedVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServerStatus.
+func (in *XDSServerStatus) DeepCopy() *XDSServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(XDSServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *XDSService) DeepCopyInto(out *XDSService) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSService.
@@ -475,6 +1188,11 @@ func (in *XDSServiceSpec) DeepCopyInto(out *XDSServiceSpec) {
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Filters != nil {
 		in, out := &in.Filters, &out.Filters
 		*out = make([]Filter, len(*in))
@@ -496,6 +1214,11 @@ func (in *XDSServiceSpec) DeepCopyInto(out *XDSServiceSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServiceSpec.
@@ -507,3 +1230,35 @@ func (in *XDSServiceSpec) DeepCopy() *XDSServiceSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *XDSServiceStatus) DeepCopyInto(out *XDSServiceStatus) {
+	*out = *in
+	if in.ServedVersions != nil {
+		in, out := &in.ServedVersions, &out.ServedVersions
+		*out = make([]ServedVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rejections != nil {
+		in, out := &in.Rejections, &out.Rejections
+		*out = make([]ClientRejection, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new XDSServiceStatus.
+func (in *XDSServiceStatus) DeepCopy() *XDSServiceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(XDSServiceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -17,21 +17,26 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
 	"github.com/jlevesy/kxds/kxds"
@@ -52,10 +57,45 @@ func main() {
 		metricsAddr string
 		probeAddr   string
 		xdsAddr     string
+
+		xdsTLSCertFile     string
+		xdsTLSKeyFile      string
+		xdsTLSClientCAFile string
+		xdsTokenReview     bool
+		xdsTokenAudiences  string
+		xdsTokenAllowedSAs string
+		xdsTokenAllowedNSs string
+		xdsTokenCacheTTL   time.Duration
+
+		enableLeaderElection  bool
+		scopedSnapshots       bool
+		versionPerType        bool
+		enableWebhooks        bool
+		loadReportingInterval time.Duration
+		minRefreshInterval    time.Duration
+		dnsRefreshInterval    time.Duration
+
+		remoteClustersNamespace string
 	)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&xdsAddr, "xds-bind-address", ":18000", "The address the xds server endpoint binds to.")
+	flag.StringVar(&xdsTLSCertFile, "xds-tls-cert-file", "", "The certificate served by the xds server, the server serves plaintext if not set. Reloaded when it changes.")
+	flag.StringVar(&xdsTLSKeyFile, "xds-tls-key-file", "", "The key of the certificate served by the xds server.")
+	flag.StringVar(&xdsTLSClientCAFile, "xds-tls-client-ca-file", "", "The CA the xds clients certificates must be signed by, client certificates are not required if not set. Reloaded when it changes.")
+	flag.BoolVar(&xdsTokenReview, "xds-token-review", false, "Require a ServiceAccount token from the xds clients, validated by a TokenReview. Requires TLS and allowed ServiceAccounts or namespaces.")
+	flag.StringVar(&xdsTokenAudiences, "xds-token-audiences", "", "The comma separated audiences the xds clients tokens must be issued for, the API server audience if not set.")
+	flag.StringVar(&xdsTokenAllowedSAs, "xds-token-allowed-service-accounts", "", "The comma separated ServiceAccounts allowed to connect to the xds server, as namespace/name.")
+	flag.StringVar(&xdsTokenAllowedNSs, "xds-token-allowed-namespaces", "", "The comma separated namespaces whose ServiceAccounts are allowed to connect to the xds server.")
+	flag.DurationVar(&xdsTokenCacheTTL, "xds-token-cache-ttl", 10*time.Second, "How long the review of an xds client token is reused.")
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Elect the replica writing the statuses, all the replicas serve xDS.")
+	flag.BoolVar(&scopedSnapshots, "scoped-snapshots", false, "Publish a snapshot per client scope, the namespace of the ServiceAccount the client authenticated as. Requires --xds-token-review or client certificates.")
+	flag.BoolVar(&versionPerType, "version-per-type", false, "Version each resource type of the snapshots separately, clients are then only sent the resource types which changed.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the XDSService validating and defaulting admission webhooks.")
+	flag.DurationVar(&loadReportingInterval, "load-reporting-interval", 10*time.Second, "The interval at which clients report their load on clusters enabling load reporting.")
+	flag.DurationVar(&minRefreshInterval, "min-refresh-interval", 500*time.Millisecond, "The minimum interval between two snapshot publications, changes received meanwhile are batched.")
+	flag.StringVar(&remoteClustersNamespace, "remote-clusters-namespace", "", "The namespace of the kubeconfig Secrets registering remote clusters, labeled "+kxds.RemoteClusterLabel+". Remote clusters are disabled if not set.")
+	flag.DurationVar(&dnsRefreshInterval, "dns-refresh-interval", 30*time.Second, "The interval at which the hostnames of the DNS localities are resolved again.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -64,11 +104,25 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Scopes are derived from the identity of the clients, without one every client would share the unscoped snapshot.
+	if scopedSnapshots && !xdsTokenReview && xdsTLSClientCAFile == "" {
+		setupLog.Error(errors.New("scoped snapshots require --xds-token-review or --xds-tls-client-ca-file"), "invalid configuration")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		HealthProbeBindAddress: probeAddr,
 		Port:                   9443,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "leader.kxds.dev",
+		// Step down as soon as the manager stops, to speed up the election of another replica.
+		LeaderElectionReleaseOnCancel: true,
+		// Only keep the fields kxds reads of the pods and nodes, all of them are cached.
+		NewCache: ctrlcache.BuilderWithOptions(ctrlcache.Options{
+			TransformByObject: kxds.CacheTransforms(),
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -76,35 +130,98 @@ func main() {
 	}
 
 	var (
+		xdsCache       cache.SnapshotCache
+		refresher      kxds.Refresher
+		refreshMetrics = kxds.NewRefreshMetrics()
+		nackReporter   = kxds.NewNackReporter(mgr.GetClient(), mgr.GetEventRecorderFor("kxds"), replicaName())
+		refresherOpts  = []kxds.RefresherOption{
+			kxds.WithRefreshMetrics(refreshMetrics),
+			kxds.WithNackReporter(nackReporter),
+		}
+	)
+
+	metrics.Registry.MustRegister(refreshMetrics)
+
+	if versionPerType {
+		refresherOpts = append(refresherOpts, kxds.WithVersionPerType())
+	}
+
+	if scopedSnapshots {
+		scopedCache := kxds.NewScopedSnapshotCache(kxds.NewLogger(mgr.GetLogger()))
+
+		xdsCache = scopedCache
+		refresher = kxds.NewScopedCacheRefresher(scopedCache, refresherOpts...)
+	} else {
 		xdsCache = cache.NewSnapshotCache(
 			false,
 			kxds.DefaultHash,
 			kxds.NewLogger(mgr.GetLogger()),
 		)
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey, refresherOpts...)
+	}
+
+	cacheReconciller := kxds.NewReconciler(mgr.GetClient(), refresher)
 
-		cacheReconciller = kxds.NewReconciler(
+	// Expose the load reported by the clients on the metrics endpoint.
+	loadReporting := kxds.NewLoadReportingServer(loadReportingInterval)
+	serverMetrics := kxds.NewServerMetrics()
+	metrics.Registry.MustRegister(loadReporting, serverMetrics)
+
+	xdsServerConfig := kxds.XDSServerConfig{
+		BindAddr:      xdsAddr,
+		LoadReporting: loadReporting,
+		Metrics:       serverMetrics,
+		AckObserver:   nackReporter,
+	}
+
+	if xdsTLSCertFile != "" {
+		xdsServerConfig.TLS = &kxds.ServerTLSConfig{
+			CertFile:     xdsTLSCertFile,
+			KeyFile:      xdsTLSKeyFile,
+			ClientCAFile: xdsTLSClientCAFile,
+		}
+	}
+
+	if xdsTokenReview {
+		xdsServerConfig.TokenAuth = kxds.NewTokenReviewAuthenticator(
 			mgr.GetClient(),
-			kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey),
+			kxds.TokenReviewConfig{
+				Audiences:              splitList(xdsTokenAudiences),
+				AllowedServiceAccounts: splitList(xdsTokenAllowedSAs),
+				AllowedNamespaces:      splitList(xdsTokenAllowedNSs),
+				CacheTTL:               xdsTokenCacheTTL,
+			},
 		)
-	)
+	}
 
-	if err := mgr.Add(kxds.NewXDSServer(xdsCache, kxds.XDSServerConfig{BindAddr: xdsAddr})); err != nil {
+	if err := mgr.Add(kxds.NewXDSServer(xdsCache, xdsServerConfig)); err != nil {
 		setupLog.Error(err, "unable to create the xds server")
 		os.Exit(1)
 	}
 
-	// Start looking for xds services.
-	if err = ctrl.NewControllerManagedBy(mgr).For(&kxdsv1alpha1.XDSService{}).Complete(cacheReconciller); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "kxdsv1alpha1.XDSService")
+	// Report the configurations rejected by the clients on the XDSServices they come from.
+	if err := mgr.Add(nackReporter); err != nil {
+		setupLog.Error(err, "unable to create the nack reporter")
 		os.Exit(1)
 	}
 
-	// Start looking for endpoints.
-	if err = ctrl.NewControllerManagedBy(mgr).For(&corev1.Endpoints{}).Complete(cacheReconciller); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "corev1.Endpoints")
+	// Start looking for xds services and servers, and the endpoint slices and pods they depend on.
+	if err = cacheReconciller.SetupWithManager(mgr, minRefreshInterval, dnsRefreshInterval, remoteClustersNamespace); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "kxds")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		// Defaults are applied by XDSService itself.
+		if err = ctrl.NewWebhookManagedBy(mgr).
+			For(&kxdsv1alpha1.XDSService{}).
+			WithValidator(kxds.XDSServiceValidator{}).
+			Complete(); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "kxdsv1alpha1.XDSService")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -120,3 +237,22 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// replicaName returns the namespace and name of the pod running the replica, set by the downward API.
+func replicaName() string {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return ""
+	}
+
+	return ktypes.NamespacedName{Namespace: os.Getenv("POD_NAMESPACE"), Name: name}.String()
+}
+
+// splitList splits a comma separated flag value, nil if it is empty.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
@@ -14,6 +14,7 @@ import (
 	_ "google.golang.org/grpc/xds"
 
 	echo "github.com/jlevesy/kxds/pkg/echoserver/proto"
+	_ "github.com/jlevesy/kxds/pkg/xdscreds"
 )
 
 type metadataArgs map[string]string
@@ -0,0 +1,309 @@
+package kxds
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	bearerPrefix                 = "Bearer "
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+)
+
+// ServerTLSConfig holds the certificates of the xDS server, reloaded from disk when they change.
+type ServerTLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile makes the server require client certificates signed by this CA if set.
+	ClientCAFile string
+}
+
+// makeTLSConfig returns the TLS configuration of the server, and the watcher reloading its certificate.
+func (c *ServerTLSConfig) makeTLSConfig() (*tls.Config, *certwatcher.CertWatcher, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, nil, errors.New("both a certificate and a key are required to serve TLS")
+	}
+
+	watcher, err := certwatcher.New(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load the server certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: watcher.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if c.ClientCAFile == "" {
+		return tlsConfig, watcher, nil
+	}
+
+	clientCAs := &caPool{path: c.ClientCAFile}
+	if _, err := clientCAs.get(); err != nil {
+		return nil, nil, fmt.Errorf("could not load the client CA: %w", err)
+	}
+
+	// The client CA is checked for changes on each handshake.
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := clientCAs.get()
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{
+			GetCertificate: watcher.GetCertificate,
+			ClientCAs:      pool,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			MinVersion:     tls.VersionTLS12,
+		}, nil
+	}
+
+	return tlsConfig, watcher, nil
+}
+
+// caPool is a CA bundle read again from disk when its modification time changes.
+type caPool struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	pool    *x509.CertPool
+}
+
+func (p *caPool) get() (*x509.CertPool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pool != nil && info.ModTime().Equal(p.modTime) {
+		return p.pool, nil
+	}
+
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificate found in %q", p.path)
+	}
+
+	p.pool = pool
+	p.modTime = info.ModTime()
+
+	return pool, nil
+}
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// defaultTokenReviewCacheTTL is how long the review of a token is reused if not configured.
+const defaultTokenReviewCacheTTL = 10 * time.Second
+
+// TokenReviewConfig configures the authentication of the xDS clients by their kubernetes ServiceAccount token, and which ones are allowed.
+type TokenReviewConfig struct {
+	// Audiences the tokens must be issued for, the API server audience if empty.
+	Audiences []string
+	// AllowedServiceAccounts lists the ServiceAccounts allowed to connect, as namespace/name.
+	AllowedServiceAccounts []string
+	// AllowedNamespaces lists the namespaces whose ServiceAccounts are allowed to connect.
+	AllowedNamespaces []string
+	// CacheTTL is how long the review of a token is reused, defaultTokenReviewCacheTTL if zero.
+	CacheTTL time.Duration
+}
+
+// TokenReviewAuthenticator authenticates the xDS clients by the kubernetes ServiceAccount token they send as a bearer token.
+// Only the allowed ServiceAccounts are authorized to connect.
+type TokenReviewAuthenticator struct {
+	client client.Client
+	cfg    TokenReviewConfig
+
+	allowedServiceAccounts map[string]struct{}
+	allowedNamespaces      map[string]struct{}
+
+	mu sync.Mutex
+	// reviews holds the outcome of the recent reviews, by token hash.
+	reviews map[[sha256.Size]byte]tokenReview
+}
+
+// tokenReview is the outcome of the review of a token, valid until it expires.
+type tokenReview struct {
+	serviceAccount ktypes.NamespacedName
+	err            error
+	expiresAt      time.Time
+}
+
+func NewTokenReviewAuthenticator(cl client.Client, cfg TokenReviewConfig) *TokenReviewAuthenticator {
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = defaultTokenReviewCacheTTL
+	}
+
+	a := &TokenReviewAuthenticator{
+		client:                 cl,
+		cfg:                    cfg,
+		allowedServiceAccounts: make(map[string]struct{}, len(cfg.AllowedServiceAccounts)),
+		allowedNamespaces:      make(map[string]struct{}, len(cfg.AllowedNamespaces)),
+		reviews:                make(map[[sha256.Size]byte]tokenReview),
+	}
+
+	for _, sa := range cfg.AllowedServiceAccounts {
+		a.allowedServiceAccounts[sa] = struct{}{}
+	}
+
+	for _, ns := range cfg.AllowedNamespaces {
+		a.allowedNamespaces[ns] = struct{}{}
+	}
+
+	return a
+}
+
+// validate makes sure that some ServiceAccounts are allowed, any valid token would be accepted otherwise.
+func (a *TokenReviewAuthenticator) validate() error {
+	if len(a.allowedServiceAccounts) == 0 && len(a.allowedNamespaces) == 0 {
+		return errors.New("token authentication requires allowed ServiceAccounts or namespaces")
+	}
+
+	return nil
+}
+
+// authenticate reviews the bearer token of the incoming call, and checks that its ServiceAccount is allowed.
+func (a *TokenReviewAuthenticator) authenticate(ctx context.Context) (ktypes.NamespacedName, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 || !strings.HasPrefix(authorization[0], bearerPrefix) {
+		return ktypes.NamespacedName{}, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	serviceAccount, err := a.review(ctx, strings.TrimPrefix(authorization[0], bearerPrefix))
+	if err != nil {
+		return ktypes.NamespacedName{}, err
+	}
+
+	if !a.allowed(serviceAccount) {
+		return ktypes.NamespacedName{}, status.Errorf(codes.PermissionDenied, "ServiceAccount %q is not allowed", serviceAccount)
+	}
+
+	return serviceAccount, nil
+}
+
+// review returns the ServiceAccount of a token, reusing the recent reviews of the same token.
+func (a *TokenReviewAuthenticator) review(ctx context.Context, token string) (ktypes.NamespacedName, error) {
+	var (
+		key = sha256.Sum256([]byte(token))
+		now = time.Now()
+	)
+
+	a.mu.Lock()
+	cached, ok := a.reviews[key]
+	a.mu.Unlock()
+
+	if ok && now.Before(cached.expiresAt) {
+		return cached.serviceAccount, cached.err
+	}
+
+	review := authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.cfg.Audiences,
+		},
+	}
+
+	// Failing to reach the API server says nothing about the token, it isn't cached.
+	if err := a.client.Create(ctx, &review); err != nil {
+		return ktypes.NamespacedName{}, status.Errorf(codes.Unavailable, "could not review token: %v", err)
+	}
+
+	result := tokenReview{expiresAt: now.Add(a.cfg.CacheTTL)}
+
+	switch {
+	case !review.Status.Authenticated:
+		msg := review.Status.Error
+		if msg == "" {
+			msg = "invalid token"
+		}
+
+		result.err = status.Error(codes.Unauthenticated, msg)
+	default:
+		serviceAccount, ok := parseServiceAccountUsername(review.Status.User.Username)
+		if !ok {
+			result.err = status.Errorf(codes.PermissionDenied, "user %q is not a ServiceAccount", review.Status.User.Username)
+			break
+		}
+
+		result.serviceAccount = serviceAccount
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Drop the expired reviews, for the cache not to grow with the tokens rotated away.
+	for k, r := range a.reviews {
+		if !now.Before(r.expiresAt) {
+			delete(a.reviews, k)
+		}
+	}
+
+	a.reviews[key] = result
+
+	return result.serviceAccount, result.err
+}
+
+// parseServiceAccountUsername reads the namespace and name of a ServiceAccount from its username, system:serviceaccount:<namespace>:<name>.
+func parseServiceAccountUsername(username string) (ktypes.NamespacedName, bool) {
+	parts := strings.Split(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":")
+	if !strings.HasPrefix(username, serviceAccountUsernamePrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ktypes.NamespacedName{}, false
+	}
+
+	return ktypes.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+func (a *TokenReviewAuthenticator) allowed(serviceAccount ktypes.NamespacedName) bool {
+	if _, ok := a.allowedNamespaces[serviceAccount.Namespace]; ok {
+		return true
+	}
+
+	_, ok := a.allowedServiceAccounts[serviceAccount.String()]
+
+	return ok
+}
+
+func (a *TokenReviewAuthenticator) unaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, err := a.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamInterceptor authenticates the streams once when they are opened.
+func (a *TokenReviewAuthenticator) streamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	serviceAccount, err := a.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &identifiedStream{ServerStream: stream, ctx: withServiceAccount(stream.Context(), serviceAccount)})
+}
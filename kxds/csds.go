@@ -0,0 +1,515 @@
+package kxds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	adminv3 "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	statusv3 "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ClientStatusTracker records the resources sent to each xDS client stream, and whether the client ACKed or NACKed them.
+// It wraps the xDS server callbacks, and serves the recorded state through the Client Status Discovery Service.
+type ClientStatusTracker struct {
+	server.Callbacks
+
+	// observer is notified of the ACKs and NACKs, if set.
+	observer AckObserver
+
+	mu      sync.Mutex
+	streams map[int64]*streamStatus
+	// Incremental streams are numbered independently from the state of the world ones.
+	deltaStreams map[int64]*streamStatus
+}
+
+type streamStatus struct {
+	node  *core.Node
+	types map[string]*typeStatus
+}
+
+// typeStatus is the state of a stream for a resource type.
+type typeStatus struct {
+	requestedNames []string
+
+	// Last response sent, waiting for an ACK or a NACK.
+	pendingNonce     string
+	pendingVersion   string
+	pendingResources []*anypb.Any
+	// Resources removed by the last response, only sent on incremental streams.
+	pendingRemoved []string
+
+	// Resources ACKed by the client, by name.
+	ackedVersion   string
+	ackedResources map[string]*anypb.Any
+	lastUpdated    time.Time
+
+	// Set if the last response has been NACKed.
+	nackedResources []*anypb.Any
+	errorState      *adminv3.UpdateFailureState
+}
+
+// AckObserver is notified when a client ACKs or NACKs a response, and when it disconnects.
+// It is called while the tracker holds its lock and must not block.
+type AckObserver interface {
+	// ObserveAck receives the resources of the response, and the error detail of the client if it has been NACKed.
+	ObserveAck(node *core.Node, typeURL string, resources []*anypb.Any, errorDetail *rpcstatus.Status)
+	// ObserveDisconnect is called once the last stream of a client is closed.
+	ObserveDisconnect(node *core.Node)
+}
+
+// NewClientStatusTracker returns a tracker wrapping the given callbacks, notifying the given observer if not nil.
+func NewClientStatusTracker(cb server.Callbacks, observer AckObserver) *ClientStatusTracker {
+	return &ClientStatusTracker{
+		Callbacks:    cb,
+		observer:     observer,
+		streams:      make(map[int64]*streamStatus),
+		deltaStreams: make(map[int64]*streamStatus),
+	}
+}
+
+func (t *ClientStatusTracker) OnStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	t.mu.Lock()
+	t.streams[streamID] = &streamStatus{types: make(map[string]*typeStatus)}
+	t.mu.Unlock()
+
+	return t.Callbacks.OnStreamOpen(ctx, streamID, typeURL)
+}
+
+func (t *ClientStatusTracker) OnStreamClosed(streamID int64, node *core.Node) {
+	t.mu.Lock()
+	t.closeStream(t.streams, streamID)
+	t.mu.Unlock()
+
+	t.Callbacks.OnStreamClosed(streamID, node)
+}
+
+func (t *ClientStatusTracker) OnStreamRequest(streamID int64, req *discoveryv3.DiscoveryRequest) error {
+	t.mu.Lock()
+	t.recordRequest(streamID, req)
+	t.mu.Unlock()
+
+	return t.Callbacks.OnStreamRequest(streamID, req)
+}
+
+func (t *ClientStatusTracker) OnStreamResponse(ctx context.Context, streamID int64, req *discoveryv3.DiscoveryRequest, resp *discoveryv3.DiscoveryResponse) {
+	t.mu.Lock()
+	if stream, ok := t.streams[streamID]; ok {
+		ts := stream.typeStatus(resp.TypeUrl)
+		ts.pendingNonce = resp.Nonce
+		ts.pendingVersion = resp.VersionInfo
+		ts.pendingResources = resp.Resources
+	}
+	t.mu.Unlock()
+
+	t.Callbacks.OnStreamResponse(ctx, streamID, req, resp)
+}
+
+func (t *ClientStatusTracker) OnDeltaStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	t.mu.Lock()
+	t.deltaStreams[streamID] = &streamStatus{types: make(map[string]*typeStatus)}
+	t.mu.Unlock()
+
+	return t.Callbacks.OnDeltaStreamOpen(ctx, streamID, typeURL)
+}
+
+func (t *ClientStatusTracker) OnDeltaStreamClosed(streamID int64, node *core.Node) {
+	t.mu.Lock()
+	t.closeStream(t.deltaStreams, streamID)
+	t.mu.Unlock()
+
+	t.Callbacks.OnDeltaStreamClosed(streamID, node)
+}
+
+func (t *ClientStatusTracker) OnStreamDeltaRequest(streamID int64, req *discoveryv3.DeltaDiscoveryRequest) error {
+	t.mu.Lock()
+	t.recordDeltaRequest(streamID, req)
+	t.mu.Unlock()
+
+	return t.Callbacks.OnStreamDeltaRequest(streamID, req)
+}
+
+func (t *ClientStatusTracker) OnStreamDeltaResponse(streamID int64, req *discoveryv3.DeltaDiscoveryRequest, resp *discoveryv3.DeltaDiscoveryResponse) {
+	t.mu.Lock()
+	if stream, ok := t.deltaStreams[streamID]; ok {
+		ts := stream.typeStatus(resp.TypeUrl)
+		ts.pendingNonce = resp.Nonce
+		ts.pendingVersion = resp.SystemVersionInfo
+		ts.pendingResources = make([]*anypb.Any, len(resp.Resources))
+		ts.pendingRemoved = resp.RemovedResources
+
+		for i, res := range resp.Resources {
+			ts.pendingResources[i] = res.Resource
+		}
+	}
+	t.mu.Unlock()
+
+	t.Callbacks.OnStreamDeltaResponse(streamID, req, resp)
+}
+
+func (t *ClientStatusTracker) recordRequest(streamID int64, req *discoveryv3.DiscoveryRequest) {
+	stream, ok := t.streams[streamID]
+	if !ok {
+		return
+	}
+
+	// Clients only send their node on the first request of a stream.
+	if req.Node != nil {
+		stream.node = req.Node
+	}
+
+	ts := stream.typeStatus(req.TypeUrl)
+	ts.requestedNames = req.ResourceNames
+
+	if req.ResponseNonce == "" || req.ResponseNonce != ts.pendingNonce {
+		return
+	}
+
+	ts.recordAck(req.ErrorDetail, false)
+	t.notifyAck(stream.node, req.TypeUrl, ts.pendingResources, req.ErrorDetail)
+}
+
+func (t *ClientStatusTracker) recordDeltaRequest(streamID int64, req *discoveryv3.DeltaDiscoveryRequest) {
+	stream, ok := t.deltaStreams[streamID]
+	if !ok {
+		return
+	}
+
+	if req.Node != nil {
+		stream.node = req.Node
+	}
+
+	ts := stream.typeStatus(req.TypeUrl)
+	ts.requestedNames = updateSubscriptions(ts.requestedNames, req.ResourceNamesSubscribe, req.ResourceNamesUnsubscribe)
+
+	if req.ResponseNonce == "" || req.ResponseNonce != ts.pendingNonce {
+		return
+	}
+
+	ts.recordAck(req.ErrorDetail, true)
+	t.notifyAck(stream.node, req.TypeUrl, ts.pendingResources, req.ErrorDetail)
+}
+
+// closeStream forgets a stream, and notifies the observer if it was the last stream of its client.
+func (t *ClientStatusTracker) closeStream(streams map[int64]*streamStatus, streamID int64) {
+	stream, ok := streams[streamID]
+	if !ok {
+		return
+	}
+
+	delete(streams, streamID)
+
+	if t.observer == nil || stream.node == nil {
+		return
+	}
+
+	for _, other := range t.streams {
+		if other.node.GetId() == stream.node.GetId() {
+			return
+		}
+	}
+
+	for _, other := range t.deltaStreams {
+		if other.node.GetId() == stream.node.GetId() {
+			return
+		}
+	}
+
+	t.observer.ObserveDisconnect(stream.node)
+}
+
+func (t *ClientStatusTracker) notifyAck(node *core.Node, typeURL string, resources []*anypb.Any, errorDetail *rpcstatus.Status) {
+	if t.observer == nil {
+		return
+	}
+
+	t.observer.ObserveAck(node, typeURL, resources, errorDetail)
+}
+
+// recordAck records the ACK or the NACK of the pending response.
+// Incremental responses are applied on top of the ACKed resources, while state of the world responses replace them.
+func (ts *typeStatus) recordAck(errorDetail *rpcstatus.Status, delta bool) {
+	if errorDetail != nil {
+		ts.nackedResources = ts.pendingResources
+		ts.errorState = &adminv3.UpdateFailureState{
+			LastUpdateAttempt: timestamppb.Now(),
+			Details:           errorDetail.Message,
+			VersionInfo:       ts.pendingVersion,
+		}
+
+		return
+	}
+
+	if !delta || ts.ackedResources == nil {
+		ts.ackedResources = make(map[string]*anypb.Any, len(ts.pendingResources))
+	}
+
+	for _, res := range ts.pendingResources {
+		ts.ackedResources[resourceName(res)] = res
+	}
+
+	for _, name := range ts.pendingRemoved {
+		delete(ts.ackedResources, name)
+	}
+
+	ts.ackedVersion = ts.pendingVersion
+	ts.lastUpdated = time.Now()
+	ts.nackedResources = nil
+	ts.errorState = nil
+}
+
+func updateSubscriptions(names, subscribe, unsubscribe []string) []string {
+	unsubscribed := make(map[string]struct{}, len(unsubscribe))
+	for _, name := range unsubscribe {
+		unsubscribed[name] = struct{}{}
+	}
+
+	var result []string
+
+	for _, name := range append(names, subscribe...) {
+		if _, ok := unsubscribed[name]; ok {
+			continue
+		}
+
+		// Mark the name as seen to skip duplicates.
+		unsubscribed[name] = struct{}{}
+
+		result = append(result, name)
+	}
+
+	return result
+}
+
+func (s *streamStatus) typeStatus(typeURL string) *typeStatus {
+	ts, ok := s.types[typeURL]
+	if !ok {
+		ts = &typeStatus{}
+		s.types[typeURL] = ts
+	}
+
+	return ts
+}
+
+func (t *ClientStatusTracker) FetchClientStatus(_ context.Context, req *statusv3.ClientStatusRequest) (*statusv3.ClientStatusResponse, error) {
+	return t.clientStatus(req)
+}
+
+func (t *ClientStatusTracker) StreamClientStatus(stream statusv3.ClientStatusDiscoveryService_StreamClientStatusServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := t.clientStatus(req)
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *ClientStatusTracker) clientStatus(req *statusv3.ClientStatusRequest) (*statusv3.ClientStatusResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var resp statusv3.ClientStatusResponse
+
+	for _, streams := range []map[int64]*streamStatus{t.streams, t.deltaStreams} {
+		streamIDs := make([]int64, 0, len(streams))
+		for id := range streams {
+			streamIDs = append(streamIDs, id)
+		}
+
+		sort.Slice(streamIDs, func(i, j int) bool { return streamIDs[i] < streamIDs[j] })
+
+		for _, id := range streamIDs {
+			stream := streams[id]
+
+			match, err := matchNode(req.NodeMatchers, stream.node)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			if !match {
+				continue
+			}
+
+			resp.Config = append(resp.Config, stream.clientConfig())
+		}
+	}
+
+	return &resp, nil
+}
+
+func (s *streamStatus) clientConfig() *statusv3.ClientConfig {
+	cfg := statusv3.ClientConfig{Node: s.node}
+
+	typeURLs := make([]string, 0, len(s.types))
+	for typeURL := range s.types {
+		typeURLs = append(typeURLs, typeURL)
+	}
+
+	sort.Strings(typeURLs)
+
+	for _, typeURL := range typeURLs {
+		cfg.GenericXdsConfigs = append(cfg.GenericXdsConfigs, s.types[typeURL].genericXDSConfigs(typeURL)...)
+	}
+
+	return &cfg
+}
+
+func (ts *typeStatus) genericXDSConfigs(typeURL string) []*statusv3.ClientConfig_GenericXdsConfig {
+	var (
+		configs []*statusv3.ClientConfig_GenericXdsConfig
+		seen    = make(map[string]struct{})
+	)
+
+	for _, res := range ts.nackedResources {
+		name := resourceName(res)
+		seen[name] = struct{}{}
+
+		configs = append(configs, &statusv3.ClientConfig_GenericXdsConfig{
+			TypeUrl:      typeURL,
+			Name:         name,
+			VersionInfo:  ts.ackedVersion,
+			XdsConfig:    res,
+			ConfigStatus: statusv3.ConfigStatus_ERROR,
+			ClientStatus: adminv3.ClientResourceStatus_NACKED,
+			ErrorState:   ts.errorState,
+		})
+	}
+
+	ackedNames := make([]string, 0, len(ts.ackedResources))
+	for name := range ts.ackedResources {
+		ackedNames = append(ackedNames, name)
+	}
+
+	sort.Strings(ackedNames)
+
+	for _, name := range ackedNames {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		seen[name] = struct{}{}
+
+		configs = append(configs, &statusv3.ClientConfig_GenericXdsConfig{
+			TypeUrl:      typeURL,
+			Name:         name,
+			VersionInfo:  ts.ackedVersion,
+			XdsConfig:    ts.ackedResources[name],
+			LastUpdated:  timestamppb.New(ts.lastUpdated),
+			ConfigStatus: statusv3.ConfigStatus_SYNCED,
+			ClientStatus: adminv3.ClientResourceStatus_ACKED,
+		})
+	}
+
+	for _, name := range ts.requestedNames {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		configs = append(configs, &statusv3.ClientConfig_GenericXdsConfig{
+			TypeUrl:      typeURL,
+			Name:         name,
+			ConfigStatus: statusv3.ConfigStatus_NOT_SENT,
+			ClientStatus: adminv3.ClientResourceStatus_REQUESTED,
+		})
+	}
+
+	return configs
+}
+
+func resourceName(res *anypb.Any) string {
+	msg, err := res.UnmarshalNew()
+	if err != nil {
+		return ""
+	}
+
+	return cache.GetResourceName(types.Resource(msg))
+}
+
+func matchNode(matchers []*matcher.NodeMatcher, node *core.Node) (bool, error) {
+	if len(matchers) == 0 {
+		return true, nil
+	}
+
+	for _, m := range matchers {
+		if len(m.NodeMetadatas) > 0 {
+			return false, errors.New("node metadata matchers are not supported")
+		}
+
+		if m.NodeId == nil {
+			return true, nil
+		}
+
+		match, err := matchString(m.NodeId, node.GetId())
+		if err != nil {
+			return false, err
+		}
+
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchString(m *matcher.StringMatcher, value string) (bool, error) {
+	// Ignore case has no effect on regex matching.
+	if pattern, ok := m.MatchPattern.(*matcher.StringMatcher_SafeRegex); ok {
+		re, err := regexp.Compile(pattern.SafeRegex.Regex)
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(value), nil
+	}
+
+	normalize := func(s string) string {
+		if m.IgnoreCase {
+			return strings.ToLower(s)
+		}
+
+		return s
+	}
+
+	value = normalize(value)
+
+	switch pattern := m.MatchPattern.(type) {
+	case *matcher.StringMatcher_Exact:
+		return value == normalize(pattern.Exact), nil
+	case *matcher.StringMatcher_Prefix:
+		return strings.HasPrefix(value, normalize(pattern.Prefix)), nil
+	case *matcher.StringMatcher_Suffix:
+		return strings.HasSuffix(value, normalize(pattern.Suffix)), nil
+	case *matcher.StringMatcher_Contains:
+		return strings.Contains(value, normalize(pattern.Contains)), nil
+	default:
+		return false, errors.New("malformed string matcher")
+	}
+}
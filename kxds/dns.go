@@ -0,0 +1,121 @@
+package kxds
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// dnsResolver resolves the hostnames of the DNS localities, and keeps their addresses until they are resolved again.
+type dnsResolver struct {
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu sync.Mutex
+	// addresses holds the sorted addresses of each tracked hostname, hostnames which never resolved are tracked without addresses.
+	addresses map[string][]string
+}
+
+func newDNSResolver() *dnsResolver {
+	return &dnsResolver{
+		lookupHost: net.DefaultResolver.LookupHost,
+		addresses:  make(map[string][]string),
+	}
+}
+
+// resolve returns the addresses of the given hostnames, resolving the ones seen for the first time.
+// Hostnames no longer referenced are not tracked anymore, and hostnames which could not be resolved are left out.
+func (r *dnsResolver) resolve(ctx context.Context, hostnames []string) map[string][]string {
+	r.mu.Lock()
+	var unknown []string
+	for _, hostname := range hostnames {
+		if _, ok := r.addresses[hostname]; !ok {
+			unknown = append(unknown, hostname)
+		}
+	}
+	r.mu.Unlock()
+
+	// Lookups run out of the lock, not to hold back the periodic refreshes.
+	lookups := make(map[string][]string, len(unknown))
+	for _, hostname := range unknown {
+		lookups[hostname], _ = r.lookup(ctx, hostname)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		tracked  = make(map[string][]string, len(hostnames))
+		resolved = make(map[string][]string, len(hostnames))
+	)
+
+	for _, hostname := range hostnames {
+		addrs, ok := r.addresses[hostname]
+		if !ok {
+			addrs = lookups[hostname]
+		}
+
+		tracked[hostname] = addrs
+
+		if addrs != nil {
+			resolved[hostname] = addrs
+		}
+	}
+
+	r.addresses = tracked
+
+	return resolved
+}
+
+// refresh resolves all the tracked hostnames again, and reports if any of their addresses changed.
+// Hostnames which fail to resolve keep their last known addresses.
+func (r *dnsResolver) refresh(ctx context.Context) bool {
+	r.mu.Lock()
+	hostnames := make([]string, 0, len(r.addresses))
+	for hostname := range r.addresses {
+		hostnames = append(hostnames, hostname)
+	}
+	r.mu.Unlock()
+
+	// Lookups run out of the lock, not to hold back the refreshes of the cache.
+	results := make(map[string][]string, len(hostnames))
+	for _, hostname := range hostnames {
+		if addrs, err := r.lookup(ctx, hostname); err == nil {
+			results[hostname] = addrs
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed bool
+
+	for hostname, addrs := range results {
+		current, ok := r.addresses[hostname]
+		if !ok || equality.Semantic.DeepEqual(current, addrs) {
+			// The hostname is not referenced anymore, or its addresses didn't change.
+			continue
+		}
+
+		r.addresses[hostname] = addrs
+		changed = true
+	}
+
+	return changed
+}
+
+func (r *dnsResolver) lookup(ctx context.Context, hostname string) ([]string, error) {
+	addrs, err := r.lookupHost(ctx, hostname)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to resolve hostname", "hostname", hostname)
+
+		return nil, err
+	}
+
+	sort.Strings(addrs)
+
+	return addrs, nil
+}
@@ -0,0 +1,54 @@
+package kxds
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Exposes the event mapping of the reconciler, as the fake client can't drive a controller.
+var (
+	RequestRefresh   = (*Reconciller).requestRefresh
+	MapEndpointSlice = (*Reconciller).mapEndpointSlice
+	MapPod           = (*Reconciller).mapPod
+	MapBackingPod    = (*Reconciller).mapBackingPod
+	BecomeLeader     = (*Reconciller).becomeLeader
+	RefreshDNS       = (*Reconciller).refreshDNS
+
+	MapRemoteEndpointSlice = (*Reconciller).mapRemoteEndpointSlice
+)
+
+func (r *Reconciller) SetMinRefreshInterval(d time.Duration) {
+	r.minRefreshInterval = d
+}
+
+// SetFollower makes the reconciler behave as a replica which is not elected.
+func (r *Reconciller) SetFollower() {
+	r.leader = false
+}
+
+// SetLookupHost replaces the resolver of the DNS localities hostnames.
+func (r *Reconciller) SetLookupHost(lookupHost func(ctx context.Context, host string) ([]string, error)) {
+	r.dns.lookupHost = lookupHost
+}
+
+// SetRemoteCluster registers an available remote cluster reading its endpoint slices from the given reader.
+func (r *Reconciller) SetRemoteCluster(name string, kubeconfig []byte, reader client.Reader) {
+	r.remotes.mu.Lock()
+	defer r.remotes.mu.Unlock()
+
+	r.remotes.clusters[name] = &remoteCluster{kubeconfig: kubeconfig, reader: reader, available: true, cancel: func() {}}
+}
+
+// StartRemoteClusters connects to the remote clusters registered by the Secrets of the given namespace, until the given context is done.
+func (r *Reconciller) StartRemoteClusters(ctx context.Context, secrets client.Reader, namespace string, scheme *runtime.Scheme, backoff wait.Backoff) {
+	r.remotes.secrets = secrets
+	r.remotes.namespace = namespace
+	r.remotes.scheme = scheme
+	r.remotes.backoff = backoff
+
+	r.remotes.start(ctx, func(clusterName string, obj client.Object) {})
+}
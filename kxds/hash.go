@@ -1,11 +1,43 @@
 package kxds
 
-import corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+import (
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
 
 const DefautHashKey = "kxds"
 
+// ScopeMetadataKey is the node metadata field holding the scope of a client.
+// The server sets it to the namespace of the ServiceAccount the client authenticated as, whatever the client sent.
+const ScopeMetadataKey = "kxds.dev/scope"
+
 type ConstantHash string
 
 func (h ConstantHash) ID(*corev3.Node) string { return string(h) }
 
 var DefaultHash = ConstantHash(DefautHashKey)
+
+// ScopeHash keys the snapshots on the scope of the clients, clients without a scope share the default snapshot.
+type ScopeHash struct{}
+
+func (ScopeHash) ID(node *corev3.Node) string {
+	return ScopeHashKey(node.GetMetadata().GetFields()[ScopeMetadataKey].GetStringValue())
+}
+
+// ScopeHashKey returns the key of the snapshot served to the clients of a scope.
+func ScopeHashKey(scope string) string {
+	if scope == "" {
+		return DefautHashKey
+	}
+
+	return DefautHashKey + "/" + scope
+}
+
+func hashKeyScope(key string) string {
+	if key == DefautHashKey {
+		return ""
+	}
+
+	return strings.TrimPrefix(key, DefautHashKey+"/")
+}
@@ -0,0 +1,126 @@
+package kxds
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/structpb"
+	ktypes "k8s.io/apimachinery/pkg/types"
+)
+
+type serviceAccountKey struct{}
+
+// withServiceAccount returns a context holding the ServiceAccount the client authenticated as.
+func withServiceAccount(ctx context.Context, serviceAccount ktypes.NamespacedName) context.Context {
+	return context.WithValue(ctx, serviceAccountKey{}, serviceAccount)
+}
+
+// clientServiceAccount returns the ServiceAccount the client authenticated as, either by its token or by its verified certificate.
+func clientServiceAccount(ctx context.Context) (ktypes.NamespacedName, bool) {
+	if serviceAccount, ok := ctx.Value(serviceAccountKey{}).(ktypes.NamespacedName); ok {
+		return serviceAccount, true
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ktypes.NamespacedName{}, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ktypes.NamespacedName{}, false
+	}
+
+	return certificateServiceAccount(tlsInfo.State.VerifiedChains[0][0])
+}
+
+// certificateServiceAccount reads the ServiceAccount of a client certificate from its SPIFFE ID, spiffe://<trust domain>/ns/<namespace>/sa/<name>.
+func certificateServiceAccount(cert *x509.Certificate) (ktypes.NamespacedName, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimPrefix(uri.Path, "/"), "/")
+		if len(parts) != 4 || parts[0] != "ns" || parts[2] != "sa" || parts[1] == "" || parts[3] == "" {
+			continue
+		}
+
+		return ktypes.NamespacedName{Namespace: parts[1], Name: parts[3]}, true
+	}
+
+	return ktypes.NamespacedName{}, false
+}
+
+// scopeStreamInterceptor sets the scope of the clients to the namespace of the ServiceAccount they authenticated as.
+// Clients can't choose their scope: the scope they send is replaced, and removed if they did not authenticate.
+func scopeStreamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var scope string
+
+	if serviceAccount, ok := clientServiceAccount(stream.Context()); ok {
+		scope = serviceAccount.Namespace
+	}
+
+	return handler(srv, &scopedStream{ServerStream: stream, scope: scope})
+}
+
+// scopedStream sets the scope of the node of the requests it receives.
+type scopedStream struct {
+	grpc.ServerStream
+
+	scope string
+}
+
+func (s *scopedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	switch req := m.(type) {
+	case *discoveryv3.DiscoveryRequest:
+		setNodeScope(req.Node, s.scope)
+	case *discoveryv3.DeltaDiscoveryRequest:
+		setNodeScope(req.Node, s.scope)
+	}
+
+	return nil
+}
+
+// setNodeScope writes the scope in the node metadata, clients only send their node on the first request of a stream.
+func setNodeScope(node *core.Node, scope string) {
+	if node == nil {
+		return
+	}
+
+	if node.Metadata == nil {
+		node.Metadata = &structpb.Struct{}
+	}
+
+	if node.Metadata.Fields == nil {
+		node.Metadata.Fields = make(map[string]*structpb.Value)
+	}
+
+	if scope == "" {
+		delete(node.Metadata.Fields, ScopeMetadataKey)
+		return
+	}
+
+	node.Metadata.Fields[ScopeMetadataKey] = structpb.NewStringValue(scope)
+}
+
+// identifiedStream carries the context holding the identity of the client.
+type identifiedStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
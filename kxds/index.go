@@ -0,0 +1,120 @@
+package kxds
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+// referenceIndex tracks the kubernetes resources the XDSServices and XDSServers depend on.
+// It allows to skip the events of the endpoint slices and pods no XDSService or XDSServer cares about.
+type referenceIndex struct {
+	mu sync.RWMutex
+
+	// services holds the XDSServices referencing each kubernetes service.
+	services map[serviceReference][]types.NamespacedName
+	// serverSelectors holds the pod selectors of the XDSServers of each namespace.
+	serverSelectors map[string][]labels.Selector
+	// backingPods holds the pods backing the kubernetes services referenced by the XDSServices.
+	backingPods map[types.NamespacedName]struct{}
+}
+
+func newReferenceIndex() *referenceIndex {
+	return &referenceIndex{
+		services:        make(map[serviceReference][]types.NamespacedName),
+		serverSelectors: make(map[string][]labels.Selector),
+		backingPods:     make(map[types.NamespacedName]struct{}),
+	}
+}
+
+func (i *referenceIndex) update(services []kxdsv1alpha1.XDSService, servers []kxdsv1alpha1.XDSServer, endpointSlices map[types.NamespacedName][]discoveryv1.EndpointSlice) {
+	var (
+		refs        = make(map[serviceReference][]types.NamespacedName)
+		selectors   = make(map[string][]labels.Selector)
+		backingPods = make(map[types.NamespacedName]struct{})
+	)
+
+	for _, svc := range services {
+		svcName := types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}
+
+		for _, ref := range serviceReferences(svc) {
+			refs[ref] = append(refs[ref], svcName)
+
+			if ref.cluster != "" {
+				continue
+			}
+
+			for _, slice := range endpointSlices[ref.NamespacedName] {
+				for _, ep := range slice.Endpoints {
+					if pod, ok := lookupEndpointPod(slice.Namespace, ep); ok {
+						backingPods[pod] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	for _, srv := range servers {
+		selector, err := metav1.LabelSelectorAsSelector(&srv.Spec.PodSelector)
+		if err != nil {
+			// An invalid selector fails the translation of the server, its pods don't matter.
+			continue
+		}
+
+		selectors[srv.Namespace] = append(selectors[srv.Namespace], selector)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.services = refs
+	i.serverSelectors = selectors
+	i.backingPods = backingPods
+}
+
+// servicesReferencing returns the XDSServices referencing the kubernetes service owning the given endpoint slice.
+// The slice comes from the given remote cluster, or from the cluster of kxds if cluster is empty.
+func (i *referenceIndex) servicesReferencing(cluster string, slice *discoveryv1.EndpointSlice) []types.NamespacedName {
+	svcName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	if !ok {
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.services[serviceReference{
+		cluster:        cluster,
+		NamespacedName: types.NamespacedName{Name: svcName, Namespace: slice.Namespace},
+	}]
+}
+
+// selectsPod reports if the given pod is selected by an XDSServer.
+func (i *referenceIndex) selectsPod(pod *corev1.Pod) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, selector := range i.serverSelectors[pod.Namespace] {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backsService reports if the given pod backs a kubernetes service referenced by an XDSService.
+func (i *referenceIndex) backsService(pod *corev1.Pod) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	_, ok := i.backingPods[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+
+	return ok
+}
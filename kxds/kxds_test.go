@@ -2,19 +2,61 @@ package kxds_test
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	adminv3 "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	statusv3 "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcstatus "google.golang.org/grpc/status"
 	_ "google.golang.org/grpc/xds"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
 	"github.com/jlevesy/kxds/kxds"
+	echo "github.com/jlevesy/kxds/pkg/echoserver/proto"
 	"github.com/jlevesy/kxds/pkg/testruntime"
+	"github.com/jlevesy/kxds/pkg/xdscreds"
 )
 
 var (
@@ -22,6 +64,8 @@ var (
 		Name: "grpc",
 	}
 
+	serverLabels = map[string]string{"app": "server"}
+
 	v1v2ClusterTopology = testruntime.WithClusters(
 		testruntime.BuildCluster(
 			"v2",
@@ -59,6 +103,7 @@ func TestReconciller(t *testing.T) {
 	backends, err := testruntime.StartBackends(
 		testruntime.Config{
 			BackendCount: 10,
+			ORCA:         true,
 		},
 	)
 	require.NoError(t, err)
@@ -66,35 +111,42 @@ func TestReconciller(t *testing.T) {
 		_ = backends.Stop()
 	}()
 
-	var (
-		xdsCache = cache.NewSnapshotCache(
-			false,
-			kxds.DefaultHash,
-			testruntime.NoopCacheLogger{},
-		)
+	certs, err := testruntime.GenerateCertificates(testruntime.CertificatesDir)
+	require.NoError(t, err)
 
-		server = kxds.NewXDSServer(
-			xdsCache,
-			kxds.XDSServerConfig{BindAddr: ":18000"},
-		)
+	tlsBackends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 1,
+			TLS:          certs,
+		},
 	)
-
-	go func() {
-		err := server.Start(ctx)
-		require.NoError(t, err)
+	require.NoError(t, err)
+	defer func() {
+		_ = tlsBackends.Stop()
 	}()
 
+	xdsCache := cache.NewSnapshotCache(
+		false,
+		kxds.DefaultHash,
+		testruntime.NoopCacheLogger{},
+	)
+
+	defer startXDSServer(t, xdsCache)()
+
 	for _, testCase := range []struct {
 		desc             string
-		endpoints        []corev1.Endpoints
+		endpointSlices   [][]discoveryv1.EndpointSlice
+		nodes            []corev1.Node
+		dnsAddresses     map[string][]string
+		remoteClusters   map[string][]discoveryv1.EndpointSlice
 		xdsServices      []kxdsv1alpha1.XDSService
 		backendsBehavior func(t *testing.T, bs testruntime.Backends)
 		doAssert         func(t *testing.T)
 	}{
 		{
 			desc: "single call port by name",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -134,8 +186,8 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "single call port by number",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -176,9 +228,15 @@ func TestReconciller(t *testing.T) {
 			),
 		},
 		{
-			desc: "cross namespace",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "some-app", backends[0:1]),
+			desc: "not ready endpoints are unhealthy",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.WithEndpointConditions(
+					discoveryv1.EndpointConditions{
+						Ready: testruntime.Ptr(false),
+					},
+					testruntime.BuildEndpointSlices("test-service", "default", backends[1:2]),
+				),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -194,9 +252,8 @@ func TestReconciller(t *testing.T) {
 								testruntime.BuildLocality(
 									testruntime.WithK8sService(
 										kxdsv1alpha1.K8sService{
-											Name:      "test-service",
-											Namespace: "some-app",
-											Port:      grpcPort,
+											Name: "test-service",
+											Port: grpcPort,
 										},
 									),
 								),
@@ -206,22 +263,30 @@ func TestReconciller(t *testing.T) {
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.CallOnce(
+			doAssert: testruntime.CallN(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
 				),
+				100,
 				testruntime.NoCallErrors,
 				testruntime.AggregateByBackendID(
-					testruntime.AssertAggregatedValue("backend-0", 1),
+					testruntime.AssertAggregatedValue("backend-0", 100),
 				),
 			),
 		},
 		{
-			desc: "locality based wrr",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:2]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[2:4]),
+			desc: "terminating endpoints are drained",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.WithEndpointConditions(
+					discoveryv1.EndpointConditions{
+						Ready:       testruntime.Ptr(false),
+						Serving:     testruntime.Ptr(true),
+						Terminating: testruntime.Ptr(true),
+					},
+					testruntime.BuildEndpointSlices("test-service", "default", backends[1:2]),
+				),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -235,7 +300,6 @@ func TestReconciller(t *testing.T) {
 							"default",
 							testruntime.WithLocalities(
 								testruntime.BuildLocality(
-									testruntime.WithLocalityWeight(80),
 									testruntime.WithK8sService(
 										kxdsv1alpha1.K8sService{
 											Name: "test-service",
@@ -243,12 +307,46 @@ func TestReconciller(t *testing.T) {
 										},
 									),
 								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				100,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("backend-0", 100),
+				),
+			),
+		},
+		{
+			desc: "cross namespace",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "some-app", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
 								testruntime.BuildLocality(
-									testruntime.WithLocalityWeight(20),
 									testruntime.WithK8sService(
 										kxdsv1alpha1.K8sService{
-											Name: "test-service-v2",
-											Port: grpcPort,
+											Name:      "test-service",
+											Namespace: "some-app",
+											Port:      grpcPort,
 										},
 									),
 								),
@@ -258,29 +356,22 @@ func TestReconciller(t *testing.T) {
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.CallN(
+			doAssert: testruntime.CallOnce(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
 				),
-				10000,
 				testruntime.NoCallErrors,
 				testruntime.AggregateByBackendID(
-					// 80% of calls
-					testruntime.AssertAggregatedValueWithinDelta("backend-0", 4000, 500.0),
-					testruntime.AssertAggregatedValueWithinDelta("backend-1", 4000, 500.0),
-					// 20% of calls
-					testruntime.AssertAggregatedValueWithinDelta("backend-2", 1000, 500.0),
-					testruntime.AssertAggregatedValueWithinDelta("backend-3", 1000, 500.0),
+					testruntime.AssertAggregatedValue("backend-0", 1),
 				),
 			),
 		},
 		{
-			desc: "priority fallback",
-			endpoints: []corev1.Endpoints{
-				// No backends for the test-service in that case.
-				testruntime.BuildEndpoints("test-service", "default", backends[0:0]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "locality based wrr",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:2]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[2:4]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -294,7 +385,7 @@ func TestReconciller(t *testing.T) {
 							"default",
 							testruntime.WithLocalities(
 								testruntime.BuildLocality(
-									testruntime.WithLocalityPriority(0),
+									testruntime.WithLocalityWeight(80),
 									testruntime.WithK8sService(
 										kxdsv1alpha1.K8sService{
 											Name: "test-service",
@@ -303,7 +394,7 @@ func TestReconciller(t *testing.T) {
 									),
 								),
 								testruntime.BuildLocality(
-									testruntime.WithLocalityPriority(1),
+									testruntime.WithLocalityWeight(20),
 									testruntime.WithK8sService(
 										kxdsv1alpha1.K8sService{
 											Name: "test-service-v2",
@@ -317,203 +408,373 @@ func TestReconciller(t *testing.T) {
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.CallOnce(
+			doAssert: testruntime.CallN(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
 				),
+				10000,
 				testruntime.NoCallErrors,
 				testruntime.AggregateByBackendID(
-					// No calls for the first set of backends
-					testruntime.AssertAggregatedValue("backend-0", 0),
-					// One call for the second backend.
-					testruntime.AssertAggregatedValue("backend-1", 1),
+					// 80% of calls
+					testruntime.AssertAggregatedValueWithinDelta("backend-0", 4000, 500.0),
+					testruntime.AssertAggregatedValueWithinDelta("backend-1", 4000, 500.0),
+					// 20% of calls
+					testruntime.AssertAggregatedValueWithinDelta("backend-2", 1000, 500.0),
+					testruntime.AssertAggregatedValueWithinDelta("backend-3", 1000, 500.0),
 				),
 			),
 		},
 		{
-			desc: "exact path matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "locality split by zone",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.WithEndpointZone(
+					"zone-a",
+					testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				),
+				testruntime.WithEndpointNode(
+					"node-b",
+					testruntime.BuildEndpointSlices("test-service", "default", backends[1:4]),
+				),
+			},
+			nodes: []corev1.Node{
+				testruntime.BuildNode("node-b", "region-a", "zone-b"),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
 					testruntime.WithRoutes(
-						testruntime.BuildRoute(
-							testruntime.WithPathMatcher(
-								kxdsv1alpha1.PathMatcher{
-									Path: "/echo.Echo/EchoPremium",
-								},
-							),
-							testruntime.WithClusterRefs(
-								kxdsv1alpha1.ClusterRef{
-									Name:   "v2",
-									Weight: 1,
-								},
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithLocalitySplitByZone(),
+									testruntime.WithLocalityWeight(100),
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
 							),
 						),
-						testruntime.BuildSingleRoute("v1"),
 					),
-					v1v2ClusterTopology,
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.MultiAssert(
-				testruntime.CallOnce(
-					"xds:///default/test-xds",
-					testruntime.BuildCaller(
-						testruntime.MethodEchoPremium,
-					),
-					testruntime.NoCallErrors,
-					testruntime.AggregateByBackendID(
-						// One call for the second backend, because we're calling premium.
-						testruntime.AssertAggregatedValue("backend-1", 1),
-						testruntime.AssertAggregatedValue("backend-0", 0),
-					),
-				),
-				testruntime.CallOnce(
+			doAssert: func(t *testing.T) {
+				testruntime.CallN(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
 						testruntime.MethodEcho,
 					),
+					10000,
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
-						// No calls for the first set of backends
-						// First backend should get a call.
-						testruntime.AssertAggregatedValue("backend-0", 1),
-						testruntime.AssertAggregatedValue("backend-1", 0),
+						// Zones get a share of the weight in proportion to their endpoints, so all the backends get the same share of the calls.
+						testruntime.AssertAggregatedValueWithinDelta("backend-0", 2500, 500.0),
+						testruntime.AssertAggregatedValueWithinDelta("backend-1", 2500, 500.0),
+						testruntime.AssertAggregatedValueWithinDelta("backend-2", 2500, 500.0),
+						testruntime.AssertAggregatedValueWithinDelta("backend-3", 2500, 500.0),
 					),
-				),
-			),
+				)(t)
+
+				snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+				require.NoError(t, err)
+
+				loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+				require.True(t, ok)
+				require.Len(t, loadAssignment.Endpoints, 2)
+
+				assert.Equal(t, "zone-a", loadAssignment.Endpoints[0].Locality.Zone)
+				assert.Equal(t, uint32(25), loadAssignment.Endpoints[0].LoadBalancingWeight.GetValue())
+				assert.Equal(t, "zone-b", loadAssignment.Endpoints[1].Locality.Zone)
+				assert.Equal(t, uint32(75), loadAssignment.Endpoints[1].LoadBalancingWeight.GetValue())
+			},
 		},
 		{
-			desc: "prefix path matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "static endpoints",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
 					testruntime.WithRoutes(
-						testruntime.BuildRoute(
-							testruntime.WithPathMatcher(
-								kxdsv1alpha1.PathMatcher{
-									Prefix: "/echo.Echo/EchoP",
-								},
-							),
-							testruntime.WithClusterRefs(
-								kxdsv1alpha1.ClusterRef{
-									Name:   "v2",
-									Weight: 1,
-								},
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+								testruntime.BuildLocality(
+									testruntime.WithStaticEndpoints(
+										kxdsv1alpha1.StaticEndpoint{Address: backends[1].Addr(), Weight: 3},
+										kxdsv1alpha1.StaticEndpoint{Address: backends[2].Addr(), Weight: 1},
+									),
+								),
 							),
 						),
-						testruntime.BuildSingleRoute("v1"),
 					),
-					v1v2ClusterTopology,
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.MultiAssert(
-				testruntime.CallOnce(
-					"xds:///default/test-xds",
-					testruntime.BuildCaller(
-						testruntime.MethodEchoPremium,
-					),
-					testruntime.NoCallErrors,
-					testruntime.AggregateByBackendID(
-						// One call for the second backend, because we're calling premium.
-						testruntime.AssertAggregatedValue("backend-1", 1),
-						testruntime.AssertAggregatedValue("backend-0", 0),
-					),
-				),
-				testruntime.CallOnce(
+			doAssert: func(t *testing.T) {
+				testruntime.CallN(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
 						testruntime.MethodEcho,
 					),
+					10000,
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
-						// No calls for the first set of backends
-						// First backend should get a call.
-						testruntime.AssertAggregatedValue("backend-0", 1),
-						testruntime.AssertAggregatedValue("backend-1", 0),
+						// The service locality gets half of the calls.
+						testruntime.AssertAggregatedValueWithinDelta("backend-0", 5000, 500.0),
+						// gRPC round robin spreads the other half evenly, ignoring the endpoint weights.
+						testruntime.AssertAggregatedValueWithinDelta("backend-1", 2500, 500.0),
+						testruntime.AssertAggregatedValueWithinDelta("backend-2", 2500, 500.0),
 					),
-				),
-			),
+				)(t)
+
+				// The endpoint weights are published for the policies honoring them.
+				snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+				require.NoError(t, err)
+
+				loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+				require.True(t, ok)
+				require.Len(t, loadAssignment.Endpoints, 2)
+
+				staticLocality := loadAssignment.Endpoints[1]
+				assert.Equal(t, "static-1", staticLocality.Locality.SubZone)
+				require.Len(t, staticLocality.LbEndpoints, 2)
+				assert.Equal(t, uint32(3), staticLocality.LbEndpoints[0].LoadBalancingWeight.GetValue())
+				assert.Equal(t, uint32(1), staticLocality.LbEndpoints[1].LoadBalancingWeight.GetValue())
+			},
 		},
 		{
-			desc: "regexp path matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "dns endpoints",
+			dnsAddresses: map[string][]string{
+				"legacy.example.com": {"127.0.0.1"},
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
 					testruntime.WithRoutes(
-						testruntime.BuildRoute(
-							testruntime.WithPathMatcher(
-								kxdsv1alpha1.PathMatcher{
-									Prefix: "/echo.Echo/EchoP",
-									Regex: &kxdsv1alpha1.RegexMatcher{
-										Regex:  ".*/EchoPremium",
-										Engine: "re2",
-									},
-								},
-							),
-							testruntime.WithClusterRefs(
-								kxdsv1alpha1.ClusterRef{
-									Name:   "v2",
-									Weight: 1,
-								},
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithDNSEndpoints("legacy.example.com", uint32(backends[3].PortNumber())),
+								),
 							),
 						),
-						testruntime.BuildSingleRoute("v1"),
 					),
-					v1v2ClusterTopology,
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.MultiAssert(
-				testruntime.CallOnce(
-					"xds:///default/test-xds",
-					testruntime.BuildCaller(
-						testruntime.MethodEchoPremium,
-					),
-					testruntime.NoCallErrors,
-					testruntime.AggregateByBackendID(
-						// One call for the second backend, because we're calling premium.
-						testruntime.AssertAggregatedValue("backend-1", 1),
-						testruntime.AssertAggregatedValue("backend-0", 0),
-					),
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
 				),
-				testruntime.CallOnce(
-					"xds:///default/test-xds",
-					testruntime.BuildCaller(
-						testruntime.MethodEcho,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("backend-3", 1),
+				),
+			),
+		},
+		{
+			desc: "remote cluster",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			remoteClusters: map[string][]discoveryv1.EndpointSlice{
+				"west": testruntime.BuildEndpointSlices("test-service", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
 					),
-					testruntime.NoCallErrors,
-					testruntime.AggregateByBackendID(
-						// No calls for the first set of backends
-						// First backend should get a call.
-						testruntime.AssertAggregatedValue("backend-0", 1),
-						testruntime.AssertAggregatedValue("backend-1", 0),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name:    "test-service",
+											Port:    grpcPort,
+											Cluster: "west",
+										},
+									),
+								),
+							),
+						),
 					),
 				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				10000,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					// The local and the remote localities get half of the calls each.
+					testruntime.AssertAggregatedValueWithinDelta("backend-0", 5000, 500.0),
+					testruntime.AssertAggregatedValueWithinDelta("backend-1", 5000, 500.0),
+				),
 			),
 		},
 		{
-			desc: "case insensitive path matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "remote cluster fallback",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				// No backends for the local test-service in that case.
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:0]),
+			},
+			remoteClusters: map[string][]discoveryv1.EndpointSlice{
+				"west": testruntime.BuildEndpointSlices("test-service", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithLocalityPriority(0),
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+								testruntime.BuildLocality(
+									testruntime.WithLocalityPriority(1),
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name:    "test-service",
+											Port:    grpcPort,
+											Cluster: "west",
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				10,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("backend-1", 10),
+				),
+			),
+		},
+		{
+			desc: "priority fallback",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				// No backends for the test-service in that case.
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:0]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithLocalityPriority(0),
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+								testruntime.BuildLocality(
+									testruntime.WithLocalityPriority(1),
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service-v2",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					// No calls for the first set of backends
+					testruntime.AssertAggregatedValue("backend-0", 0),
+					// One call for the second backend.
+					testruntime.AssertAggregatedValue("backend-1", 1),
+				),
+			),
+		},
+		{
+			desc: "exact path matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -521,10 +782,9 @@ func TestReconciller(t *testing.T) {
 					"default",
 					testruntime.WithRoutes(
 						testruntime.BuildRoute(
-							testruntime.WithCaseSensitive(false),
 							testruntime.WithPathMatcher(
 								kxdsv1alpha1.PathMatcher{
-									Prefix: "/echo.echo/echop",
+									Path: "/echo.Echo/EchoPremium",
 								},
 							),
 							testruntime.WithClusterRefs(
@@ -569,10 +829,10 @@ func TestReconciller(t *testing.T) {
 			),
 		},
 		{
-			desc: "header invert matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "prefix path matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -580,13 +840,10 @@ func TestReconciller(t *testing.T) {
 					"default",
 					testruntime.WithRoutes(
 						testruntime.BuildRoute(
-							testruntime.WithHeaderMatchers(
-								testruntime.HeaderInvertMatch(
-									testruntime.HeaderExactMatch(
-										"x-variant",
-										"Awesome",
-									),
-								),
+							testruntime.WithPathMatcher(
+								kxdsv1alpha1.PathMatcher{
+									Prefix: "/echo.Echo/EchoP",
+								},
 							),
 							testruntime.WithClusterRefs(
 								kxdsv1alpha1.ClusterRef{
@@ -605,42 +862,35 @@ func TestReconciller(t *testing.T) {
 				testruntime.CallOnce(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
-						testruntime.MethodEcho,
-						testruntime.WithMetadata(
-							map[string]string{
-								"x-variant": "Awesome",
-							},
-						),
+						testruntime.MethodEchoPremium,
 					),
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
-						testruntime.AssertAggregatedValue("backend-1", 0),
-						testruntime.AssertAggregatedValue("backend-0", 1),
+						// One call for the second backend, because we're calling premium.
+						testruntime.AssertAggregatedValue("backend-1", 1),
+						testruntime.AssertAggregatedValue("backend-0", 0),
 					),
 				),
 				testruntime.CallOnce(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
 						testruntime.MethodEcho,
-						testruntime.WithMetadata(
-							map[string]string{
-								"x-variant": "NotAwesome",
-							},
-						),
 					),
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
-						testruntime.AssertAggregatedValue("backend-0", 0),
-						testruntime.AssertAggregatedValue("backend-1", 1),
+						// No calls for the first set of backends
+						// First backend should get a call.
+						testruntime.AssertAggregatedValue("backend-0", 1),
+						testruntime.AssertAggregatedValue("backend-1", 0),
 					),
 				),
 			),
 		},
 		{
-			desc: "header exact matching",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "regexp path matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -648,11 +898,14 @@ func TestReconciller(t *testing.T) {
 					"default",
 					testruntime.WithRoutes(
 						testruntime.BuildRoute(
-							testruntime.WithHeaderMatchers(
-								testruntime.HeaderExactMatch(
-									"x-variant",
-									"Awesome",
-								),
+							testruntime.WithPathMatcher(
+								kxdsv1alpha1.PathMatcher{
+									Prefix: "/echo.Echo/EchoP",
+									Regex: &kxdsv1alpha1.RegexMatcher{
+										Regex:  ".*/EchoPremium",
+										Engine: "re2",
+									},
+								},
 							),
 							testruntime.WithClusterRefs(
 								kxdsv1alpha1.ClusterRef{
@@ -671,13 +924,7 @@ func TestReconciller(t *testing.T) {
 				testruntime.CallOnce(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
-						testruntime.MethodEcho,
-						testruntime.WithMetadata(
-							map[string]string{
-								// Gotha, metadata keys are lowercased.
-								"x-variant": "Awesome",
-							},
-						),
+						testruntime.MethodEchoPremium,
 					),
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
@@ -702,10 +949,10 @@ func TestReconciller(t *testing.T) {
 			),
 		},
 		{
-			desc: "header safe regex match",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "case insensitive path matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -713,13 +960,10 @@ func TestReconciller(t *testing.T) {
 					"default",
 					testruntime.WithRoutes(
 						testruntime.BuildRoute(
-							testruntime.WithHeaderMatchers(
-								kxdsv1alpha1.HeaderMatcher{
-									Name: "x-variant",
-									Regex: &kxdsv1alpha1.RegexMatcher{
-										Regex:  "Awe.*",
-										Engine: "re2",
-									},
+							testruntime.WithCaseSensitive(false),
+							testruntime.WithPathMatcher(
+								kxdsv1alpha1.PathMatcher{
+									Prefix: "/echo.echo/echop",
 								},
 							),
 							testruntime.WithClusterRefs(
@@ -739,12 +983,7 @@ func TestReconciller(t *testing.T) {
 				testruntime.CallOnce(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
-						testruntime.MethodEcho,
-						testruntime.WithMetadata(
-							map[string]string{
-								"x-variant": "Awesome",
-							},
-						),
+						testruntime.MethodEchoPremium,
 					),
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
@@ -769,10 +1008,10 @@ func TestReconciller(t *testing.T) {
 			),
 		},
 		{
-			desc: "header range match",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			desc: "header invert matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -781,13 +1020,12 @@ func TestReconciller(t *testing.T) {
 					testruntime.WithRoutes(
 						testruntime.BuildRoute(
 							testruntime.WithHeaderMatchers(
-								kxdsv1alpha1.HeaderMatcher{
-									Name: "x-variant",
-									Range: &kxdsv1alpha1.RangeMatcher{
-										Start: 10,
-										End:   20,
-									},
-								},
+								testruntime.HeaderInvertMatch(
+									testruntime.HeaderExactMatch(
+										"x-variant",
+										"Awesome",
+									),
+								),
 							),
 							testruntime.WithClusterRefs(
 								kxdsv1alpha1.ClusterRef{
@@ -809,16 +1047,217 @@ func TestReconciller(t *testing.T) {
 						testruntime.MethodEcho,
 						testruntime.WithMetadata(
 							map[string]string{
-								// In range, call backend 1.
-								"x-variant": "12",
+								"x-variant": "Awesome",
 							},
 						),
 					),
 					testruntime.NoCallErrors,
 					testruntime.AggregateByBackendID(
-						testruntime.AssertAggregatedValue("backend-1", 1),
-						testruntime.AssertAggregatedValue("backend-0", 0),
-					),
+						testruntime.AssertAggregatedValue("backend-1", 0),
+						testruntime.AssertAggregatedValue("backend-0", 1),
+					),
+				),
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithMetadata(
+							map[string]string{
+								"x-variant": "NotAwesome",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						testruntime.AssertAggregatedValue("backend-0", 0),
+						testruntime.AssertAggregatedValue("backend-1", 1),
+					),
+				),
+			),
+		},
+		{
+			desc: "header exact matching",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildRoute(
+							testruntime.WithHeaderMatchers(
+								testruntime.HeaderExactMatch(
+									"x-variant",
+									"Awesome",
+								),
+							),
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "v2",
+									Weight: 1,
+								},
+							),
+						),
+						testruntime.BuildSingleRoute("v1"),
+					),
+					v1v2ClusterTopology,
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithMetadata(
+							map[string]string{
+								// Gotha, metadata keys are lowercased.
+								"x-variant": "Awesome",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						// One call for the second backend, because we're calling premium.
+						testruntime.AssertAggregatedValue("backend-1", 1),
+						testruntime.AssertAggregatedValue("backend-0", 0),
+					),
+				),
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						// No calls for the first set of backends
+						// First backend should get a call.
+						testruntime.AssertAggregatedValue("backend-0", 1),
+						testruntime.AssertAggregatedValue("backend-1", 0),
+					),
+				),
+			),
+		},
+		{
+			desc: "header safe regex match",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildRoute(
+							testruntime.WithHeaderMatchers(
+								kxdsv1alpha1.HeaderMatcher{
+									Name: "x-variant",
+									Regex: &kxdsv1alpha1.RegexMatcher{
+										Regex:  "Awe.*",
+										Engine: "re2",
+									},
+								},
+							),
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "v2",
+									Weight: 1,
+								},
+							),
+						),
+						testruntime.BuildSingleRoute("v1"),
+					),
+					v1v2ClusterTopology,
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithMetadata(
+							map[string]string{
+								"x-variant": "Awesome",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						// One call for the second backend, because we're calling premium.
+						testruntime.AssertAggregatedValue("backend-1", 1),
+						testruntime.AssertAggregatedValue("backend-0", 0),
+					),
+				),
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						// No calls for the first set of backends
+						// First backend should get a call.
+						testruntime.AssertAggregatedValue("backend-0", 1),
+						testruntime.AssertAggregatedValue("backend-1", 0),
+					),
+				),
+			),
+		},
+		{
+			desc: "header range match",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildRoute(
+							testruntime.WithHeaderMatchers(
+								kxdsv1alpha1.HeaderMatcher{
+									Name: "x-variant",
+									Range: &kxdsv1alpha1.RangeMatcher{
+										Start: 10,
+										End:   20,
+									},
+								},
+							),
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "v2",
+									Weight: 1,
+								},
+							),
+						),
+						testruntime.BuildSingleRoute("v1"),
+					),
+					v1v2ClusterTopology,
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithMetadata(
+							map[string]string{
+								// In range, call backend 1.
+								"x-variant": "12",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						testruntime.AssertAggregatedValue("backend-1", 1),
+						testruntime.AssertAggregatedValue("backend-0", 0),
+					),
 				),
 				testruntime.CallOnce(
 					"xds:///default/test-xds",
@@ -841,9 +1280,9 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "header present match",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -901,9 +1340,9 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "header prefix match",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -969,9 +1408,9 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "header suffix match",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -1037,9 +1476,9 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "runtime fraction traffic splitting",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
-				testruntime.BuildEndpoints("test-service-v2", "default", backends[1:2]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+				testruntime.BuildEndpointSlices("test-service-v2", "default", backends[1:2]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -1082,8 +1521,8 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "max stream duration",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -1122,8 +1561,8 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "max stream duration on route",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -1173,8 +1612,8 @@ func TestReconciller(t *testing.T) {
 		},
 		{
 			desc: "max requests on cluster",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
@@ -1218,33 +1657,42 @@ func TestReconciller(t *testing.T) {
 			),
 		},
 		{
-			desc: "fixed delay injection",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			desc: "ring hash on header",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:3]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
 					testruntime.WithRoutes(
-						testruntime.BuildSingleRoute("default"),
-					),
-					testruntime.WithFilters(
-						kxdsv1alpha1.Filter{
-							Fault: &kxdsv1alpha1.FaultFilter{
-								Delay: &kxdsv1alpha1.FaultDelay{
-									Fixed: testruntime.DurationPtr(500 * time.Millisecond),
-									Percentage: &kxdsv1alpha1.Fraction{
-										Numerator:   100,
-										Denominator: "hundred",
+						testruntime.BuildRoute(
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "default",
+									Weight: 1,
+								},
+							),
+							testruntime.WithHashPolicies(
+								kxdsv1alpha1.HashPolicy{
+									Header: &kxdsv1alpha1.HeaderHashPolicy{
+										Name: "x-user",
 									},
 								},
-							},
-						},
+							),
+						),
 					),
 					testruntime.WithClusters(
 						testruntime.BuildCluster(
 							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									RingHash: &kxdsv1alpha1.RingHashLBPolicy{
+										MinRingSize: testruntime.Ptr(uint64(1024)),
+										MaxRingSize: testruntime.Ptr(uint64(4096)),
+									},
+								},
+							),
 							testruntime.WithLocalities(
 								testruntime.BuildLocality(
 									testruntime.WithK8sService(
@@ -1260,45 +1708,58 @@ func TestReconciller(t *testing.T) {
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.ExceedDelay(
-				200*time.Millisecond,
-				testruntime.CallOnce(
-					"xds:///default/test-xds",
-					testruntime.BuildCaller(
-						testruntime.MethodEcho,
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+					testruntime.WithMetadata(
+						map[string]string{
+							"x-user": "obiwan",
+						},
 					),
-					testruntime.NoCallErrors,
+				),
+				100,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					// All calls sharing the same header value end up on the same backend.
+					testruntime.AssertAggregatedKeyCount(1),
 				),
 			),
 		},
 		{
-			desc: "header delay injection",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			desc: "ring hash on channel id",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:3]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
 					testruntime.WithRoutes(
-						testruntime.BuildSingleRoute("default"),
-					),
-					testruntime.WithFilters(
-						kxdsv1alpha1.Filter{
-							Fault: &kxdsv1alpha1.FaultFilter{
-								Delay: &kxdsv1alpha1.FaultDelay{
-									Header: &kxdsv1alpha1.HeaderFault{},
-									Percentage: &kxdsv1alpha1.Fraction{
-										Numerator:   100,
-										Denominator: "hundred",
+						testruntime.BuildRoute(
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "default",
+									Weight: 1,
+								},
+							),
+							testruntime.WithHashPolicies(
+								kxdsv1alpha1.HashPolicy{
+									FilterState: &kxdsv1alpha1.FilterStateHashPolicy{
+										Key: "io.grpc.channel_id",
 									},
 								},
-							},
-						},
+							),
+						),
 					),
 					testruntime.WithClusters(
 						testruntime.BuildCluster(
 							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									RingHash: &kxdsv1alpha1.RingHashLBPolicy{},
+								},
+							),
 							testruntime.WithLocalities(
 								testruntime.BuildLocality(
 									testruntime.WithK8sService(
@@ -1314,48 +1775,300 @@ func TestReconciller(t *testing.T) {
 				),
 			},
 			backendsBehavior: answer,
-			doAssert: testruntime.ExceedDelay(
-				200*time.Millisecond,
-				testruntime.CallOnce(
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				100,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					// All calls from the same channel end up on the same backend.
+					testruntime.AssertAggregatedKeyCount(1),
+				),
+			),
+		},
+		{
+			desc: "weighted round robin on reported utilization",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									WeightedRoundRobin: &kxdsv1alpha1.WeightedRoundRobinLBPolicy{
+										BlackoutPeriod:     &metav1.Duration{Duration: 100 * time.Millisecond},
+										WeightUpdatePeriod: &metav1.Duration{Duration: 100 * time.Millisecond},
+									},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: func(t *testing.T, bs testruntime.Backends) {
+				bs.SetBehavior(
+					testruntime.ORCABehavior(
+						map[string]float64{
+							"backend-0": 0.2,
+							"backend-1": 0.8,
+						},
+					),
+				)
+			},
+			doAssert: testruntime.CallN(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+					// Weights are used once the backends reported their load for the blackout period.
+					testruntime.WithWarmUp(time.Second),
+				),
+				10000,
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					// Weights are inversely proportional to the utilization: 1/0.2 and 1/0.8.
+					testruntime.AssertAggregatedValueWithinDelta("backend-0", 8000, 500.0),
+					testruntime.AssertAggregatedValueWithinDelta("backend-1", 2000, 500.0),
+				),
+			),
+		},
+		{
+			desc: "least request",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:2]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									LeastRequest: &kxdsv1alpha1.LeastRequestLBPolicy{
+										// Sampling all the backends keeps the slow one from being chosen alone.
+										ChoiceCount: testruntime.Ptr(uint32(10)),
+									},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: func(t *testing.T, bs testruntime.Backends) {
+				bs.SetBehavior(testruntime.DefaultBehavior())
+				bs[0].SetBehavior(testruntime.HangBehavior(20 * time.Millisecond))
+			},
+			doAssert: func(t *testing.T) {
+				// gRPC reads the variable when it is initialized, before any test runs: clients without it use round robin.
+				if os.Getenv("GRPC_EXPERIMENTAL_ENABLE_LEAST_REQUEST") != "true" {
+					t.Skip("GRPC_EXPERIMENTAL_ENABLE_LEAST_REQUEST must be true to assert least request")
+				}
+
+				testruntime.CallNConcurrently(
 					"xds:///default/test-xds",
 					testruntime.BuildCaller(
 						testruntime.MethodEcho,
-						testruntime.WithMetadata(
-							map[string]string{
-								// Delay by 500ms.
-								"x-envoy-fault-delay-request": "500",
-							},
-						),
 					),
+					1000,
+					4,
 					testruntime.NoCallErrors,
-				),
-			),
+					testruntime.AggregateByBackendID(
+						// The slow backend keeps outstanding requests, so most of the calls go to the other one.
+						testruntime.AssertAggregatedValueWithinDelta("backend-1", 875, 125.0),
+					),
+				)(t)
+			},
 		},
 		{
-			desc: "abort injection http",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			desc: "pick first",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:3]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									PickFirst: &kxdsv1alpha1.PickFirstLBPolicy{},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: func(t *testing.T) {
+				picked := make(map[string]int)
+
+				// Each call dials a new channel, which picks its own backend.
+				for i := 0; i < 10; i++ {
+					testruntime.CallN(
+						"xds:///default/test-xds",
+						testruntime.BuildCaller(
+							testruntime.MethodEcho,
+						),
+						100,
+						testruntime.NoCallErrors,
+						testruntime.AggregateByBackendID(
+							// All the calls of a channel end up on the same backend.
+							testruntime.AssertAggregatedKeyCount(1),
+							func(t *testing.T, aggs map[string]int) {
+								for backendID, count := range aggs {
+									picked[backendID] += count
+								}
+							},
+						),
+					)(t)
+				}
 
+				// Channels go through the endpoints in the same order, they all pick the same backend.
+				assert.Len(t, picked, 1)
+			},
+		},
+		{
+			desc: "pick first with shuffled addresses",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:3]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
 					testruntime.WithRoutes(
 						testruntime.BuildSingleRoute("default"),
 					),
-					testruntime.WithFilters(
-						kxdsv1alpha1.Filter{
-							Fault: &kxdsv1alpha1.FaultFilter{
-								Abort: &kxdsv1alpha1.FaultAbort{
-									HTTPStatus: testruntime.Ptr(uint32(404)),
-									Percentage: &kxdsv1alpha1.Fraction{
-										Numerator:   100,
-										Denominator: "hundred",
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLBPolicy(
+								kxdsv1alpha1.LBPolicy{
+									PickFirst: &kxdsv1alpha1.PickFirstLBPolicy{
+										ShuffleAddressList: true,
 									},
 								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: func(t *testing.T) {
+				picked := make(map[string]int)
+
+				// Each call dials a new channel, which picks its own backend.
+				for i := 0; i < 10; i++ {
+					testruntime.CallN(
+						"xds:///default/test-xds",
+						testruntime.BuildCaller(
+							testruntime.MethodEcho,
+						),
+						100,
+						testruntime.NoCallErrors,
+						testruntime.AggregateByBackendID(
+							// All the calls of a channel end up on the same backend.
+							testruntime.AssertAggregatedKeyCount(1),
+							func(t *testing.T, aggs map[string]int) {
+								for backendID, count := range aggs {
+									picked[backendID] += count
+								}
 							},
-						},
+						),
+					)(t)
+				}
+
+				// Channels shuffle the endpoints, they spread over the backends.
+				assert.Greater(t, len(picked), 1)
+			},
+		},
+		{
+			desc: "retry on route",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildRoute(
+							testruntime.WithClusterRefs(
+								kxdsv1alpha1.ClusterRef{
+									Name:   "default",
+									Weight: 1,
+								},
+							),
+							testruntime.WithRetryPolicy(
+								kxdsv1alpha1.RetryPolicy{
+									RetryOn:    []kxdsv1alpha1.RetryOn{"unavailable"},
+									NumRetries: testruntime.Ptr(uint32(2)),
+									BackOff: &kxdsv1alpha1.RetryBackOff{
+										BaseInterval: testruntime.DurationPtr(10 * time.Millisecond),
+										MaxInterval:  testruntime.DurationPtr(50 * time.Millisecond),
+									},
+								},
+							),
+						),
 					),
 					testruntime.WithClusters(
 						testruntime.BuildCluster(
@@ -1374,40 +2087,33 @@ func TestReconciller(t *testing.T) {
 					),
 				),
 			},
-			backendsBehavior: answer,
+			backendsBehavior: failing(2, codes.Unavailable),
 			doAssert: testruntime.CallOnce(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
 				),
-				testruntime.MustFail,
+				testruntime.NoCallErrors,
 			),
 		},
 		{
-			desc: "abort injection grpc",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			desc: "retry on service",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
+					testruntime.WithDefaultRetryPolicy(
+						kxdsv1alpha1.RetryPolicy{
+							RetryOn:    []kxdsv1alpha1.RetryOn{"unavailable"},
+							NumRetries: testruntime.Ptr(uint32(2)),
+						},
+					),
 					testruntime.WithRoutes(
 						testruntime.BuildSingleRoute("default"),
 					),
-					testruntime.WithFilters(
-						kxdsv1alpha1.Filter{
-							Fault: &kxdsv1alpha1.FaultFilter{
-								Abort: &kxdsv1alpha1.FaultAbort{
-									GRPCStatus: testruntime.Ptr(uint32(4)),
-									Percentage: &kxdsv1alpha1.Fraction{
-										Numerator:   100,
-										Denominator: "hundred",
-									},
-								},
-							},
-						},
-					),
 					testruntime.WithClusters(
 						testruntime.BuildCluster(
 							"default",
@@ -1425,40 +2131,33 @@ func TestReconciller(t *testing.T) {
 					),
 				),
 			},
-			backendsBehavior: answer,
+			backendsBehavior: failing(2, codes.Unavailable),
 			doAssert: testruntime.CallOnce(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
 				),
-				testruntime.MustFail,
+				testruntime.NoCallErrors,
 			),
 		},
 		{
-			desc: "abort header grpc",
-			endpoints: []corev1.Endpoints{
-				testruntime.BuildEndpoints("test-service", "default", backends[0:1]),
+			desc: "retry not matching status code",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
 			},
 			xdsServices: []kxdsv1alpha1.XDSService{
 				testruntime.BuildXDSService(
 					"test-xds",
 					"default",
+					testruntime.WithDefaultRetryPolicy(
+						kxdsv1alpha1.RetryPolicy{
+							RetryOn:    []kxdsv1alpha1.RetryOn{"unavailable"},
+							NumRetries: testruntime.Ptr(uint32(2)),
+						},
+					),
 					testruntime.WithRoutes(
 						testruntime.BuildSingleRoute("default"),
 					),
-					testruntime.WithFilters(
-						kxdsv1alpha1.Filter{
-							Fault: &kxdsv1alpha1.FaultFilter{
-								Abort: &kxdsv1alpha1.FaultAbort{
-									Header: &kxdsv1alpha1.HeaderFault{},
-									Percentage: &kxdsv1alpha1.Fraction{
-										Numerator:   100,
-										Denominator: "hundred",
-									},
-								},
-							},
-						},
-					),
 					testruntime.WithClusters(
 						testruntime.BuildCluster(
 							"default",
@@ -1476,50 +2175,4045 @@ func TestReconciller(t *testing.T) {
 					),
 				),
 			},
-			backendsBehavior: answer,
+			backendsBehavior: failing(2, codes.Internal),
 			doAssert: testruntime.CallOnce(
 				"xds:///default/test-xds",
 				testruntime.BuildCaller(
 					testruntime.MethodEcho,
-					testruntime.WithMetadata(
-						map[string]string{
-							"x-envoy-fault-abort-grpc-request": "3",
-						},
-					),
 				),
 				testruntime.MustFail,
 			),
 		},
-	} {
-		t.Run(testCase.desc, func(t *testing.T) {
-			var (
-				cl = fake.NewClientBuilder().WithLists(
-					&kxdsv1alpha1.XDSServiceList{Items: testCase.xdsServices},
-					&corev1.EndpointsList{Items: testCase.endpoints},
-				).Build()
-
-				cacheReconciller = kxds.NewReconciler(
-					cl,
-					kxds.NewCacheRefresher(
-						xdsCache,
-						kxds.DefautHashKey,
-					),
-				)
-			)
-
-			testCase.backendsBehavior(t, backends)
+		{
+			desc: "mtls exact san",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", tlsBackends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithTLS(
+								kxdsv1alpha1.ClusterTLS{
+									Certificate: &kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									CACertificate: kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									SubjectAltNames: []kxdsv1alpha1.StringMatcher{
+										{
+											Exact: testruntime.Ptr(testruntime.ServerDNSName),
+										},
+									},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("tls-backend-0", 1),
+				),
+			),
+		},
+		{
+			desc: "mtls uri san prefix",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", tlsBackends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithTLS(
+								kxdsv1alpha1.ClusterTLS{
+									Certificate: &kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									CACertificate: kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									SubjectAltNames: []kxdsv1alpha1.StringMatcher{
+										{
+											Prefix: testruntime.Ptr("spiffe://kxds.test/"),
+										},
+									},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("tls-backend-0", 1),
+				),
+			),
+		},
+		{
+			desc: "mtls san mismatch",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", tlsBackends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithTLS(
+								kxdsv1alpha1.ClusterTLS{
+									Certificate: &kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									CACertificate: kxdsv1alpha1.CertificateProviderInstance{
+										InstanceName: testruntime.CertificateProviderInstance,
+									},
+									SubjectAltNames: []kxdsv1alpha1.StringMatcher{
+										{
+											Exact: testruntime.Ptr("someone-else.kxds.test"),
+										},
+									},
+								},
+							),
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.MustFail,
+			),
+		},
+		{
+			desc: "fixed delay injection",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithFilters(
+						kxdsv1alpha1.Filter{
+							Fault: &kxdsv1alpha1.FaultFilter{
+								Delay: &kxdsv1alpha1.FaultDelay{
+									Fixed: testruntime.DurationPtr(500 * time.Millisecond),
+									Percentage: &kxdsv1alpha1.Fraction{
+										Numerator:   100,
+										Denominator: "hundred",
+									},
+								},
+							},
+						},
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.ExceedDelay(
+				200*time.Millisecond,
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+					),
+					testruntime.NoCallErrors,
+				),
+			),
+		},
+		{
+			desc: "header delay injection",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithFilters(
+						kxdsv1alpha1.Filter{
+							Fault: &kxdsv1alpha1.FaultFilter{
+								Delay: &kxdsv1alpha1.FaultDelay{
+									Header: &kxdsv1alpha1.HeaderFault{},
+									Percentage: &kxdsv1alpha1.Fraction{
+										Numerator:   100,
+										Denominator: "hundred",
+									},
+								},
+							},
+						},
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.ExceedDelay(
+				200*time.Millisecond,
+				testruntime.CallOnce(
+					"xds:///default/test-xds",
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithMetadata(
+							map[string]string{
+								// Delay by 500ms.
+								"x-envoy-fault-delay-request": "500",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+				),
+			),
+		},
+		{
+			desc: "abort injection http",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithFilters(
+						kxdsv1alpha1.Filter{
+							Fault: &kxdsv1alpha1.FaultFilter{
+								Abort: &kxdsv1alpha1.FaultAbort{
+									HTTPStatus: testruntime.Ptr(uint32(404)),
+									Percentage: &kxdsv1alpha1.Fraction{
+										Numerator:   100,
+										Denominator: "hundred",
+									},
+								},
+							},
+						},
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.MustFail,
+			),
+		},
+		{
+			desc: "abort injection grpc",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithFilters(
+						kxdsv1alpha1.Filter{
+							Fault: &kxdsv1alpha1.FaultFilter{
+								Abort: &kxdsv1alpha1.FaultAbort{
+									GRPCStatus: testruntime.Ptr(uint32(4)),
+									Percentage: &kxdsv1alpha1.Fraction{
+										Numerator:   100,
+										Denominator: "hundred",
+									},
+								},
+							},
+						},
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+				),
+				testruntime.MustFail,
+			),
+		},
+		{
+			desc: "abort header grpc",
+			endpointSlices: [][]discoveryv1.EndpointSlice{
+				testruntime.BuildEndpointSlices("test-service", "default", backends[0:1]),
+			},
+			xdsServices: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithFilters(
+						kxdsv1alpha1.Filter{
+							Fault: &kxdsv1alpha1.FaultFilter{
+								Abort: &kxdsv1alpha1.FaultAbort{
+									Header: &kxdsv1alpha1.HeaderFault{},
+									Percentage: &kxdsv1alpha1.Fraction{
+										Numerator:   100,
+										Denominator: "hundred",
+									},
+								},
+							},
+						},
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+			backendsBehavior: answer,
+			doAssert: testruntime.CallOnce(
+				"xds:///default/test-xds",
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+					testruntime.WithMetadata(
+						map[string]string{
+							"x-envoy-fault-abort-grpc-request": "3",
+						},
+					),
+				),
+				testruntime.MustFail,
+			),
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			var (
+				cl = fake.NewClientBuilder().WithLists(
+					&kxdsv1alpha1.XDSServiceList{Items: testCase.xdsServices},
+					&discoveryv1.EndpointSliceList{Items: testruntime.JoinEndpointSlices(testCase.endpointSlices...)},
+					&corev1.NodeList{Items: testCase.nodes},
+				).Build()
+
+				cacheReconciller = kxds.NewReconciler(
+					cl,
+					kxds.NewCacheRefresher(
+						xdsCache,
+						kxds.DefautHashKey,
+					),
+				)
+			)
+
+			cacheReconciller.SetLookupHost(staticLookupHost(testCase.dnsAddresses))
+
+			for name, slices := range testCase.remoteClusters {
+				cacheReconciller.SetRemoteCluster(
+					name,
+					nil,
+					fake.NewClientBuilder().WithLists(&discoveryv1.EndpointSliceList{Items: slices}).Build(),
+				)
+			}
+
+			testCase.backendsBehavior(t, backends)
+
+			// Flush snapshot state from previous iteration.
+			xdsCache.ClearSnapshot(kxds.DefautHashKey)
+
+			_, err := cacheReconciller.Reconcile(
+				ctx,
+				ctrl.Request{},
+			)
+			require.NoError(t, err)
+
+			testCase.doAssert(t)
+		})
+	}
+}
+
+func TestReconcillerStatus(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+
+		validSvc = testruntime.BuildXDSService(
+			"valid-xds",
+			"default",
+			testruntime.WithRoutes(
+				testruntime.BuildSingleRoute("default"),
+			),
+			testruntime.WithClusters(
+				testruntime.BuildCluster(
+					"default",
+					testruntime.WithLocalities(
+						testruntime.BuildLocality(
+							testruntime.WithK8sService(
+								kxdsv1alpha1.K8sService{
+									Name: "test-service",
+									Port: grpcPort,
+								},
+							),
+						),
+					),
+				),
+			),
+		)
+
+		brokenSvc = testruntime.BuildXDSService(
+			"broken-xds",
+			"default",
+			testruntime.WithRoutes(
+				testruntime.BuildSingleRoute("default"),
+			),
+			testruntime.WithClusters(
+				testruntime.BuildCluster(
+					"default",
+					testruntime.WithLocalities(
+						testruntime.BuildLocality(
+							testruntime.WithK8sService(
+								kxdsv1alpha1.K8sService{
+									Name: "missing-service",
+									Port: grpcPort,
+								},
+							),
+						),
+					),
+				),
+			),
+		)
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{validSvc, brokenSvc},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		).Build()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey))
+	)
+
+	_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	var gotValid kxdsv1alpha1.XDSService
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&validSvc), &gotValid))
+
+	assert.Equal(t, snapshotVersion(t, xdsCache), gotValid.Status.SnapshotVersion)
+	assert.Len(t, gotValid.Status.ServedVersions, 4)
+	for _, served := range gotValid.Status.ServedVersions {
+		assert.Empty(t, served.Scope)
+		assert.Equal(t, gotValid.Status.SnapshotVersion, served.Version)
+	}
+	assert.True(t, meta.IsStatusConditionTrue(gotValid.Status.Conditions, kxdsv1alpha1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionFalse(gotValid.Status.Conditions, kxdsv1alpha1.ConditionDegraded))
+
+	var gotBroken kxdsv1alpha1.XDSService
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&brokenSvc), &gotBroken))
+
+	assert.Empty(t, gotBroken.Status.SnapshotVersion)
+	assert.True(t, meta.IsStatusConditionFalse(gotBroken.Status.Conditions, kxdsv1alpha1.ConditionReady))
+
+	degraded := meta.FindStatusCondition(gotBroken.Status.Conditions, kxdsv1alpha1.ConditionDegraded)
+	require.NotNil(t, degraded)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Equal(t, kxdsv1alpha1.ReasonTranslationFailed, degraded.Reason)
+	assert.Equal(t, "no k8s endpoints found", degraded.Message)
+}
+
+func TestReconcillerFollower(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+
+		svc = testruntime.BuildXDSService(
+			"test-xds",
+			"default",
+			testruntime.WithRoutes(
+				testruntime.BuildSingleRoute("default"),
+			),
+			testruntime.WithClusters(
+				testruntime.BuildCluster(
+					"default",
+					testruntime.WithLocalities(
+						testruntime.BuildLocality(
+							testruntime.WithK8sService(
+								kxdsv1alpha1.K8sService{
+									Name: "test-service",
+									Port: grpcPort,
+								},
+							),
+						),
+					),
+				),
+			),
+		)
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{svc},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		).Build()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey))
+	)
+
+	cacheReconciller.SetFollower()
+
+	// Followers serve the snapshot, but leave the statuses to the elected replica.
+	_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, snapshotVersion(t, xdsCache))
+
+	var got kxdsv1alpha1.XDSService
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&svc), &got))
+	assert.Empty(t, got.Status.Conditions)
+
+	// Once elected, the statuses are written without waiting for a change.
+	kxds.BecomeLeader(cacheReconciller)
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&svc), &got))
+	assert.Equal(t, snapshotVersion(t, xdsCache), got.Status.SnapshotVersion)
+	assert.True(t, meta.IsStatusConditionTrue(got.Status.Conditions, kxdsv1alpha1.ConditionReady))
+}
+
+func TestReconcillerServedVersions(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+
+		buildService = func(name string, opts ...testruntime.XDSServiceOpt) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				append(
+					opts,
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithStaticEndpoints(
+										kxdsv1alpha1.StaticEndpoint{Address: "127.0.0.1:8080"},
+									),
+								),
+							),
+						),
+					),
+				)...,
+			)
+		}
+
+		publicSvc = buildService("public")
+		scopedSvc = buildService("team-a-only", testruntime.WithScopes("team-a"))
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{publicSvc, scopedSvc},
+			},
+		).Build()
+
+		xdsCache = kxds.NewScopedSnapshotCache(testruntime.NoopCacheLogger{})
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewScopedCacheRefresher(xdsCache, kxds.WithVersionPerType()))
+
+		servedVersions = func(t *testing.T, scopes ...string) []kxdsv1alpha1.ServedVersion {
+			t.Helper()
+
+			var versions []kxdsv1alpha1.ServedVersion
+
+			for _, scope := range scopes {
+				snapshot, err := xdsCache.GetSnapshot(kxds.ScopeHashKey(scope))
+				require.NoError(t, err)
+
+				for _, typ := range []string{resource.ClusterType, resource.RouteType, resource.ListenerType, resource.EndpointType} {
+					versions = append(versions, kxdsv1alpha1.ServedVersion{Scope: scope, Type: typ, Version: snapshot.GetVersion(typ)})
+				}
+			}
+
+			return versions
+		}
+	)
+
+	_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	// Services report the versions their clients are served, and no snapshot version as they differ.
+	var gotPublic kxdsv1alpha1.XDSService
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&publicSvc), &gotPublic))
+	assert.Equal(t, servedVersions(t, "", "team-a"), gotPublic.Status.ServedVersions)
+	assert.Empty(t, gotPublic.Status.SnapshotVersion)
+
+	var gotScoped kxdsv1alpha1.XDSService
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&scopedSvc), &gotScoped))
+	assert.Equal(t, servedVersions(t, "team-a"), gotScoped.Status.ServedVersions)
+	assert.Empty(t, gotScoped.Status.SnapshotVersion)
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 2,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx = context.Background()
+
+		buildService = func(name string) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("default"),
+				),
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: "test-service",
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			)
+		}
+
+		// Each refresh runs on its own refresher, like replicas or restarted controllers.
+		refresh = func(t *testing.T, services []kxdsv1alpha1.XDSService, backends testruntime.Backends) map[string]map[string]string {
+			t.Helper()
+
+			refresher := kxds.NewCacheRefresher(
+				cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{}),
+				kxds.DefautHashKey,
+			)
+
+			result, err := refresher.RefreshCache(
+				ctx,
+				kxds.K8sState{
+					Services: services,
+					EndpointSlices: map[ktypes.NamespacedName][]discoveryv1.EndpointSlice{
+						{Namespace: "default", Name: "test-service"}: testruntime.BuildEndpointSlices("test-service", "default", backends),
+					},
+				},
+			)
+			require.NoError(t, err)
+
+			return result.Versions
+		}
+
+		svcA = buildService("svc-a")
+		svcB = buildService("svc-b")
+
+		version = refresh(t, []kxdsv1alpha1.XDSService{svcA, svcB}, backends)
+	)
+
+	// The same state gives the same version, whatever the order of the kubernetes resources.
+	assert.Equal(t, version, refresh(t, []kxdsv1alpha1.XDSService{svcA, svcB}, backends))
+	assert.Equal(t, version, refresh(t, []kxdsv1alpha1.XDSService{svcB, svcA}, backends))
+	assert.Equal(t, version, refresh(t, []kxdsv1alpha1.XDSService{svcA, svcB}, testruntime.Backends{backends[1], backends[0]}))
+
+	assert.NotEqual(t, version, refresh(t, []kxdsv1alpha1.XDSService{svcA}, backends))
+	assert.NotEqual(t, version, refresh(t, []kxdsv1alpha1.XDSService{svcA, svcB}, backends[0:1]))
+}
+
+func TestRouteConfigDomains(t *testing.T) {
+	var (
+		ctx = context.Background()
+
+		snapshots = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+		refresher = kxds.NewCacheRefresher(snapshots, kxds.DefautHashKey)
+	)
+
+	_, err := refresher.RefreshCache(
+		ctx,
+		kxds.K8sState{
+			Services: []kxdsv1alpha1.XDSService{
+				testruntime.BuildXDSService(
+					"test-xds",
+					"default",
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithStaticEndpoints(
+										kxdsv1alpha1.StaticEndpoint{Address: "127.0.0.1:8080"},
+									),
+								),
+							),
+						),
+					),
+				),
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	snapshot, err := snapshots.GetSnapshot(kxds.DefautHashKey)
+	require.NoError(t, err)
+
+	routeConfig, ok := snapshot.GetResources(resource.RouteType)["kxds.test-xds.default.routeconfig"].(*route.RouteConfiguration)
+	require.True(t, ok)
+	require.Len(t, routeConfig.VirtualHosts, 1)
+
+	// Clients match either the target they dial or its escaped form, depending on their gRPC version.
+	assert.Equal(t, []string{"default/test-xds", "default%2Ftest-xds"}, routeConfig.VirtualHosts[0].Domains)
+}
+
+func TestSnapshotVersionPerType(t *testing.T) {
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 2,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx = context.Background()
+
+		xdsCache = &countingSnapshotCache{
+			SnapshotCache: cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{}),
+		}
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey, kxds.WithVersionPerType())
+
+		svc = testruntime.BuildXDSService(
+			"test-xds",
+			"default",
+			testruntime.WithRoutes(
+				testruntime.BuildSingleRoute("default"),
+			),
+			testruntime.WithClusters(
+				testruntime.BuildCluster(
+					"default",
+					testruntime.WithLocalities(
+						testruntime.BuildLocality(
+							testruntime.WithK8sService(
+								kxdsv1alpha1.K8sService{
+									Name: "test-service",
+									Port: grpcPort,
+								},
+							),
+						),
+					),
+				),
+			),
+		)
+
+		refresh = func(t *testing.T, backends testruntime.Backends) cache.ResourceSnapshot {
+			t.Helper()
+
+			_, err := refresher.RefreshCache(
+				ctx,
+				kxds.K8sState{
+					Services: []kxdsv1alpha1.XDSService{svc},
+					EndpointSlices: map[ktypes.NamespacedName][]discoveryv1.EndpointSlice{
+						{Namespace: "default", Name: "test-service"}: testruntime.BuildEndpointSlices("test-service", "default", backends),
+					},
+				},
+			)
+			require.NoError(t, err)
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			return snapshot
+		}
+	)
+
+	before := refresh(t, backends[0:1])
+	assert.Equal(t, 1, xdsCache.sets)
+
+	// Refreshing the same state publishes nothing.
+	refresh(t, backends[0:1])
+	assert.Equal(t, 1, xdsCache.sets)
+
+	// Only the version of the endpoints changes when endpoints change.
+	after := refresh(t, backends)
+	assert.Equal(t, 2, xdsCache.sets)
+
+	for _, typ := range []string{resource.ListenerType, resource.RouteType, resource.ClusterType} {
+		assert.Equal(t, before.GetVersion(typ), after.GetVersion(typ), typ)
+	}
+
+	assert.NotEqual(t, before.GetVersion(resource.EndpointType), after.GetVersion(resource.EndpointType))
+
+	// Refreshing the same endpoint slices listed in another order publishes nothing.
+	refresh(t, testruntime.Backends{backends[1], backends[0]})
+	assert.Equal(t, 2, xdsCache.sets)
+}
+
+func TestReconcillerBatching(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name: "test-service",
+												Port: grpcPort,
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+			&kxdsv1alpha1.XDSServerList{
+				Items: []kxdsv1alpha1.XDSServer{
+					testruntime.BuildXDSServer(
+						"test-server",
+						"default",
+						testruntime.WithPodSelector(map[string]string{"app": "echo"}),
+					),
+				},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		).Build()
+
+		refresher        = &countingRefresher{Refresher: kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey)}
+		cacheReconciller = kxds.NewReconciler(cl, refresher)
+
+		assertRefreshCount = func(t *testing.T, want int) {
+			t.Helper()
+
+			assert.Equal(t, want, refresher.count)
+		}
+
+		buildPod = func(namespace string, labels map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: namespace,
+					Labels:    labels,
+				},
+			}
+		}
+	)
+
+	// The first reconciliation always publishes a snapshot.
+	_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assertRefreshCount(t, 1)
+
+	// Nothing changed since.
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assertRefreshCount(t, 1)
+
+	// Events of resources nothing depends on are dropped.
+	unrelatedSlices := testruntime.BuildEndpointSlices("kube-dns", "kube-system", nil)
+	assert.Empty(t, kxds.MapEndpointSlice(cacheReconciller, &unrelatedSlices[0]))
+	assert.Empty(t, kxds.MapPod(cacheReconciller, buildPod("kube-system", map[string]string{"app": "echo"})))
+	assert.Empty(t, kxds.MapPod(cacheReconciller, buildPod("default", map[string]string{"app": "other"})))
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assertRefreshCount(t, 1)
+
+	// Events of the endpoints of a referenced service trigger a refresh.
+	slices := testruntime.BuildEndpointSlices("test-service", "default", nil)
+	assert.Len(t, kxds.MapEndpointSlice(cacheReconciller, &slices[0]), 1)
+	assert.Len(t, kxds.MapPod(cacheReconciller, buildPod("default", map[string]string{"app": "echo"})), 1)
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assertRefreshCount(t, 2)
+
+	// Refreshes are delayed until the minimum interval elapsed, batching all the events received meanwhile.
+	cacheReconciller.SetMinRefreshInterval(time.Hour)
+
+	first := kxds.RequestRefresh(cacheReconciller, nil)
+	second := kxds.RequestRefresh(cacheReconciller, nil)
+	assert.Equal(t, first, second)
+
+	res, err := cacheReconciller.Reconcile(ctx, first[0])
+	require.NoError(t, err)
+	assert.Greater(t, res.RequeueAfter, 59*time.Minute)
+	assertRefreshCount(t, 2)
+
+	cacheReconciller.SetMinRefreshInterval(0)
+
+	_, err = cacheReconciller.Reconcile(ctx, first[0])
+	require.NoError(t, err)
+	assertRefreshCount(t, 3)
+}
+
+func TestReconcillerDNSRefresh(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithDNSEndpoints("legacy.example.com", 8080),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+		).Build()
+
+		refresher        = &countingRefresher{Refresher: kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey)}
+		cacheReconciller = kxds.NewReconciler(cl, refresher)
+
+		addresses = map[string][]string{}
+
+		degradedCondition = func(t *testing.T) *metav1.Condition {
+			t.Helper()
+
+			var svc kxdsv1alpha1.XDSService
+
+			require.NoError(t, cl.Get(ctx, ktypes.NamespacedName{Name: "test-xds", Namespace: "default"}, &svc))
+
+			cond := meta.FindStatusCondition(svc.Status.Conditions, kxdsv1alpha1.ConditionDegraded)
+			require.NotNil(t, cond)
+
+			return cond
+		}
+
+		publishedAddresses = func(t *testing.T) []string {
+			t.Helper()
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+			require.True(t, ok)
+
+			var addrs []string
+
+			for _, locality := range loadAssignment.Endpoints {
+				for _, lbEndpoint := range locality.LbEndpoints {
+					addrs = append(addrs, lbEndpoint.GetEndpoint().GetAddress().GetSocketAddress().GetAddress())
+				}
+			}
+
+			return addrs
+		}
+	)
+
+	cacheReconciller.SetLookupHost(staticLookupHost(addresses))
+
+	// Unresolved hostnames are published without endpoints.
+	_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, refresher.count)
+	assert.Empty(t, publishedAddresses(t))
+
+	degraded := degradedCondition(t)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Contains(t, degraded.Message, `hostname "legacy.example.com" has not been resolved`)
+
+	addresses["legacy.example.com"] = []string{"10.0.0.2", "10.0.0.1"}
+	assert.True(t, kxds.RefreshDNS(cacheReconciller, ctx))
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, refresher.count)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, publishedAddresses(t))
+	assert.Equal(t, metav1.ConditionFalse, degradedCondition(t).Status)
+
+	// Same addresses in a different order, nothing to publish.
+	addresses["legacy.example.com"] = []string{"10.0.0.1", "10.0.0.2"}
+	assert.False(t, kxds.RefreshDNS(cacheReconciller, ctx))
+
+	// Failed resolutions keep the last known addresses.
+	delete(addresses, "legacy.example.com")
+	assert.False(t, kxds.RefreshDNS(cacheReconciller, ctx))
+
+	addresses["legacy.example.com"] = []string{"10.0.0.3"}
+	assert.True(t, kxds.RefreshDNS(cacheReconciller, ctx))
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, refresher.count)
+	assert.Equal(t, []string{"10.0.0.3"}, publishedAddresses(t))
+}
+
+func TestReconcillerRemoteClusters(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 1,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx = context.Background()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name:    "test-service",
+												Port:    grpcPort,
+												Cluster: "west",
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey))
+
+		condition = func(t *testing.T, conditionType string) *metav1.Condition {
+			t.Helper()
+
+			var svc kxdsv1alpha1.XDSService
+
+			require.NoError(t, cl.Get(ctx, ktypes.NamespacedName{Name: "test-xds", Namespace: "default"}, &svc))
+
+			cond := meta.FindStatusCondition(svc.Status.Conditions, conditionType)
+			require.NotNil(t, cond)
+
+			return cond
+		}
+
+		loadAssignment = func(t *testing.T) *endpoint.ClusterLoadAssignment {
+			t.Helper()
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+			require.True(t, ok)
+
+			return loadAssignment
+		}
+
+		slices = testruntime.BuildEndpointSlices("test-service", "default", backends)
+	)
+
+	// The remote cluster is not registered yet, its locality is published without endpoints.
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	assert.Equal(t, metav1.ConditionTrue, condition(t, kxdsv1alpha1.ConditionReady).Status)
+
+	degraded := condition(t, kxdsv1alpha1.ConditionDegraded)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Equal(t, kxdsv1alpha1.ReasonEndpointsUnavailable, degraded.Reason)
+	assert.Contains(t, degraded.Message, `remote cluster "west" is not available`)
+
+	require.Len(t, loadAssignment(t).Endpoints, 1)
+	assert.Equal(t, "west/test-service", loadAssignment(t).Endpoints[0].Locality.SubZone)
+	assert.Empty(t, loadAssignment(t).Endpoints[0].LbEndpoints)
+
+	cacheReconciller.SetRemoteCluster(
+		"west",
+		nil,
+		fake.NewClientBuilder().WithLists(&discoveryv1.EndpointSliceList{Items: slices}).Build(),
+	)
+
+	// Clusters becoming available trigger a refresh, and so do the endpoints of the referenced remote services.
+	assert.Len(t, kxds.MapRemoteEndpointSlice(cacheReconciller, "west", nil), 1)
+	assert.Len(t, kxds.MapRemoteEndpointSlice(cacheReconciller, "west", &slices[0]), 1)
+
+	// The same service in another cluster doesn't.
+	assert.Empty(t, kxds.MapRemoteEndpointSlice(cacheReconciller, "east", &slices[0]))
+	assert.Empty(t, kxds.MapEndpointSlice(cacheReconciller, &slices[0]))
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	assert.Equal(t, metav1.ConditionTrue, condition(t, kxdsv1alpha1.ConditionReady).Status)
+	assert.Equal(t, metav1.ConditionFalse, condition(t, kxdsv1alpha1.ConditionDegraded).Status)
+	assert.Len(t, loadAssignment(t).Endpoints[0].LbEndpoints, 1)
+}
+
+func TestReconcillerUnreachableRemoteCluster(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 1,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+
+		attempts int32
+		// The API server of the east cluster answers slowly, and fails.
+		eastAPIServer = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/api" {
+				atomic.AddInt32(&attempts, 1)
+			}
+
+			time.Sleep(time.Second)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name:    "test-service",
+												Port:    grpcPort,
+												Cluster: "west",
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+		).Build()
+
+		secrets = fake.NewClientBuilder().WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "west", Namespace: "kxds", Labels: map[string]string{kxds.RemoteClusterLabel: ""}},
+				Data:       map[string][]byte{kxds.RemoteClusterKubeconfigKey: []byte("west")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "east", Namespace: "kxds", Labels: map[string]string{kxds.RemoteClusterLabel: ""}},
+				Data: map[string][]byte{
+					kxds.RemoteClusterKubeconfigKey: []byte(fmt.Sprintf(
+						"apiVersion: v1\nkind: Config\nclusters:\n- name: east\n  cluster:\n    server: %s\ncontexts:\n- name: east\n  context:\n    cluster: east\ncurrent-context: east\n",
+						eastAPIServer.URL,
+					)),
+				},
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey))
+
+		reconcile = func(t *testing.T) {
+			t.Helper()
+
+			start := time.Now()
+
+			_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+			require.NoError(t, err)
+
+			// Connecting to the east cluster doesn't hold back the refreshes.
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+			require.True(t, ok)
+			require.Len(t, loadAssignment.Endpoints, 1)
+			assert.Len(t, loadAssignment.Endpoints[0].LbEndpoints, 1)
+		}
+	)
+
+	defer eastAPIServer.Close()
+	defer cancel()
+
+	cacheReconciller.StartRemoteClusters(
+		ctx,
+		secrets,
+		"kxds",
+		scheme.Scheme,
+		wait.Backoff{Duration: 200 * time.Millisecond, Factor: 2, Steps: 10, Cap: time.Second},
+	)
+	cacheReconciller.SetRemoteCluster(
+		"west",
+		[]byte("west"),
+		fake.NewClientBuilder().WithLists(
+			&discoveryv1.EndpointSliceList{Items: testruntime.BuildEndpointSlices("test-service", "default", backends)},
+		).Build(),
+	)
+
+	reconcile(t)
+
+	require.Eventually(
+		t,
+		func() bool { return atomic.LoadInt32(&attempts) == 1 },
+		time.Second,
+		10*time.Millisecond,
+	)
+
+	// Refreshes don't retry the connection, the backoff does.
+	for i := 0; i < 5; i++ {
+		kxds.RequestRefresh(cacheReconciller, nil)
+		reconcile(t)
+	}
+
+	assert.Never(
+		t,
+		func() bool { return atomic.LoadInt32(&attempts) > 1 },
+		500*time.Millisecond,
+		10*time.Millisecond,
+	)
+
+	require.Eventually(
+		t,
+		func() bool { return atomic.LoadInt32(&attempts) >= 2 },
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func TestCacheTransforms(t *testing.T) {
+	var (
+		transforms = kxds.CacheTransforms()
+
+		transformPod, transformNode func(interface{}) (interface{}, error)
+	)
+
+	for obj := range transforms {
+		switch obj.(type) {
+		case *corev1.Pod:
+			transformPod = transforms[obj]
+		case *corev1.Node:
+			transformNode = transforms[obj]
+		}
+	}
+
+	require.NotNil(t, transformPod)
+	require.NotNil(t, transformNode)
+
+	pod, err := transformPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "server",
+			Namespace:       "default",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"app": "server"},
+			Annotations: map[string]string{
+				kxds.EndpointWeightAnnotation:                      "3",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "server",
+					Image: "server:latest",
+					Env:   []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+					Ports: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 3333}},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  "10.0.0.1",
+			PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "server",
+				Namespace:       "default",
+				ResourceVersion: "42",
+				Labels:          map[string]string{"app": "server"},
+				Annotations:     map[string]string{kxds.EndpointWeightAnnotation: "3"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "server",
+						Ports: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 3333}},
+					},
+				},
+			},
+			Status: corev1.PodStatus{
+				PodIP:  "10.0.0.1",
+				PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}},
+			},
+		},
+		pod,
+	)
+
+	node, err := transformNode(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "node-a",
+			ResourceVersion: "12",
+			Labels: map[string]string{
+				corev1.LabelTopologyRegion: "eu-west-1",
+				corev1.LabelTopologyZone:   "eu-west-1a",
+				corev1.LabelHostname:       "node-a",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{{Names: []string{"server:latest"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "node-a",
+				ResourceVersion: "12",
+				Labels: map[string]string{
+					corev1.LabelTopologyRegion: "eu-west-1",
+					corev1.LabelTopologyZone:   "eu-west-1a",
+				},
+			},
+		},
+		node,
+	)
+}
+
+func TestEndpointWeights(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 2,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx = context.Background()
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		buildPod = func(name string, annotations map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   "default",
+					Annotations: annotations,
+				},
+			}
+		}
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name: "test-service",
+												Port: grpcPort,
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.JoinEndpointSlices(
+					testruntime.WithEndpointPod("pod-0", testruntime.BuildEndpointSlices("test-service", "default", backends[0:1])),
+					testruntime.WithEndpointPod("pod-1", testruntime.BuildEndpointSlices("test-service", "default", backends[1:2])),
+				),
+			},
+			&corev1.PodList{
+				Items: []corev1.Pod{
+					*buildPod("pod-0", map[string]string{kxds.EndpointWeightAnnotation: "3"}),
+					*buildPod("pod-1", nil),
+				},
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey))
+
+		// publishedWeights returns the weights of the published endpoints by port, zero if not set.
+		publishedWeights = func(t *testing.T) map[uint32]uint32 {
+			t.Helper()
+
+			_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+			require.NoError(t, err)
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			loadAssignment, ok := snapshot.GetResources(resource.EndpointType)["kxds.test-xds.default.default"].(*endpoint.ClusterLoadAssignment)
+			require.True(t, ok)
+
+			weights := make(map[uint32]uint32)
+
+			for _, locality := range loadAssignment.Endpoints {
+				for _, lbEndpoint := range locality.LbEndpoints {
+					port := lbEndpoint.GetEndpoint().GetAddress().GetSocketAddress().GetPortValue()
+					weights[port] = lbEndpoint.GetLoadBalancingWeight().GetValue()
+				}
+			}
+
+			return weights
+		}
+
+		setWeight = func(t *testing.T, podName, weight string) {
+			t.Helper()
+
+			var pod corev1.Pod
+
+			require.NoError(t, cl.Get(ctx, ktypes.NamespacedName{Name: podName, Namespace: "default"}, &pod))
+
+			pod.Annotations = map[string]string{kxds.EndpointWeightAnnotation: weight}
+			require.NoError(t, cl.Update(ctx, &pod))
+
+			// Annotation changes of the pods backing a service trigger a refresh.
+			assert.Len(t, kxds.MapBackingPod(cacheReconciller, &pod), 1)
+		}
+
+		port0 = uint32(backends[0].PortNumber())
+		port1 = uint32(backends[1].PortNumber())
+	)
+
+	// Pods without annotation keep the default weight.
+	assert.Equal(t, map[uint32]uint32{port0: 3, port1: 0}, publishedWeights(t))
+
+	// Other pods don't matter.
+	assert.Empty(t, kxds.MapBackingPod(cacheReconciller, buildPod("other", map[string]string{kxds.EndpointWeightAnnotation: "2"})))
+
+	setWeight(t, "pod-1", "2")
+	assert.Equal(t, map[uint32]uint32{port0: 3, port1: 2}, publishedWeights(t))
+
+	// Invalid weights are ignored.
+	setWeight(t, "pod-0", "heavy")
+	assert.Equal(t, map[uint32]uint32{port0: 0, port1: 2}, publishedWeights(t))
+}
+
+func TestRefresherTranslationCache(t *testing.T) {
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 2,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx = context.Background()
+
+		xdsCache  = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey)
+
+		buildService = func(name, k8sService string) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("default"),
+				),
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: k8sService,
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			)
+		}
+
+		refresh = func(t *testing.T, slicesA, slicesB []discoveryv1.EndpointSlice) map[string]types.Resource {
+			t.Helper()
+
+			_, err := refresher.RefreshCache(
+				ctx,
+				kxds.K8sState{
+					Services: []kxdsv1alpha1.XDSService{
+						buildService("svc-a", "test-service-a"),
+						buildService("svc-b", "test-service-b"),
+					},
+					EndpointSlices: map[ktypes.NamespacedName][]discoveryv1.EndpointSlice{
+						{Namespace: "default", Name: "test-service-a"}: slicesA,
+						{Namespace: "default", Name: "test-service-b"}: slicesB,
+					},
+				},
+			)
+			require.NoError(t, err)
+
+			snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+			require.NoError(t, err)
+
+			return snapshot.GetResources(resource.EndpointType)
+		}
+
+		slicesA = testruntime.BuildEndpointSlices("test-service-a", "default", backends)
+	)
+
+	before := refresh(t, slicesA, testruntime.BuildEndpointSlices("test-service-b", "default", backends[0:1]))
+	after := refresh(t, slicesA, testruntime.BuildEndpointSlices("test-service-b", "default", backends[1:2]))
+
+	// Only the service whose endpoints changed is translated again.
+	assert.Same(t, before["kxds.svc-a.default.default"], after["kxds.svc-a.default.default"])
+	assert.NotSame(t, before["kxds.svc-b.default.default"], after["kxds.svc-b.default.default"])
+
+	// Listing the same endpoint slices in another order doesn't translate the service again.
+	reordered := refresh(t, []discoveryv1.EndpointSlice{slicesA[1], slicesA[0]}, testruntime.BuildEndpointSlices("test-service-b", "default", backends))
+	assert.Same(t, after["kxds.svc-a.default.default"], reordered["kxds.svc-a.default.default"])
+	assert.NotSame(t, after["kxds.svc-b.default.default"], reordered["kxds.svc-b.default.default"])
+}
+
+func TestXDSServiceValidator(t *testing.T) {
+	var (
+		defaultLocality = testruntime.BuildLocality(
+			testruntime.WithK8sService(
+				kxdsv1alpha1.K8sService{
+					Name: "test-service",
+					Port: grpcPort,
+				},
+			),
+		)
+
+		buildService = func(opts ...testruntime.XDSServiceOpt) *kxdsv1alpha1.XDSService {
+			svc := testruntime.BuildXDSService(
+				"test-xds",
+				"default",
+				append(
+					[]testruntime.XDSServiceOpt{
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(defaultLocality),
+							),
+						),
+					},
+					opts...,
+				)...,
+			)
+
+			return &svc
+		}
+	)
+
+	testCases := []struct {
+		desc    string
+		svc     *kxdsv1alpha1.XDSService
+		wantErr string
+	}{
+		{
+			desc: "valid service",
+			svc:  buildService(),
+		},
+		{
+			desc: "valid service with priorities",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							defaultLocality,
+							testruntime.BuildLocality(
+								testruntime.WithLocalityPriority(1),
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name:      "fallback-service",
+										Namespace: "other",
+										Port:      grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			),
+		},
+		{
+			desc: "unknown cluster reference",
+			svc: buildService(
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("unknown"),
+				),
+			),
+			wantErr: `invalid xds service: route references unknown cluster "unknown"`,
+		},
+		{
+			desc: "blank regex",
+			svc: buildService(
+				testruntime.WithRoutes(
+					testruntime.BuildRoute(
+						testruntime.WithPathMatcher(
+							kxdsv1alpha1.PathMatcher{
+								Regex: &kxdsv1alpha1.RegexMatcher{Engine: "re2"},
+							},
+						),
+						testruntime.WithClusterRefs(kxdsv1alpha1.ClusterRef{Name: "default", Weight: 1}),
+					),
+				),
+			),
+			wantErr: "invalid xds service: blank regex",
+		},
+		{
+			desc: "header matcher without specifier",
+			svc: buildService(
+				testruntime.WithRoutes(
+					testruntime.BuildRoute(
+						testruntime.WithHeaderMatchers(kxdsv1alpha1.HeaderMatcher{Name: "x-variant"}),
+						testruntime.WithClusterRefs(kxdsv1alpha1.ClusterRef{Name: "default", Weight: 1}),
+					),
+				),
+			),
+			wantErr: "invalid xds service: invalid header matcher",
+		},
+		{
+			desc: "unknown fraction denominator",
+			svc: buildService(
+				testruntime.WithRoutes(
+					testruntime.BuildRoute(
+						testruntime.WithRuntimeFraction(kxdsv1alpha1.Fraction{Numerator: 1, Denominator: "thousand"}),
+						testruntime.WithClusterRefs(kxdsv1alpha1.ClusterRef{Name: "default", Weight: 1}),
+					),
+				),
+			),
+			wantErr: `invalid xds service: unsupported denominator "thousand" for runtime fraction`,
+		},
+		{
+			desc: "duplicate priorities",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(defaultLocality, defaultLocality),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": service "default/test-service" is referenced twice with priority 0`,
+		},
+		{
+			desc: "priority gap",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							defaultLocality,
+							testruntime.BuildLocality(
+								testruntime.WithLocalityPriority(2),
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: "fallback-service",
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": no locality has priority 1`,
+		},
+		{
+			desc: "static and dns localities",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithStaticEndpoints(
+									kxdsv1alpha1.StaticEndpoint{Address: "10.0.0.1:8080", Weight: 1},
+									kxdsv1alpha1.StaticEndpoint{Address: "[fd00::1]:8080", Weight: 2},
+								),
+							),
+							testruntime.BuildLocality(
+								testruntime.WithDNSEndpoints("legacy.example.com", 8080),
+							),
+						),
+					),
+				),
+			),
+		},
+		{
+			desc: "remote service",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							defaultLocality,
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name:    "test-service",
+										Port:    grpcPort,
+										Cluster: "west",
+									},
+								),
+							),
+						),
+					),
+				),
+			),
+		},
+		{
+			desc: "locality with multiple sources",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: "test-service",
+										Port: grpcPort,
+									},
+								),
+								testruntime.WithDNSEndpoints("legacy.example.com", 8080),
+							),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": a locality must have exactly one of service, static or dns`,
+		},
+		{
+			desc: "locality without source",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(testruntime.BuildLocality()),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": a locality must have exactly one of service, static or dns`,
+		},
+		{
+			desc: "static locality split by zone",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithLocalitySplitByZone(),
+								testruntime.WithStaticEndpoints(kxdsv1alpha1.StaticEndpoint{Address: "10.0.0.1:8080"}),
+							),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": only service localities can be split by zone`,
+		},
+		{
+			desc: "static endpoint hostname",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithStaticEndpoints(kxdsv1alpha1.StaticEndpoint{Address: "legacy.example.com:8080"}),
+							),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": invalid static endpoint "legacy.example.com:8080": address must be an IP`,
+		},
+		{
+			desc: "static endpoint invalid port",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithStaticEndpoints(kxdsv1alpha1.StaticEndpoint{Address: "10.0.0.1:http"}),
+							),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": invalid static endpoint "10.0.0.1:http": invalid port "http"`,
+		},
+		{
+			desc: "duplicate hostname priorities",
+			svc: buildService(
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(testruntime.WithDNSEndpoints("legacy.example.com", 8080)),
+							testruntime.BuildLocality(testruntime.WithDNSEndpoints("legacy.example.com", 9090)),
+						),
+					),
+				),
+			),
+			wantErr: `invalid xds service: could not build cluster "kxds.test-xds.default.default": hostname "legacy.example.com" is referenced twice with priority 0`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.desc, func(t *testing.T) {
+			var (
+				ctx       = context.Background()
+				validator = kxds.XDSServiceValidator{}
+			)
+
+			createErr := validator.ValidateCreate(ctx, testCase.svc)
+			updateErr := validator.ValidateUpdate(ctx, buildService(), testCase.svc)
+
+			if testCase.wantErr == "" {
+				assert.NoError(t, createErr)
+				assert.NoError(t, updateErr)
+				return
+			}
+
+			assert.EqualError(t, createErr, testCase.wantErr)
+			assert.EqualError(t, updateErr, testCase.wantErr)
+		})
+	}
+}
+
+func TestXDSServiceDefault(t *testing.T) {
+	svc := testruntime.BuildXDSService(
+		"test-xds",
+		"default",
+		testruntime.WithDefaultRetryPolicy(
+			kxdsv1alpha1.RetryPolicy{
+				RetryOn: []kxdsv1alpha1.RetryOn{"unavailable"},
+				BackOff: &kxdsv1alpha1.RetryBackOff{},
+			},
+		),
+		testruntime.WithFilters(
+			kxdsv1alpha1.Filter{
+				Fault: &kxdsv1alpha1.FaultFilter{
+					Abort: &kxdsv1alpha1.FaultAbort{
+						GRPCStatus: testruntime.Ptr[uint32](14),
+						Percentage: &kxdsv1alpha1.Fraction{Numerator: 10},
+					},
+					Headers: []kxdsv1alpha1.HeaderMatcher{
+						{Name: "x-fault", Regex: &kxdsv1alpha1.RegexMatcher{Regex: "on"}},
+					},
+				},
+			},
+		),
+		testruntime.WithRoutes(
+			kxdsv1alpha1.Route{
+				Headers: []kxdsv1alpha1.HeaderMatcher{
+					{Name: "x-variant", Regex: &kxdsv1alpha1.RegexMatcher{Regex: "a.*"}},
+				},
+				RuntimeFraction: &kxdsv1alpha1.Fraction{Numerator: 50},
+				HashPolicy: []kxdsv1alpha1.HashPolicy{
+					{FilterState: &kxdsv1alpha1.FilterStateHashPolicy{}},
+				},
+				RetryPolicy: &kxdsv1alpha1.RetryPolicy{
+					RetryOn: []kxdsv1alpha1.RetryOn{"cancelled"},
+				},
+				Clusters: []kxdsv1alpha1.ClusterRef{{Name: "default"}},
+			},
+		),
+		testruntime.WithClusters(
+			testruntime.BuildCluster(
+				"default",
+				testruntime.WithLocalities(
+					kxdsv1alpha1.Locality{
+						Service: &kxdsv1alpha1.K8sService{Name: "test-service", Port: grpcPort},
+					},
+					kxdsv1alpha1.Locality{
+						Static: []kxdsv1alpha1.StaticEndpoint{{Address: "10.0.0.1:8080"}},
+					},
+				),
+			),
+		),
+	)
+
+	svc.Default()
+
+	assert.Equal(t, testruntime.Ptr[uint32](1), svc.Spec.RetryPolicy.NumRetries)
+	assert.Equal(t, &metav1.Duration{Duration: 25 * time.Millisecond}, svc.Spec.RetryPolicy.BackOff.BaseInterval)
+
+	fault := svc.Spec.Filters[0].Fault
+	assert.Equal(t, "hundred", fault.Abort.Percentage.Denominator)
+	assert.Equal(t, "re2", fault.Headers[0].Regex.Engine)
+
+	route := svc.Spec.Routes[0]
+	assert.Equal(t, "/", route.Path.Prefix)
+	assert.Equal(t, "re2", route.Headers[0].Regex.Engine)
+	assert.Equal(t, "hundred", route.RuntimeFraction.Denominator)
+	assert.Equal(t, "io.grpc.channel_id", route.HashPolicy[0].FilterState.Key)
+	assert.Equal(t, testruntime.Ptr[uint32](1), route.RetryPolicy.NumRetries)
+	assert.Equal(t, uint32(1), route.Clusters[0].Weight)
+
+	assert.Equal(t, uint32(1), svc.Spec.Clusters[0].Localities[0].Weight)
+	assert.Equal(t, uint32(1), svc.Spec.Clusters[0].Localities[1].Weight)
+	assert.Equal(t, uint32(1), svc.Spec.Clusters[0].Localities[1].Static[0].Weight)
+
+	// Once defaulted, the service is accepted.
+	assert.NoError(t, kxds.XDSServiceValidator{}.ValidateCreate(context.Background(), &svc))
+}
+
+// TestXDSServer runs apart from TestReconciller, as the xDS enabled servers keep the process wide xDS client stream open
+// as long as they're running.
+func TestXDSServer(t *testing.T) {
+	ctx := context.Background()
+
+	certs, err := testruntime.GenerateCertificates(testruntime.CertificatesDir)
+	require.NoError(t, err)
+
+	xdsBackends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 6,
+			XDS:          true,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = xdsBackends.Stop()
+	}()
+
+	var (
+		xdsCache = cache.NewSnapshotCache(
+			false,
+			kxds.DefaultHash,
+			testruntime.NoopCacheLogger{},
+		)
+
+		// The xDS servers keep watching their listeners between test cases. Every test case
+		// publishes a new snapshot version, instead of clearing the snapshot which drops the watches.
+		refresher = kxds.NewCacheRefresher(
+			xdsCache,
+			kxds.DefautHashKey,
+		)
+	)
+
+	defer startXDSServer(t, xdsCache)()
+
+	for _, testCase := range []struct {
+		desc       string
+		pods       []corev1.Pod
+		xdsServers []kxdsv1alpha1.XDSServer
+		doAssert   func(t *testing.T)
+	}{
+		{
+			desc: "xds server plaintext",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-0", "default", serverLabels, xdsBackends[0]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+				),
+			},
+			doAssert: testruntime.CallOnce(
+				xdsBackends[0].Addr(),
+				testruntime.BuildCaller(
+					testruntime.MethodEcho,
+					testruntime.WithWaitForReady(10*time.Second),
+				),
+				testruntime.NoCallErrors,
+				testruntime.AggregateByBackendID(
+					testruntime.AssertAggregatedValue("xds-backend-0", 1),
+				),
+			),
+		},
+		{
+			desc: "xds server routes",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-1", "default", serverLabels, xdsBackends[1]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+					testruntime.WithServerRoutes(
+						kxdsv1alpha1.ServerRoute{
+							Path: kxdsv1alpha1.PathMatcher{
+								Path: "/echo.Echo/Echo",
+							},
+							CaseSensitive: true,
+						},
+					),
+				),
+			},
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					xdsBackends[1].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithWaitForReady(10*time.Second),
+					),
+					testruntime.NoCallErrors,
+				),
+				testruntime.CallOnce(
+					xdsBackends[1].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEchoPremium,
+					),
+					testruntime.MustFail,
+				),
+			),
+		},
+		{
+			desc: "xds server mtls",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-2", "default", serverLabels, xdsBackends[2]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+					testruntime.WithServerTLS(
+						kxdsv1alpha1.ServerTLS{
+							Certificate: kxdsv1alpha1.CertificateProviderInstance{
+								InstanceName: testruntime.ServerCertificateProviderInstance,
+							},
+							CACertificate: &kxdsv1alpha1.CertificateProviderInstance{
+								InstanceName: testruntime.CertificateProviderInstance,
+							},
+							RequireClientCertificate: true,
+						},
+					),
+				),
+			},
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					xdsBackends[2].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithTransportCredentials(credentials.NewTLS(certs.ClientTLSConfig())),
+						testruntime.WithWaitForReady(10*time.Second),
+					),
+					testruntime.NoCallErrors,
+					testruntime.AggregateByBackendID(
+						testruntime.AssertAggregatedValue("xds-backend-2", 1),
+					),
+				),
+				testruntime.CallOnce(
+					xdsBackends[2].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithTransportCredentials(
+							credentials.NewTLS(
+								&tls.Config{
+									RootCAs:    certs.CAPool,
+									ServerName: testruntime.ServerDNSName,
+									MinVersion: tls.VersionTLS12,
+								},
+							),
+						),
+					),
+					testruntime.MustFail,
+				),
+			),
+		},
+		{
+			desc: "xds server rbac on path",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-3", "default", serverLabels, xdsBackends[3]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+					testruntime.WithServerFilters(
+						kxdsv1alpha1.Filter{
+							RBAC: &kxdsv1alpha1.RBACFilter{
+								Action: "allow",
+								Policies: []kxdsv1alpha1.RBACPolicy{
+									{
+										Name: "echo-only",
+										Permissions: []kxdsv1alpha1.RBACPermission{
+											{
+												Path: &kxdsv1alpha1.PathMatcher{
+													Path: "/echo.Echo/Echo",
+												},
+											},
+										},
+										Principals: []kxdsv1alpha1.RBACPrincipal{
+											{
+												Any: true,
+											},
+										},
+									},
+								},
+							},
+						},
+					),
+				),
+			},
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					xdsBackends[3].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithWaitForReady(10*time.Second),
+					),
+					testruntime.NoCallErrors,
+				),
+				testruntime.CallOnce(
+					xdsBackends[3].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEchoPremium,
+					),
+					testruntime.MustFailWithCode(codes.PermissionDenied),
+				),
+			),
+		},
+		{
+			desc: "xds server rbac on authenticated principal",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-4", "default", serverLabels, xdsBackends[4]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+					testruntime.WithServerTLS(
+						kxdsv1alpha1.ServerTLS{
+							Certificate: kxdsv1alpha1.CertificateProviderInstance{
+								InstanceName: testruntime.ServerCertificateProviderInstance,
+							},
+							CACertificate: &kxdsv1alpha1.CertificateProviderInstance{
+								InstanceName: testruntime.CertificateProviderInstance,
+							},
+							RequireClientCertificate: true,
+						},
+					),
+					testruntime.WithServerFilters(
+						kxdsv1alpha1.Filter{
+							RBAC: &kxdsv1alpha1.RBACFilter{
+								Action: "allow",
+								Policies: []kxdsv1alpha1.RBACPolicy{
+									{
+										Name: "client-echo",
+										Permissions: []kxdsv1alpha1.RBACPermission{
+											{
+												Path: &kxdsv1alpha1.PathMatcher{
+													Path: "/echo.Echo/Echo",
+												},
+											},
+										},
+										Principals: []kxdsv1alpha1.RBACPrincipal{
+											{
+												Authenticated: &kxdsv1alpha1.StringMatcher{
+													Exact: testruntime.Ptr(testruntime.ClientURI),
+												},
+											},
+										},
+									},
+									{
+										Name: "other-premium",
+										Permissions: []kxdsv1alpha1.RBACPermission{
+											{
+												Path: &kxdsv1alpha1.PathMatcher{
+													Path: "/echo.Echo/EchoPremium",
+												},
+											},
+										},
+										Principals: []kxdsv1alpha1.RBACPrincipal{
+											{
+												Authenticated: &kxdsv1alpha1.StringMatcher{
+													Exact: testruntime.Ptr("spiffe://kxds.test/ns/default/sa/other"),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					),
+				),
+			},
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					xdsBackends[4].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithTransportCredentials(credentials.NewTLS(certs.ClientTLSConfig())),
+						testruntime.WithWaitForReady(10*time.Second),
+					),
+					testruntime.NoCallErrors,
+				),
+				testruntime.CallOnce(
+					xdsBackends[4].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEchoPremium,
+						testruntime.WithTransportCredentials(credentials.NewTLS(certs.ClientTLSConfig())),
+					),
+					testruntime.MustFailWithCode(codes.PermissionDenied),
+				),
+			),
+		},
+		{
+			desc: "xds server rbac route override",
+			pods: []corev1.Pod{
+				testruntime.BuildPod("server-5", "default", serverLabels, xdsBackends[5]),
+			},
+			xdsServers: []kxdsv1alpha1.XDSServer{
+				testruntime.BuildXDSServer(
+					"test-server",
+					"default",
+					testruntime.WithPodSelector(serverLabels),
+					testruntime.WithServerPort(grpcPort),
+					testruntime.WithServerFilters(
+						kxdsv1alpha1.Filter{
+							// Denying nothing allows all calls.
+							RBAC: &kxdsv1alpha1.RBACFilter{
+								Action: "deny",
+							},
+						},
+					),
+					testruntime.WithServerRoutes(
+						kxdsv1alpha1.ServerRoute{
+							Path: kxdsv1alpha1.PathMatcher{
+								Path: "/echo.Echo/EchoPremium",
+							},
+							CaseSensitive: true,
+							RBAC: &kxdsv1alpha1.RBACFilter{
+								Action: "allow",
+								Policies: []kxdsv1alpha1.RBACPolicy{
+									{
+										Name: "premium-header",
+										Permissions: []kxdsv1alpha1.RBACPermission{
+											{
+												Any: true,
+											},
+										},
+										Principals: []kxdsv1alpha1.RBACPrincipal{
+											{
+												Header: testruntime.Ptr(
+													testruntime.HeaderExactMatch("x-variant", "premium"),
+												),
+											},
+										},
+									},
+								},
+							},
+						},
+						kxdsv1alpha1.ServerRoute{
+							Path: kxdsv1alpha1.PathMatcher{
+								Prefix: "/",
+							},
+							CaseSensitive: true,
+						},
+					),
+				),
+			},
+			doAssert: testruntime.MultiAssert(
+				testruntime.CallOnce(
+					xdsBackends[5].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEcho,
+						testruntime.WithWaitForReady(10*time.Second),
+					),
+					testruntime.NoCallErrors,
+				),
+				testruntime.CallOnce(
+					xdsBackends[5].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEchoPremium,
+					),
+					testruntime.MustFailWithCode(codes.PermissionDenied),
+				),
+				testruntime.CallOnce(
+					xdsBackends[5].Addr(),
+					testruntime.BuildCaller(
+						testruntime.MethodEchoPremium,
+						testruntime.WithMetadata(
+							map[string]string{
+								"x-variant": "premium",
+							},
+						),
+					),
+					testruntime.NoCallErrors,
+				),
+			),
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			var (
+				cl = fake.NewClientBuilder().WithLists(
+					&kxdsv1alpha1.XDSServerList{Items: testCase.xdsServers},
+					&corev1.PodList{Items: testCase.pods},
+				).Build()
+
+				cacheReconciller = kxds.NewReconciler(cl, refresher)
+			)
+
+			_, err := cacheReconciller.Reconcile(
+				ctx,
+				ctrl.Request{},
+			)
+			require.NoError(t, err)
+
+			testCase.doAssert(t)
+		})
+	}
+}
+
+func TestClientStatusDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 1,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	xdsCache := cache.NewSnapshotCache(
+		false,
+		kxds.DefaultHash,
+		testruntime.NoopCacheLogger{},
+	)
+
+	defer startXDSServer(t, xdsCache)()
+
+	var (
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name: "test-service",
+												Port: grpcPort,
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", backends),
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(
+			cl,
+			kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey),
+		)
+	)
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	conn, err := grpc.Dial("xds:///default/test-xds", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = echo.NewEchoClient(conn).Echo(ctx, &echo.EchoRequest{Payload: "Hello There!"})
+	require.NoError(t, err)
+
+	csdsConn, err := grpc.Dial("localhost:18000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer csdsConn.Close()
+
+	csdsClient := statusv3.NewClientStatusDiscoveryServiceClient(csdsConn)
+
+	resp, err := csdsClient.FetchClientStatus(ctx, &statusv3.ClientStatusRequest{})
+	require.NoError(t, err)
+
+	publishedVersion := snapshotVersion(t, xdsCache)
+
+	listenerStatus := findGenericXDSConfig(resp, resource.ListenerType, "default/test-xds")
+	require.NotNil(t, listenerStatus)
+	assert.Equal(t, publishedVersion, listenerStatus.VersionInfo)
+	assert.Equal(t, adminv3.ClientResourceStatus_ACKED, listenerStatus.ClientStatus)
+	assert.Equal(t, "test-id", resp.Config[0].Node.GetId())
+
+	// Publish a listener that does not configure an HTTP connection manager, the client must reject it.
+	snapshot, err := cache.NewSnapshot(
+		"broken",
+		map[resource.Type][]types.Resource{
+			resource.ListenerType: {
+				&listener.Listener{
+					Name: "default/test-xds",
+					ApiListener: &listener.ApiListener{
+						ApiListener: mustAny(t, &route.RouteConfiguration{Name: "not-a-connection-manager"}),
+					},
+				},
+			},
+		},
+	)
+	require.NoError(t, err)
+	require.NoError(t, xdsCache.SetSnapshot(ctx, kxds.DefautHashKey, snapshot))
+
+	require.Eventually(
+		t,
+		func() bool {
+			resp, err := csdsClient.FetchClientStatus(ctx, &statusv3.ClientStatusRequest{})
+			require.NoError(t, err)
+
+			listenerStatus = findGenericXDSConfig(resp, resource.ListenerType, "default/test-xds")
+
+			return listenerStatus != nil && listenerStatus.ClientStatus == adminv3.ClientResourceStatus_NACKED
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	// The client keeps using the last ACKed version.
+	assert.Equal(t, publishedVersion, listenerStatus.VersionInfo)
+	require.NotNil(t, listenerStatus.ErrorState)
+	assert.Equal(t, "broken", listenerStatus.ErrorState.VersionInfo)
+	assert.NotEmpty(t, listenerStatus.ErrorState.Details)
+
+	// Node matchers filter the reported clients.
+	resp, err = csdsClient.FetchClientStatus(
+		ctx,
+		&statusv3.ClientStatusRequest{
+			NodeMatchers: []*matcher.NodeMatcher{
+				{
+					NodeId: &matcher.StringMatcher{
+						MatchPattern: &matcher.StringMatcher_Exact{Exact: "another-id"},
+					},
+				},
+			},
+		},
+	)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Config)
+}
+
+func TestLoadReporting(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	ctx := context.Background()
+
+	backends, err := testruntime.StartBackends(
+		testruntime.Config{
+			BackendCount: 1,
+		},
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	backends.SetBehavior(testruntime.DefaultBehavior())
+
+	var (
+		xdsCache = cache.NewSnapshotCache(
+			false,
+			kxds.DefaultHash,
+			testruntime.NoopCacheLogger{},
+		)
+
+		loadReporting = kxds.NewLoadReportingServer(100 * time.Millisecond)
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					testruntime.BuildXDSService(
+						"test-xds",
+						"default",
+						testruntime.WithRoutes(
+							testruntime.BuildSingleRoute("default"),
+						),
+						testruntime.WithClusters(
+							testruntime.BuildCluster(
+								"default",
+								testruntime.WithLoadReporting(),
+								testruntime.WithLocalities(
+									testruntime.BuildLocality(
+										testruntime.WithK8sService(
+											kxdsv1alpha1.K8sService{
+												Name: "test-service",
+												Port: grpcPort,
+											},
+										),
+									),
+								),
+							),
+						),
+					),
+				},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", backends),
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(
+			cl,
+			kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey),
+		)
+
+		wantSucceeded = `
+# HELP kxds_lrs_requests_succeeded_total Total number of requests successfully completed by the clients, by cluster and locality.
+# TYPE kxds_lrs_requests_succeeded_total counter
+kxds_lrs_requests_succeeded_total{cluster="kxds.test-xds.default.default",region="",sub_zone="test-service",zone=""} 10
+`
+	)
+
+	defer startXDSServerWithConfig(t, xdsCache, kxds.XDSServerConfig{LoadReporting: loadReporting})()
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	// Clients stop reporting their load once the channel is closed, keep it open until the load is reported.
+	conn, err := grpc.Dial("xds:///default/test-xds", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err = echo.NewEchoClient(conn).Echo(ctx, &echo.EchoRequest{Payload: "Hello There!"})
+		require.NoError(t, err)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(loadReporting))
+
+	require.Eventually(
+		t,
+		func() bool {
+			err := promtestutil.GatherAndCompare(
+				registry,
+				strings.NewReader(wantSucceeded),
+				"kxds_lrs_requests_succeeded_total",
+			)
+
+			return err == nil
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func TestServerMetrics(t *testing.T) {
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+
+		xdsCache = cache.NewSnapshotCache(
+			false,
+			kxds.DefaultHash,
+			testruntime.NoopCacheLogger{},
+		)
+
+		serverMetrics = kxds.NewServerMetrics()
+		registry      = prometheus.NewPedanticRegistry()
+
+		setListenerSnapshot = func(t *testing.T, version string) {
+			snapshot, err := cache.NewSnapshot(
+				version,
+				map[resource.Type][]types.Resource{
+					resource.ListenerType: {&listener.Listener{Name: "test-listener"}},
+				},
+			)
+			require.NoError(t, err)
+			require.NoError(t, xdsCache.SetSnapshot(ctx, kxds.DefautHashKey, snapshot))
+		}
+
+		gatherAndCompare = func(want string, names ...string) func() bool {
+			return func() bool {
+				return promtestutil.GatherAndCompare(registry, strings.NewReader(want), names...) == nil
+			}
+		}
+
+		wantClientMetrics = `
+# HELP kxds_xds_acks_total Total number of xDS responses ACKed by the clients, by type URL.
+# TYPE kxds_xds_acks_total counter
+kxds_xds_acks_total{type_url="type.googleapis.com/envoy.config.listener.v3.Listener"} 1
+# HELP kxds_xds_connected_streams Number of xDS streams open, by node.
+# TYPE kxds_xds_connected_streams gauge
+kxds_xds_connected_streams{node="metrics-client"} 1
+# HELP kxds_xds_last_pushed_version_info Version of the last xDS response sent, by type URL.
+# TYPE kxds_xds_last_pushed_version_info gauge
+kxds_xds_last_pushed_version_info{type_url="type.googleapis.com/envoy.config.listener.v3.Listener",version="v2"} 1
+# HELP kxds_xds_nacks_total Total number of xDS responses NACKed by the clients, by type URL.
+# TYPE kxds_xds_nacks_total counter
+kxds_xds_nacks_total{type_url="type.googleapis.com/envoy.config.listener.v3.Listener"} 1
+# HELP kxds_xds_requests_total Total number of xDS requests received, by type URL.
+# TYPE kxds_xds_requests_total counter
+kxds_xds_requests_total{type_url="type.googleapis.com/envoy.config.listener.v3.Listener"} 3
+# HELP kxds_xds_responses_total Total number of xDS responses sent, by type URL.
+# TYPE kxds_xds_responses_total counter
+kxds_xds_responses_total{type_url="type.googleapis.com/envoy.config.listener.v3.Listener"} 3
+`
+	)
+
+	defer cancel()
+	defer startXDSServerWithConfig(t, xdsCache, kxds.XDSServerConfig{Metrics: serverMetrics})()
+
+	require.NoError(t, registry.Register(serverMetrics))
+
+	setListenerSnapshot(t, "v1")
+
+	conn, err := grpc.Dial("localhost:18000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	streamCtx, closeStream := context.WithCancel(ctx)
+	defer closeStream()
+
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(streamCtx)
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			Node:    &core.Node{Id: "metrics-client"},
+			TypeUrl: resource.ListenerType,
+		},
+	)
+	require.NoError(t, err)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			VersionInfo:   resp.VersionInfo,
+			ResponseNonce: resp.Nonce,
+		},
+	)
+	require.NoError(t, err)
+
+	setListenerSnapshot(t, "v2")
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+
+	// The NACK carries the last ACKed version, the server answers it with the current snapshot again.
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			VersionInfo:   "v1",
+			ResponseNonce: resp.Nonce,
+			ErrorDetail:   &status.Status{Message: "rejected"},
+		},
+	)
+	require.NoError(t, err)
+
+	require.Eventually(t, gatherAndCompare(wantClientMetrics), 5*time.Second, 50*time.Millisecond)
+
+	closeStream()
+
+	// The series of a node is dropped once it has no stream left.
+	require.Eventually(
+		t,
+		func() bool {
+			return promtestutil.CollectAndCount(serverMetrics, "kxds_xds_connected_streams") == 0
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func TestRefreshMetrics(t *testing.T) {
+	var (
+		ctx = context.Background()
+
+		refreshMetrics = kxds.NewRefreshMetrics()
+		registry       = prometheus.NewPedanticRegistry()
+
+		xdsCache  = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey, kxds.WithRefreshMetrics(refreshMetrics))
+
+		buildService = func(name, k8sService string) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("default"),
+				),
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: k8sService,
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			)
+		}
+
+		state = kxds.K8sState{
+			Services: []kxdsv1alpha1.XDSService{
+				buildService("valid-xds", "test-service"),
+				buildService("broken-xds", "missing-service"),
+			},
+			EndpointSlices: map[ktypes.NamespacedName][]discoveryv1.EndpointSlice{
+				{Namespace: "default", Name: "test-service"}: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		}
+
+		want = `
+# HELP kxds_snapshot_resources Number of xDS resources published, by type URL.
+# TYPE kxds_snapshot_resources gauge
+kxds_snapshot_resources{type_url="type.googleapis.com/envoy.config.cluster.v3.Cluster"} 1
+kxds_snapshot_resources{type_url="type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"} 1
+kxds_snapshot_resources{type_url="type.googleapis.com/envoy.config.listener.v3.Listener"} 1
+kxds_snapshot_resources{type_url="type.googleapis.com/envoy.config.route.v3.RouteConfiguration"} 1
+# HELP kxds_translation_failures_total Total number of failed translations, by XDSService.
+# TYPE kxds_translation_failures_total counter
+kxds_translation_failures_total{name="broken-xds",namespace="default"} 1
+`
+	)
+
+	require.NoError(t, registry.Register(refreshMetrics))
+
+	for i := 0; i < 2; i++ {
+		_, err := refresher.RefreshCache(ctx, state)
+		require.NoError(t, err)
+	}
+
+	// The broken service is only translated once, as its inputs did not change.
+	err := promtestutil.GatherAndCompare(
+		registry,
+		strings.NewReader(want),
+		"kxds_snapshot_resources",
+		"kxds_translation_failures_total",
+	)
+	require.NoError(t, err)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var buildCount uint64
+
+	for _, family := range families {
+		if family.GetName() == "kxds_snapshot_build_duration_seconds" {
+			buildCount = family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+
+	assert.Equal(t, uint64(2), buildCount)
+
+	// The failures series of a removed service is dropped.
+	state.Services = state.Services[:1]
+
+	_, err = refresher.RefreshCache(ctx, state)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, promtestutil.CollectAndCount(refreshMetrics, "kxds_translation_failures_total"))
+}
+
+func TestNackReporting(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+
+		buildService = func(name string) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("default"),
+				),
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: "test-service",
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			)
+		}
+
+		svcA = buildService("svc-a")
+		svcB = buildService("svc-b")
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{svcA, svcB},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		).Build()
+
+		recorder = record.NewFakeRecorder(10)
+		reporter = kxds.NewNackReporter(cl, recorder, "kxds/kxds-0")
+
+		xdsCache  = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey, kxds.WithNackReporter(reporter))
+
+		rejectedCondition = func(t *testing.T, svc kxdsv1alpha1.XDSService) *metav1.Condition {
+			var got kxdsv1alpha1.XDSService
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&svc), &got))
+
+			return meta.FindStatusCondition(got.Status.Conditions, kxdsv1alpha1.ConditionRejected)
+		}
+
+		rejectingNodes = func(t *testing.T, svc kxdsv1alpha1.XDSService) []string {
+			var got kxdsv1alpha1.XDSService
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&svc), &got))
+
+			var nodes []string
+			for _, rejection := range got.Status.Rejections {
+				nodes = append(nodes, rejection.Node)
+			}
+
+			return nodes
+		}
+
+		wantMessage = `Node "nack-client" rejected type.googleapis.com/envoy.config.listener.v3.Listener "default/svc-a": resource "default/svc-a": broken route`
+	)
+
+	defer cancel()
+	defer startXDSServerWithConfig(t, xdsCache, kxds.XDSServerConfig{AckObserver: reporter})()
+
+	go func() {
+		assert.NoError(t, reporter.Start(ctx))
+	}()
+
+	_, err := kxds.NewReconciler(cl, refresher).Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	conn, err := grpc.Dial("localhost:18000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			Node:    &core.Node{Id: "nack-client"},
+			TypeUrl: resource.ListenerType,
+		},
+	)
+	require.NoError(t, err)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.Len(t, resp.Resources, 2)
+
+	// The error detail names the rejected listener, only its service is reported.
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			ResponseNonce: resp.Nonce,
+			ErrorDetail:   &status.Status{Message: `resource "default/svc-a": broken route`},
+		},
+	)
+	require.NoError(t, err)
+
+	require.Eventually(
+		t,
+		func() bool {
+			cond := rejectedCondition(t, svcA)
+
+			return cond != nil && cond.Status == metav1.ConditionTrue
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	cond := rejectedCondition(t, svcA)
+	assert.Equal(t, kxdsv1alpha1.ReasonRejectedByClient, cond.Reason)
+	assert.Equal(t, wantMessage, cond.Message)
+	assert.Equal(t, "Warning RejectedByClient "+wantMessage, <-recorder.Events)
+	assert.Nil(t, rejectedCondition(t, svcB))
+
+	// The NACK did not carry any ACKed version, the server sends the listeners again.
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			VersionInfo:   resp.VersionInfo,
+			ResponseNonce: resp.Nonce,
+		},
+	)
+	require.NoError(t, err)
+
+	require.Eventually(
+		t,
+		func() bool {
+			cond := rejectedCondition(t, svcA)
+
+			return cond != nil && cond.Status == metav1.ConditionFalse
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	assert.Equal(t, kxdsv1alpha1.ReasonAcceptedByClient, rejectedCondition(t, svcA).Reason)
+	assert.Nil(t, rejectedCondition(t, svcB))
+
+	// The service stays rejected until all the clients which rejected it ACK it again.
+	var (
+		nackA = &status.Status{Message: `resource "default/svc-a": broken route`}
+		nackB = &status.Status{Message: `resource "default/svc-b": broken route`}
+	)
+
+	reporter.ObserveAck(&core.Node{Id: "client-1"}, resource.ListenerType, resp.Resources, nackA)
+	reporter.ObserveAck(&core.Node{Id: "client-2"}, resource.ListenerType, resp.Resources, nackA)
+	reporter.ObserveAck(&core.Node{Id: "client-1"}, resource.ListenerType, resp.Resources, nil)
+
+	// Reports are written in order, once svc-b is rejected the ACK of client-1 has been handled.
+	reporter.ObserveAck(&core.Node{Id: "client-3"}, resource.ListenerType, resp.Resources, nackB)
+
+	require.Eventually(
+		t,
+		func() bool {
+			cond := rejectedCondition(t, svcB)
+
+			return cond != nil && cond.Status == metav1.ConditionTrue
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	cond = rejectedCondition(t, svcA)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Contains(t, cond.Message, `Node "client-2" rejected`)
+
+	reporter.ObserveAck(&core.Node{Id: "client-2"}, resource.ListenerType, resp.Resources, nil)
+
+	require.Eventually(
+		t,
+		func() bool {
+			return rejectedCondition(t, svcA).Status == metav1.ConditionFalse
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	// client-3 still rejects svc-b.
+	assert.Equal(t, metav1.ConditionTrue, rejectedCondition(t, svcB).Status)
+	assert.Equal(
+		t,
+		[]kxdsv1alpha1.ClientRejection{
+			{
+				Replica:  "kxds/kxds-0",
+				Node:     "client-3",
+				Type:     resource.ListenerType,
+				Resource: "default/svc-b",
+				Message:  nackB.Message,
+			},
+		},
+		func() []kxdsv1alpha1.ClientRejection {
+			var got kxdsv1alpha1.XDSService
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(&svcB), &got))
+
+			return got.Status.Rejections
+		}(),
+	)
+
+	// NACKs naming no resource aren't attributed to any service.
+	reporter.ObserveAck(&core.Node{Id: "client-4"}, resource.ListenerType, resp.Resources, &status.Status{Message: "broken"})
+
+	// The rejections of a client are cleared once its last stream is closed.
+	streamCtx, closeStream := context.WithCancel(ctx)
+	defer closeStream()
+
+	stream, err = discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(streamCtx)
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			Node:    &core.Node{Id: "nack-client-2"},
+			TypeUrl: resource.ListenerType,
+		},
+	)
+	require.NoError(t, err)
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			ResponseNonce: resp.Nonce,
+			ErrorDetail:   nackB,
+		},
+	)
+	require.NoError(t, err)
+
+	require.Eventually(
+		t,
+		func() bool {
+			return assert.ObjectsAreEqual([]string{"client-3", "nack-client-2"}, rejectingNodes(t, svcB))
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	assert.Empty(t, rejectingNodes(t, svcA))
+
+	closeStream()
+
+	require.Eventually(
+		t,
+		func() bool {
+			return assert.ObjectsAreEqual([]string{"client-3"}, rejectingNodes(t, svcB))
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	assert.Equal(t, metav1.ConditionTrue, rejectedCondition(t, svcB).Status)
+
+	// The elected replica prunes the rejections of the replicas which are gone.
+	_, err = kxds.NewReconciler(cl, refresher).Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	assert.Empty(t, rejectingNodes(t, svcB))
+	assert.Equal(t, metav1.ConditionFalse, rejectedCondition(t, svcB).Status)
+	assert.Equal(t, kxdsv1alpha1.ReasonRejectionExpired, rejectedCondition(t, svcB).Reason)
+
+	// The rejections of the resources which are no longer published are cleared.
+	reporter.ObserveAck(&core.Node{Id: "client-3"}, resource.ListenerType, resp.Resources, &status.Status{Message: `resource "default/svc-b": still broken`})
+
+	require.Eventually(
+		t,
+		func() bool {
+			return assert.ObjectsAreEqual([]string{"client-3"}, rejectingNodes(t, svcB))
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	_, err = refresher.RefreshCache(
+		ctx,
+		kxds.K8sState{
+			Services: []kxdsv1alpha1.XDSService{svcA},
+			EndpointSlices: map[ktypes.NamespacedName][]discoveryv1.EndpointSlice{
+				{Namespace: "default", Name: "test-service"}: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	require.Eventually(
+		t,
+		func() bool {
+			return len(rejectingNodes(t, svcB)) == 0
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	assert.Equal(t, kxdsv1alpha1.ReasonRejectionExpired, rejectedCondition(t, svcB).Reason)
+}
+
+func TestXDSServerAuthentication(t *testing.T) {
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+
+		tokenFile        = filepath.Join(dir, "token")
+		invalidTokenFile = filepath.Join(dir, "invalid-token")
+
+		reviews     int32
+		reviewUsers = map[string]string{
+			"valid-token":     "system:serviceaccount:default:xds-client",
+			"namespace-token": "system:serviceaccount:allowed:any-client",
+			"forbidden-token": "system:serviceaccount:default:other-client",
+			"user-token":      "jane",
+		}
+
+		xdsCache = cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{})
+
+		validCreds = xdscreds.Config{
+			CACertificateFile: filepath.Join(dir, "ca.pem"),
+			CertificateFile:   filepath.Join(dir, "client.pem"),
+			PrivateKeyFile:    filepath.Join(dir, "client-key.pem"),
+			ServerName:        testruntime.ServerDNSName,
+			TokenFile:         tokenFile,
+		}
+
+		fetchListeners = func(t *testing.T, dialCreds grpc.DialOption) error {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			conn, err := grpc.Dial("localhost:18000", dialCreds)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+			if err != nil {
+				return err
+			}
+
+			err = stream.Send(&discoveryv3.DiscoveryRequest{Node: &core.Node{Id: "auth-client"}, TypeUrl: resource.ListenerType})
+			if err != nil {
+				return err
+			}
+
+			_, err = stream.Recv()
+
+			return err
+		}
+
+		withCreds = func(t *testing.T, cfg xdscreds.Config) grpc.DialOption {
+			bundle, err := xdscreds.NewBundle(cfg)
+			require.NoError(t, err)
+
+			return grpc.WithCredentialsBundle(bundle)
+		}
+	)
+
+	_, err := testruntime.GenerateCertificates(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(tokenFile, []byte("valid-token\n"), 0o600))
+	require.NoError(t, os.WriteFile(invalidTokenFile, []byte("invalid-token\n"), 0o600))
+
+	snapshot, err := cache.NewSnapshot(
+		"1",
+		map[resource.Type][]types.Resource{
+			resource.ListenerType: {&listener.Listener{Name: "test-listener"}},
+		},
+	)
+	require.NoError(t, err)
+	require.NoError(t, xdsCache.SetSnapshot(ctx, kxds.DefautHashKey, snapshot))
+
+	defer startXDSServerWithConfig(
+		t,
+		xdsCache,
+		kxds.XDSServerConfig{
+			TLS: &kxds.ServerTLSConfig{
+				CertFile:     filepath.Join(dir, "server.pem"),
+				KeyFile:      filepath.Join(dir, "server-key.pem"),
+				ClientCAFile: filepath.Join(dir, "ca.pem"),
+			},
+			TokenAuth: kxds.NewTokenReviewAuthenticator(
+				tokenReviewClient{Client: fake.NewClientBuilder().Build(), users: reviewUsers, reviews: &reviews},
+				kxds.TokenReviewConfig{
+					AllowedServiceAccounts: []string{"default/xds-client"},
+					AllowedNamespaces:      []string{"allowed"},
+					CacheTTL:               time.Minute,
+				},
+			),
+		},
+	)()
+
+	// Give the server some time to start.
+	require.Eventually(
+		t,
+		func() bool { return fetchListeners(t, withCreds(t, validCreds)) == nil },
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	t.Run("plaintext", func(t *testing.T) {
+		assert.Error(t, fetchListeners(t, grpc.WithTransportCredentials(insecure.NewCredentials())))
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		cfg := validCreds
+		cfg.CertificateFile = ""
+		cfg.PrivateKeyFile = ""
+
+		assert.Error(t, fetchListeners(t, withCreds(t, cfg)))
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		cfg := validCreds
+		cfg.TokenFile = ""
+
+		assert.Equal(t, codes.Unauthenticated, grpcstatus.Code(fetchListeners(t, withCreds(t, cfg))))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		cfg := validCreds
+		cfg.TokenFile = invalidTokenFile
+
+		assert.Equal(t, codes.Unauthenticated, grpcstatus.Code(fetchListeners(t, withCreds(t, cfg))))
+	})
+
+	for _, testCase := range []struct {
+		desc     string
+		token    string
+		wantCode codes.Code
+	}{
+		{
+			desc:     "allowed namespace",
+			token:    "namespace-token",
+			wantCode: codes.OK,
+		},
+		{
+			desc:     "ServiceAccount not allowed",
+			token:    "forbidden-token",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			desc:     "not a ServiceAccount",
+			token:    "user-token",
+			wantCode: codes.PermissionDenied,
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			cfg := validCreds
+			cfg.TokenFile = filepath.Join(dir, testCase.token)
+			require.NoError(t, os.WriteFile(cfg.TokenFile, []byte(testCase.token), 0o600))
 
-			// Flush snapshot state from previous iteration.
-			xdsCache.ClearSnapshot(kxds.DefautHashKey)
+			assert.Equal(t, testCase.wantCode, grpcstatus.Code(fetchListeners(t, withCreds(t, cfg))))
+		})
+	}
 
-			_, err := cacheReconciller.Reconcile(
+	t.Run("reviews cached", func(t *testing.T) {
+		before := atomic.LoadInt32(&reviews)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, fetchListeners(t, withCreds(t, validCreds)))
+		}
+
+		assert.Equal(t, before, atomic.LoadInt32(&reviews))
+	})
+
+	t.Run("certificates reloaded", func(t *testing.T) {
+		// A new CA issues new certificates, clients trusting it are accepted once the server reloaded them.
+		_, err := testruntime.GenerateCertificates(dir)
+		require.NoError(t, err)
+
+		require.Eventually(
+			t,
+			func() bool { return fetchListeners(t, withCreds(t, validCreds)) == nil },
+			5*time.Second,
+			50*time.Millisecond,
+		)
+	})
+}
+
+func TestXDSServerAuthenticationConfig(t *testing.T) {
+	var (
+		dir = t.TempDir()
+
+		serverTLS = &kxds.ServerTLSConfig{
+			CertFile: filepath.Join(dir, "server.pem"),
+			KeyFile:  filepath.Join(dir, "server-key.pem"),
+		}
+	)
+
+	_, err := testruntime.GenerateCertificates(dir)
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		desc    string
+		cfg     kxds.XDSServerConfig
+		wantErr string
+	}{
+		{
+			desc: "plaintext",
+			cfg: kxds.XDSServerConfig{
+				TokenAuth: kxds.NewTokenReviewAuthenticator(
+					fake.NewClientBuilder().Build(),
+					kxds.TokenReviewConfig{AllowedNamespaces: []string{"default"}},
+				),
+			},
+			wantErr: "token authentication requires the xDS server to serve TLS",
+		},
+		{
+			desc: "no allowed ServiceAccount",
+			cfg: kxds.XDSServerConfig{
+				TLS:       serverTLS,
+				TokenAuth: kxds.NewTokenReviewAuthenticator(fake.NewClientBuilder().Build(), kxds.TokenReviewConfig{}),
+			},
+			wantErr: "token authentication requires allowed ServiceAccounts or namespaces",
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			testCase.cfg.BindAddr = ":18000"
+
+			err := kxds.NewXDSServer(cache.NewSnapshotCache(false, kxds.DefaultHash, testruntime.NoopCacheLogger{}), testCase.cfg).Start(context.Background())
+			assert.EqualError(t, err, testCase.wantErr)
+		})
+	}
+}
+
+func TestScopedSnapshots(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+
+		xdsCache = kxds.NewScopedSnapshotCache(testruntime.NoopCacheLogger{})
+
+		buildService = func(name string, opts ...testruntime.XDSServiceOpt) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				append(
+					opts,
+					testruntime.WithRoutes(
+						testruntime.BuildSingleRoute("default"),
+					),
+					testruntime.WithClusters(
+						testruntime.BuildCluster(
+							"default",
+							testruntime.WithLocalities(
+								testruntime.BuildLocality(
+									testruntime.WithK8sService(
+										kxdsv1alpha1.K8sService{
+											Name: "test-service",
+											Port: grpcPort,
+										},
+									),
+								),
+							),
+						),
+					),
+				)...,
+			)
+		}
+
+		cl = fake.NewClientBuilder().WithLists(
+			&kxdsv1alpha1.XDSServiceList{
+				Items: []kxdsv1alpha1.XDSService{
+					buildService("public"),
+					buildService("default-only", testruntime.WithScopes("default")),
+					buildService("team-a-only", testruntime.WithScopes("team-a")),
+					buildService("team-a-and-b", testruntime.WithScopes("team-a", "team-b")),
+				},
+			},
+			&discoveryv1.EndpointSliceList{
+				Items: testruntime.BuildEndpointSlices("test-service", "default", nil),
+			},
+		).Build()
+
+		cacheReconciller = kxds.NewReconciler(cl, kxds.NewScopedCacheRefresher(xdsCache))
+
+		serverTLS = &kxds.ServerTLSConfig{
+			CertFile:     filepath.Join(dir, "server.pem"),
+			KeyFile:      filepath.Join(dir, "server-key.pem"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+		}
+
+		reviews     int32
+		reviewUsers = map[string]string{
+			"team-a-token": "system:serviceaccount:team-a:client",
+			"team-b-token": "system:serviceaccount:team-b:client",
+			"team-c-token": "system:serviceaccount:team-c:client",
+		}
+
+		dial = func(t *testing.T, token string) *grpc.ClientConn {
+			cfg := xdscreds.Config{
+				CACertificateFile: filepath.Join(dir, "ca.pem"),
+				CertificateFile:   filepath.Join(dir, "client.pem"),
+				PrivateKeyFile:    filepath.Join(dir, "client-key.pem"),
+				ServerName:        testruntime.ServerDNSName,
+			}
+
+			if token != "" {
+				cfg.TokenFile = filepath.Join(dir, token)
+				require.NoError(t, os.WriteFile(cfg.TokenFile, []byte(token), 0o600))
+			}
+
+			bundle, err := xdscreds.NewBundle(cfg)
+			require.NoError(t, err)
+
+			conn, err := grpc.Dial("localhost:18000", grpc.WithCredentialsBundle(bundle))
+			require.NoError(t, err)
+
+			return conn
+		}
+	)
+
+	_, err := testruntime.GenerateCertificates(dir)
+	require.NoError(t, err)
+
+	_, err = cacheReconciller.Reconcile(ctx, ctrl.Request{})
+	require.NoError(t, err)
+
+	t.Run("token", func(t *testing.T) {
+		defer startXDSServerWithConfig(
+			t,
+			xdsCache,
+			kxds.XDSServerConfig{
+				TLS: serverTLS,
+				TokenAuth: kxds.NewTokenReviewAuthenticator(
+					tokenReviewClient{Client: fake.NewClientBuilder().Build(), users: reviewUsers, reviews: &reviews},
+					kxds.TokenReviewConfig{AllowedNamespaces: []string{"team-a", "team-b", "team-c"}},
+				),
+			},
+		)()
+
+		for _, testCase := range []struct {
+			desc          string
+			token         string
+			claimedScope  string
+			wantListeners []string
+		}{
+			{
+				desc:          "team-a ServiceAccount",
+				token:         "team-a-token",
+				wantListeners: []string{"default/public", "default/team-a-and-b", "default/team-a-only"},
+			},
+			{
+				// The scope sent by the client is overwritten by the namespace of its ServiceAccount.
+				desc:          "team-b ServiceAccount claiming team-a",
+				token:         "team-b-token",
+				claimedScope:  "team-a",
+				wantListeners: []string{"default/public", "default/team-a-and-b"},
+			},
+			{
+				// No service declares this scope, clients get the default snapshot.
+				desc:          "team-c ServiceAccount claiming team-a",
+				token:         "team-c-token",
+				claimedScope:  "team-a",
+				wantListeners: []string{"default/public"},
+			},
+		} {
+			t.Run(testCase.desc, func(t *testing.T) {
+				conn := dial(t, testCase.token)
+				defer conn.Close()
+
+				assert.ElementsMatch(t, testCase.wantListeners, fetchListenerNames(t, conn, testCase.claimedScope))
+			})
+		}
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		defer startXDSServerWithConfig(t, xdsCache, kxds.XDSServerConfig{TLS: serverTLS})()
+
+		conn := dial(t, "")
+		defer conn.Close()
+
+		// The scope is the namespace of the SPIFFE ID of the client certificate.
+		assert.ElementsMatch(t, []string{"default/public", "default/default-only"}, fetchListenerNames(t, conn, "team-a"))
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		defer startXDSServer(t, xdsCache)()
+
+		conn, err := grpc.Dial("localhost:18000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.ElementsMatch(t, []string{"default/public"}, fetchListenerNames(t, conn, "team-a"))
+	})
+
+	// Snapshots of the scopes no service declares expire once no client watches them.
+	require.Eventually(
+		t,
+		func() bool {
+			kxds.RequestRefresh(cacheReconciller, nil)
+
+			_, err := cacheReconciller.Reconcile(ctx, ctrl.Request{})
+			require.NoError(t, err)
+
+			return assert.ObjectsAreEqual(
+				[]string{kxds.DefautHashKey, kxds.ScopeHashKey("default"), kxds.ScopeHashKey("team-a"), kxds.ScopeHashKey("team-b")},
+				xdsCache.Keys(),
+			)
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+func TestDeltaXDS(t *testing.T) {
+	require.NoError(t, kxdsv1alpha1.AddToScheme(scheme.Scheme))
+
+	backends, err := testruntime.StartBackends(testruntime.Config{BackendCount: 3})
+	require.NoError(t, err)
+	defer func() {
+		_ = backends.Stop()
+	}()
+
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+
+		xdsCache = cache.NewSnapshotCache(
+			false,
+			kxds.DefaultHash,
+			testruntime.NoopCacheLogger{},
+		)
+
+		refresher = kxds.NewCacheRefresher(xdsCache, kxds.DefautHashKey)
+
+		buildService = func(name, k8sService string) kxdsv1alpha1.XDSService {
+			return testruntime.BuildXDSService(
+				name,
+				"default",
+				testruntime.WithRoutes(
+					testruntime.BuildSingleRoute("default"),
+				),
+				testruntime.WithClusters(
+					testruntime.BuildCluster(
+						"default",
+						testruntime.WithLocalities(
+							testruntime.BuildLocality(
+								testruntime.WithK8sService(
+									kxdsv1alpha1.K8sService{
+										Name: k8sService,
+										Port: grpcPort,
+									},
+								),
+							),
+						),
+					),
+				),
+			)
+		}
+
+		reconcile = func(t *testing.T, services []kxdsv1alpha1.XDSService, slices ...[]discoveryv1.EndpointSlice) {
+			cl := fake.NewClientBuilder().WithLists(
+				&kxdsv1alpha1.XDSServiceList{Items: services},
+				&discoveryv1.EndpointSliceList{Items: testruntime.JoinEndpointSlices(slices...)},
+			).Build()
+
+			_, err := kxds.NewReconciler(cl, refresher).Reconcile(ctx, ctrl.Request{})
+			require.NoError(t, err)
+		}
+
+		svcA = buildService("svc-a", "test-service-a")
+		svcB = buildService("svc-b", "test-service-b")
+
+		clusterA = "kxds.svc-a.default.default"
+		clusterB = "kxds.svc-b.default.default"
+	)
+
+	defer cancel()
+	defer startXDSServer(t, xdsCache)()
+
+	reconcile(
+		t,
+		[]kxdsv1alpha1.XDSService{svcA, svcB},
+		testruntime.BuildEndpointSlices("test-service-a", "default", backends[0:1]),
+		testruntime.BuildEndpointSlices("test-service-b", "default", backends[1:2]),
+	)
+
+	conn, err := grpc.Dial("localhost:18000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).DeltaAggregatedResources(ctx)
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DeltaDiscoveryRequest{
+			Node:    &core.Node{Id: "delta-client"},
+			TypeUrl: resource.EndpointType,
+		},
+	)
+	require.NoError(t, err)
+
+	// The first response holds all the load assignments.
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterA, clusterB}, deltaResourceNames(resp))
+	require.NoError(t, stream.Send(&discoveryv3.DeltaDiscoveryRequest{TypeUrl: resource.EndpointType, ResponseNonce: resp.Nonce}))
+
+	// A new endpoint on service b only sends its load assignment.
+	reconcile(
+		t,
+		[]kxdsv1alpha1.XDSService{svcA, svcB},
+		testruntime.BuildEndpointSlices("test-service-a", "default", backends[0:1]),
+		testruntime.BuildEndpointSlices("test-service-b", "default", backends[1:3]),
+	)
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{clusterB}, deltaResourceNames(resp))
+	assert.Empty(t, resp.RemovedResources)
+	require.NoError(t, stream.Send(&discoveryv3.DeltaDiscoveryRequest{TypeUrl: resource.EndpointType, ResponseNonce: resp.Nonce}))
+
+	// Deleting service a only sends its removal.
+	reconcile(
+		t,
+		[]kxdsv1alpha1.XDSService{svcB},
+		testruntime.BuildEndpointSlices("test-service-b", "default", backends[1:3]),
+	)
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Empty(t, resp.Resources)
+	assert.Equal(t, []string{clusterA}, resp.RemovedResources)
+	require.NoError(t, stream.Send(&discoveryv3.DeltaDiscoveryRequest{TypeUrl: resource.EndpointType, ResponseNonce: resp.Nonce}))
+
+	// CSDS reports the state ACKed by the incremental client.
+	var (
+		csdsClient       = statusv3.NewClientStatusDiscoveryServiceClient(conn)
+		publishedVersion = snapshotVersion(t, xdsCache)
+	)
+
+	require.Eventually(
+		t,
+		func() bool {
+			resp, err := csdsClient.FetchClientStatus(
 				ctx,
-				ctrl.Request{},
+				&statusv3.ClientStatusRequest{
+					NodeMatchers: []*matcher.NodeMatcher{
+						{
+							NodeId: &matcher.StringMatcher{
+								MatchPattern: &matcher.StringMatcher_Exact{Exact: "delta-client"},
+							},
+						},
+					},
+				},
 			)
 			require.NoError(t, err)
 
-			testCase.doAssert(t)
-		})
+			if len(resp.Config) != 1 || len(resp.Config[0].GenericXdsConfigs) != 1 {
+				return false
+			}
+
+			cfg := resp.Config[0].GenericXdsConfigs[0]
+
+			return cfg.Name == clusterB && cfg.ClientStatus == adminv3.ClientResourceStatus_ACKED && cfg.VersionInfo == publishedVersion
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+}
+
+type countingRefresher struct {
+	kxds.Refresher
+
+	count int
+}
+
+func (r *countingRefresher) RefreshCache(ctx context.Context, state kxds.K8sState) (kxds.RefreshResult, error) {
+	r.count++
+
+	return r.Refresher.RefreshCache(ctx, state)
+}
+
+// tokenReviewClient authenticates a single token.
+// tokenReviewClient authenticates the given tokens as their user, and counts the reviews.
+type tokenReviewClient struct {
+	client.Client
+
+	users   map[string]string
+	reviews *int32
+}
+
+func (c tokenReviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authenticationv1.TokenReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+
+	atomic.AddInt32(c.reviews, 1)
+
+	review.Status.User.Username, review.Status.Authenticated = c.users[review.Spec.Token]
+
+	return nil
+}
+
+// staticLookupHost resolves hostnames from the given addresses, failing for unknown ones.
+func staticLookupHost(addresses map[string][]string) func(context.Context, string) ([]string, error) {
+	return func(_ context.Context, host string) ([]string, error) {
+		addrs, ok := addresses[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		return append([]string(nil), addrs...), nil
+	}
+}
+
+type countingSnapshotCache struct {
+	cache.SnapshotCache
+
+	sets int
+}
+
+func (c *countingSnapshotCache) SetSnapshot(ctx context.Context, node string, snapshot cache.ResourceSnapshot) error {
+	c.sets++
+
+	return c.SnapshotCache.SetSnapshot(ctx, node, snapshot)
+}
+
+func snapshotVersion(t *testing.T, xdsCache cache.SnapshotCache) string {
+	t.Helper()
+
+	snapshot, err := xdsCache.GetSnapshot(kxds.DefautHashKey)
+	require.NoError(t, err)
+
+	return snapshot.GetVersion(resource.ClusterType)
+}
+
+func deltaResourceNames(resp *discoveryv3.DeltaDiscoveryResponse) []string {
+	names := make([]string, len(resp.Resources))
+
+	for i, res := range resp.Resources {
+		names[i] = res.Name
+	}
+
+	return names
+}
+
+// fetchListenerNames subscribes to all the listeners as a client claiming the given scope, and returns the names of the received ones.
+func fetchListenerNames(t *testing.T, conn *grpc.ClientConn, scope string) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metadata, err := structpb.NewStruct(map[string]interface{}{kxds.ScopeMetadataKey: scope})
+	require.NoError(t, err)
+
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	require.NoError(t, err)
+
+	err = stream.Send(
+		&discoveryv3.DiscoveryRequest{
+			Node:    &core.Node{Id: "scope-" + scope, Metadata: metadata},
+			TypeUrl: resource.ListenerType,
+		},
+	)
+	require.NoError(t, err)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	names := make([]string, len(resp.Resources))
+
+	for i, res := range resp.Resources {
+		var l listener.Listener
+
+		require.NoError(t, res.UnmarshalTo(&l))
+
+		names[i] = l.Name
+	}
+
+	return names
+}
+
+func findGenericXDSConfig(resp *statusv3.ClientStatusResponse, typeURL, name string) *statusv3.ClientConfig_GenericXdsConfig {
+	for _, cfg := range resp.Config {
+		for _, xdsConfig := range cfg.GenericXdsConfigs {
+			if xdsConfig.TypeUrl == typeURL && xdsConfig.Name == name {
+				return xdsConfig
+			}
+		}
+	}
+
+	return nil
+}
+
+func mustAny(t *testing.T, msg proto.Message) *anypb.Any {
+	a, err := anypb.New(msg)
+	require.NoError(t, err)
+
+	return a
+}
+
+// startXDSServer serves the given cache on the address of the test xDS bootstrap.
+// The returned func stops the server and waits for it to release the address.
+func startXDSServer(t *testing.T, xdsCache cache.Cache) func() {
+	return startXDSServerWithConfig(t, xdsCache, kxds.XDSServerConfig{})
+}
+
+func startXDSServerWithConfig(t *testing.T, xdsCache cache.Cache, cfg kxds.XDSServerConfig) func() {
+	cfg.BindAddr = ":18000"
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+
+		server = kxds.NewXDSServer(xdsCache, cfg)
+	)
+
+	go func() {
+		defer close(done)
+
+		err := server.Start(ctx)
+		assert.NoError(t, err)
+	}()
+
+	return func() {
+		cancel()
+		<-done
 	}
 }
 
@@ -1532,3 +6226,9 @@ func hang(d time.Duration) func(t *testing.T, backends testruntime.Backends) {
 		backends.SetBehavior(testruntime.HangBehavior(d))
 	}
 }
+
+func failing(failures int32, code codes.Code) func(t *testing.T, backends testruntime.Backends) {
+	return func(t *testing.T, backends testruntime.Backends) {
+		backends.SetBehavior(testruntime.FailingBehavior(failures, code))
+	}
+}
@@ -0,0 +1,211 @@
+package kxds
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	lrsv3 "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var localityLabels = []string{"cluster", "region", "zone", "sub_zone"}
+
+// LoadReportingServer serves the Load Reporting Service, and exposes the load reported by the clients as Prometheus metrics.
+type LoadReportingServer struct {
+	interval time.Duration
+
+	succeeded  *prometheus.CounterVec
+	errored    *prometheus.CounterVec
+	issued     *prometheus.CounterVec
+	dropped    *prometheus.CounterVec
+	inProgress *prometheus.GaugeVec
+
+	streamCount int64
+
+	mu sync.Mutex
+	// inProgressReports holds the last count of requests in progress reported by each stream, by locality.
+	inProgressReports map[int64]map[localityKey]uint64
+}
+
+type localityKey struct {
+	cluster string
+	region  string
+	zone    string
+	subZone string
+}
+
+func (k localityKey) labels() prometheus.Labels {
+	return prometheus.Labels{
+		"cluster":  k.cluster,
+		"region":   k.region,
+		"zone":     k.zone,
+		"sub_zone": k.subZone,
+	}
+}
+
+// NewLoadReportingServer returns a load reporting server asking the clients to report their load at the given interval.
+func NewLoadReportingServer(interval time.Duration) *LoadReportingServer {
+	return &LoadReportingServer{
+		interval: interval,
+		succeeded: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_lrs_requests_succeeded_total",
+				Help: "Total number of requests successfully completed by the clients, by cluster and locality.",
+			},
+			localityLabels,
+		),
+		errored: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_lrs_requests_errored_total",
+				Help: "Total number of requests completed in error by the clients, by cluster and locality.",
+			},
+			localityLabels,
+		),
+		issued: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_lrs_requests_issued_total",
+				Help: "Total number of requests issued by the clients, by cluster and locality.",
+			},
+			localityLabels,
+		),
+		dropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_lrs_requests_dropped_total",
+				Help: "Total number of requests dropped by the clients, by cluster and drop category.",
+			},
+			[]string{"cluster", "category"},
+		),
+		inProgress: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kxds_lrs_requests_in_progress",
+				Help: "Number of requests in progress on the clients, by cluster and locality.",
+			},
+			localityLabels,
+		),
+		inProgressReports: make(map[int64]map[localityKey]uint64),
+	}
+}
+
+func (s *LoadReportingServer) Describe(ch chan<- *prometheus.Desc) {
+	s.succeeded.Describe(ch)
+	s.errored.Describe(ch)
+	s.issued.Describe(ch)
+	s.dropped.Describe(ch)
+	s.inProgress.Describe(ch)
+}
+
+func (s *LoadReportingServer) Collect(ch chan<- prometheus.Metric) {
+	s.succeeded.Collect(ch)
+	s.errored.Collect(ch)
+	s.issued.Collect(ch)
+	s.dropped.Collect(ch)
+	s.inProgress.Collect(ch)
+}
+
+func (s *LoadReportingServer) StreamLoadStats(stream lrsv3.LoadReportingService_StreamLoadStatsServer) error {
+	streamID := atomic.AddInt64(&s.streamCount, 1)
+
+	defer s.forgetStream(streamID)
+
+	// Clients only send their load once they received the reporting interval, which is answered to their first request.
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	err = stream.Send(
+		&lrsv3.LoadStatsResponse{
+			SendAllClusters:       true,
+			LoadReportingInterval: durationpb.New(s.interval),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		s.recordLoad(streamID, req)
+
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *LoadReportingServer) recordLoad(streamID int64, req *lrsv3.LoadStatsRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, clusterStats := range req.ClusterStats {
+		for _, localityStats := range clusterStats.UpstreamLocalityStats {
+			key := makeLocalityKey(clusterStats.ClusterName, localityStats)
+			labels := key.labels()
+
+			// Counts are reported since the last report of the client.
+			s.succeeded.With(labels).Add(float64(localityStats.TotalSuccessfulRequests))
+			s.errored.With(labels).Add(float64(localityStats.TotalErrorRequests))
+			s.issued.With(labels).Add(float64(localityStats.TotalIssuedRequests))
+
+			reports, ok := s.inProgressReports[streamID]
+			if !ok {
+				reports = make(map[localityKey]uint64)
+				s.inProgressReports[streamID] = reports
+			}
+
+			reports[key] = localityStats.TotalRequestsInProgress
+			s.updateInProgress(key)
+		}
+
+		var categorizedDrops uint64
+
+		for _, drops := range clusterStats.DroppedRequests {
+			categorizedDrops += drops.DroppedCount
+			s.dropped.WithLabelValues(clusterStats.ClusterName, drops.Category).Add(float64(drops.DroppedCount))
+		}
+
+		if clusterStats.TotalDroppedRequests > categorizedDrops {
+			s.dropped.WithLabelValues(clusterStats.ClusterName, "").Add(float64(clusterStats.TotalDroppedRequests - categorizedDrops))
+		}
+	}
+}
+
+func (s *LoadReportingServer) forgetStream(streamID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := s.inProgressReports[streamID]
+	delete(s.inProgressReports, streamID)
+
+	for key := range reports {
+		s.updateInProgress(key)
+	}
+}
+
+// updateInProgress sums the requests in progress reported by all the streams for a locality.
+func (s *LoadReportingServer) updateInProgress(key localityKey) {
+	var total uint64
+
+	for _, reports := range s.inProgressReports {
+		total += reports[key]
+	}
+
+	s.inProgress.With(key.labels()).Set(float64(total))
+}
+
+func makeLocalityKey(clusterName string, stats *endpoint.UpstreamLocalityStats) localityKey {
+	return localityKey{
+		cluster: clusterName,
+		region:  stats.GetLocality().GetRegion(),
+		zone:    stats.GetLocality().GetZone(),
+		subZone: stats.GetLocality().GetSubZone(),
+	}
+}
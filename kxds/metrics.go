@@ -0,0 +1,264 @@
+package kxds
+
+import (
+	"context"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerMetrics are the xDS server callbacks exposing the activity of the clients as Prometheus metrics.
+type ServerMetrics struct {
+	connectedStreams *prometheus.GaugeVec
+	requests         *prometheus.CounterVec
+	acks             *prometheus.CounterVec
+	nacks            *prometheus.CounterVec
+	responses        *prometheus.CounterVec
+	pushedVersion    *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// streamNodes holds the node of each stream, known once it sent its first request.
+	streamNodes map[streamKey]string
+	// nodeStreams counts the open streams of each node, its series is dropped once it has none.
+	nodeStreams map[string]int
+	// pushedVersions holds the last version pushed for each type URL.
+	pushedVersions map[string]string
+}
+
+// streamKey identifies a stream, incremental streams are numbered independently from the state of the world ones.
+type streamKey struct {
+	id    int64
+	delta bool
+}
+
+var _ server.Callbacks = &ServerMetrics{}
+
+func NewServerMetrics() *ServerMetrics {
+	return &ServerMetrics{
+		connectedStreams: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kxds_xds_connected_streams",
+				Help: "Number of xDS streams open, by node.",
+			},
+			[]string{"node"},
+		),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_xds_requests_total",
+				Help: "Total number of xDS requests received, by type URL.",
+			},
+			[]string{"type_url"},
+		),
+		acks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_xds_acks_total",
+				Help: "Total number of xDS responses ACKed by the clients, by type URL.",
+			},
+			[]string{"type_url"},
+		),
+		nacks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_xds_nacks_total",
+				Help: "Total number of xDS responses NACKed by the clients, by type URL.",
+			},
+			[]string{"type_url"},
+		),
+		responses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_xds_responses_total",
+				Help: "Total number of xDS responses sent, by type URL.",
+			},
+			[]string{"type_url"},
+		),
+		pushedVersion: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kxds_xds_last_pushed_version_info",
+				Help: "Version of the last xDS response sent, by type URL.",
+			},
+			[]string{"type_url", "version"},
+		),
+		streamNodes:    make(map[streamKey]string),
+		nodeStreams:    make(map[string]int),
+		pushedVersions: make(map[string]string),
+	}
+}
+
+func (m *ServerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.connectedStreams.Describe(ch)
+	m.requests.Describe(ch)
+	m.acks.Describe(ch)
+	m.nacks.Describe(ch)
+	m.responses.Describe(ch)
+	m.pushedVersion.Describe(ch)
+}
+
+func (m *ServerMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.connectedStreams.Collect(ch)
+	m.requests.Collect(ch)
+	m.acks.Collect(ch)
+	m.nacks.Collect(ch)
+	m.responses.Collect(ch)
+	m.pushedVersion.Collect(ch)
+}
+
+func (m *ServerMetrics) OnStreamOpen(context.Context, int64, string) error {
+	return nil
+}
+
+func (m *ServerMetrics) OnStreamClosed(streamID int64, _ *core.Node) {
+	m.closeStream(streamKey{id: streamID})
+}
+
+func (m *ServerMetrics) OnStreamRequest(streamID int64, req *discoveryv3.DiscoveryRequest) error {
+	m.recordNode(streamKey{id: streamID}, req.GetNode().GetId())
+	m.recordRequest(req.TypeUrl, req.ResponseNonce, req.ErrorDetail != nil)
+
+	return nil
+}
+
+func (m *ServerMetrics) OnStreamResponse(_ context.Context, _ int64, _ *discoveryv3.DiscoveryRequest, resp *discoveryv3.DiscoveryResponse) {
+	m.recordResponse(resp.TypeUrl, resp.VersionInfo)
+}
+
+func (m *ServerMetrics) OnDeltaStreamOpen(context.Context, int64, string) error {
+	return nil
+}
+
+func (m *ServerMetrics) OnDeltaStreamClosed(streamID int64, _ *core.Node) {
+	m.closeStream(streamKey{id: streamID, delta: true})
+}
+
+func (m *ServerMetrics) OnStreamDeltaRequest(streamID int64, req *discoveryv3.DeltaDiscoveryRequest) error {
+	m.recordNode(streamKey{id: streamID, delta: true}, req.GetNode().GetId())
+	m.recordRequest(req.TypeUrl, req.ResponseNonce, req.ErrorDetail != nil)
+
+	return nil
+}
+
+func (m *ServerMetrics) OnStreamDeltaResponse(_ int64, _ *discoveryv3.DeltaDiscoveryRequest, resp *discoveryv3.DeltaDiscoveryResponse) {
+	m.recordResponse(resp.TypeUrl, resp.SystemVersionInfo)
+}
+
+func (m *ServerMetrics) OnFetchRequest(_ context.Context, req *discoveryv3.DiscoveryRequest) error {
+	m.recordRequest(req.TypeUrl, "", false)
+
+	return nil
+}
+
+func (m *ServerMetrics) OnFetchResponse(_ *discoveryv3.DiscoveryRequest, resp *discoveryv3.DiscoveryResponse) {
+	m.recordResponse(resp.TypeUrl, resp.VersionInfo)
+}
+
+// recordNode counts a stream as connected once it sent its node, clients only send it on the first request of a stream.
+func (m *ServerMetrics) recordNode(key streamKey, nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.streamNodes[key]; ok || nodeID == "" {
+		return
+	}
+
+	m.streamNodes[key] = nodeID
+	m.nodeStreams[nodeID]++
+	m.connectedStreams.WithLabelValues(nodeID).Set(float64(m.nodeStreams[nodeID]))
+}
+
+func (m *ServerMetrics) closeStream(key streamKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodeID, ok := m.streamNodes[key]
+	if !ok {
+		return
+	}
+
+	delete(m.streamNodes, key)
+
+	m.nodeStreams[nodeID]--
+	if m.nodeStreams[nodeID] > 0 {
+		m.connectedStreams.WithLabelValues(nodeID).Set(float64(m.nodeStreams[nodeID]))
+		return
+	}
+
+	delete(m.nodeStreams, nodeID)
+	m.connectedStreams.DeleteLabelValues(nodeID)
+}
+
+// recordRequest counts a request, requests carrying the nonce of a response either ACK or NACK it.
+func (m *ServerMetrics) recordRequest(typeURL, responseNonce string, nack bool) {
+	m.requests.WithLabelValues(typeURL).Inc()
+
+	switch {
+	case responseNonce == "":
+	case nack:
+		m.nacks.WithLabelValues(typeURL).Inc()
+	default:
+		m.acks.WithLabelValues(typeURL).Inc()
+	}
+}
+
+func (m *ServerMetrics) recordResponse(typeURL, version string) {
+	m.responses.WithLabelValues(typeURL).Inc()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if previous, ok := m.pushedVersions[typeURL]; ok {
+		if previous == version {
+			return
+		}
+
+		m.pushedVersion.DeleteLabelValues(typeURL, previous)
+	}
+
+	m.pushedVersions[typeURL] = version
+	m.pushedVersion.WithLabelValues(typeURL, version).Set(1)
+}
+
+// RefreshMetrics exposes the activity of the translation pipeline as Prometheus metrics.
+type RefreshMetrics struct {
+	buildDuration       prometheus.Histogram
+	resources           *prometheus.GaugeVec
+	translationFailures *prometheus.CounterVec
+}
+
+func NewRefreshMetrics() *RefreshMetrics {
+	return &RefreshMetrics{
+		buildDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "kxds_snapshot_build_duration_seconds",
+				Help:    "Duration of the translation and publication of the xDS snapshots.",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		resources: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kxds_snapshot_resources",
+				Help: "Number of xDS resources published, by type URL.",
+			},
+			[]string{"type_url"},
+		),
+		translationFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kxds_translation_failures_total",
+				Help: "Total number of failed translations, by XDSService.",
+			},
+			[]string{"namespace", "name"},
+		),
+	}
+}
+
+func (m *RefreshMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.buildDuration.Describe(ch)
+	m.resources.Describe(ch)
+	m.translationFailures.Describe(ch)
+}
+
+func (m *RefreshMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.buildDuration.Collect(ch)
+	m.resources.Collect(ch)
+	m.translationFailures.Collect(ch)
+}
@@ -0,0 +1,448 @@
+package kxds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+const nackReportQueueSize = 1000
+
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// NackReporter attributes the responses NACKed by the xDS clients to the XDSServices their resources have been translated from.
+// Each replica records the rejections of its own clients in the status of the XDSService, until they ACK the resources again or disconnect.
+// The Rejected condition holds as long as the clients of any replica reject the service.
+type NackReporter struct {
+	client   client.Client
+	recorder record.EventRecorder
+	// replica is the namespace and name of the pod of this replica, the elected one prunes its rejections once it is gone.
+	replica string
+	reports chan nackReport
+
+	mu sync.Mutex
+	// owners holds the XDSService each published resource has been translated from, by type URL and name.
+	owners map[string]map[string]ktypes.NamespacedName
+	// rejected holds the error detail of the rejections of the clients of this replica, by XDSService.
+	rejected map[ktypes.NamespacedName]map[clientRejection]string
+	// dropped holds the reports dropped while the queue was full, sent again on the next change.
+	dropped map[ktypes.NamespacedName]nackReport
+}
+
+// clientRejection identifies the rejection of a resource by a client.
+type clientRejection struct {
+	nodeID       string
+	typeURL      string
+	resourceName string
+}
+
+// nackReport writes the rejections of the clients of this replica to the status of an XDSService.
+// Reports without service only log a rejection which could not be attributed.
+type nackReport struct {
+	service    ktypes.NamespacedName
+	rejections []kxdsv1alpha1.ClientRejection
+	// event is recorded as a warning event of the service if set.
+	event string
+	// reason and message explain why the rejections have been cleared.
+	reason  string
+	message string
+}
+
+var _ AckObserver = &NackReporter{}
+
+func NewNackReporter(cl client.Client, recorder record.EventRecorder, replica string) *NackReporter {
+	return &NackReporter{
+		client:   cl,
+		recorder: recorder,
+		replica:  replica,
+		reports:  make(chan nackReport, nackReportQueueSize),
+		owners:   make(map[string]map[string]ktypes.NamespacedName),
+		rejected: make(map[ktypes.NamespacedName]map[clientRejection]string),
+		dropped:  make(map[ktypes.NamespacedName]nackReport),
+	}
+}
+
+// NeedLeaderElection makes all the replicas report the NACKs of their clients, not only the elected one.
+func (r *NackReporter) NeedLeaderElection() bool {
+	return false
+}
+
+// Start writes the reports to the API server, out of the xDS streams.
+func (r *NackReporter) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case report := <-r.reports:
+			if report.service == (ktypes.NamespacedName{}) {
+				logger.Info(report.event)
+				continue
+			}
+
+			if err := r.report(ctx, report); err != nil {
+				logger.Error(
+					err,
+					"unable to report client rejection",
+					"service",
+					report.service.Name,
+					"namespace",
+					report.service.Namespace,
+				)
+			}
+		}
+	}
+}
+
+func (r *NackReporter) ObserveAck(node *core.Node, typeURL string, resources []*anypb.Any, errorDetail *rpcstatus.Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resendDropped()
+
+	if errorDetail == nil {
+		// The client accepted the whole response, including the resources it previously rejected.
+		r.clearRejections(
+			func(rejection clientRejection) bool {
+				return rejection.nodeID == node.GetId() && rejection.typeURL == typeURL
+			},
+			kxdsv1alpha1.ReasonAcceptedByClient,
+			fmt.Sprintf("Node %q accepted the service resources", node.GetId()),
+		)
+
+		return
+	}
+
+	names := rejectedResourceNames(resources, errorDetail.Message)
+	if len(names) == 0 {
+		r.enqueue(
+			nackReport{
+				event: fmt.Sprintf("Node %q rejected %s without naming any resource: %s", node.GetId(), typeURL, errorDetail.Message),
+			},
+		)
+
+		return
+	}
+
+	for _, name := range names {
+		owner, ok := r.owners[typeURL][name]
+		if !ok {
+			// Server listeners and resources of removed services aren't owned by any XDSService.
+			continue
+		}
+
+		rejection := clientRejection{nodeID: node.GetId(), typeURL: typeURL, resourceName: name}
+
+		// Clients NACK every response until the resource is fixed, only report the first one.
+		if message, ok := r.rejected[owner][rejection]; ok && message == errorDetail.Message {
+			continue
+		}
+
+		if r.rejected[owner] == nil {
+			r.rejected[owner] = make(map[clientRejection]string)
+		}
+
+		r.rejected[owner][rejection] = errorDetail.Message
+		r.sync(owner, nackReport{event: rejectionMessage(node.GetId(), typeURL, name, errorDetail.Message)})
+	}
+}
+
+// ObserveDisconnect clears the rejections of a client once it has no stream left.
+func (r *NackReporter) ObserveDisconnect(node *core.Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resendDropped()
+	r.clearRejections(
+		func(rejection clientRejection) bool {
+			return rejection.nodeID == node.GetId()
+		},
+		kxdsv1alpha1.ReasonRejectionExpired,
+		fmt.Sprintf("Node %q disconnected", node.GetId()),
+	)
+}
+
+// clearRejections drops the matching rejections, and reports the services they belonged to.
+func (r *NackReporter) clearRejections(match func(rejection clientRejection) bool, reason, message string) {
+	for owner, rejections := range r.rejected {
+		cleared := false
+
+		for rejection := range rejections {
+			if match(rejection) {
+				delete(rejections, rejection)
+				cleared = true
+			}
+		}
+
+		if cleared {
+			r.sync(owner, nackReport{reason: reason, message: message})
+		}
+	}
+}
+
+// sync queues a report holding the current rejections of a service, the report is sent again later if the queue is full.
+func (r *NackReporter) sync(owner ktypes.NamespacedName, report nackReport) {
+	report.service = owner
+	report.rejections = r.serviceRejections(owner)
+
+	if len(report.rejections) == 0 {
+		delete(r.rejected, owner)
+	}
+
+	if !r.enqueue(report) {
+		r.dropped[owner] = report
+		return
+	}
+
+	delete(r.dropped, owner)
+}
+
+// resendDropped queues the dropped reports again, with the current rejections of their services.
+func (r *NackReporter) resendDropped() {
+	for owner, report := range r.dropped {
+		report.rejections = r.serviceRejections(owner)
+
+		if !r.enqueue(report) {
+			return
+		}
+
+		delete(r.dropped, owner)
+	}
+}
+
+// serviceRejections lists the rejections of a service by the clients of this replica.
+func (r *NackReporter) serviceRejections(owner ktypes.NamespacedName) []kxdsv1alpha1.ClientRejection {
+	var rejections []kxdsv1alpha1.ClientRejection
+
+	for rejection, message := range r.rejected[owner] {
+		rejections = append(
+			rejections,
+			kxdsv1alpha1.ClientRejection{
+				Replica:  r.replica,
+				Node:     rejection.nodeID,
+				Type:     rejection.typeURL,
+				Resource: rejection.resourceName,
+				Message:  message,
+			},
+		)
+	}
+
+	return rejections
+}
+
+// enqueue queues a report without blocking the xDS stream, reports are dropped if the queue is full.
+func (r *NackReporter) enqueue(report nackReport) bool {
+	select {
+	case r.reports <- report:
+		return true
+	default:
+		return false
+	}
+}
+
+// setOwners replaces the owners of the published resources, and clears the rejections of the resources which are no longer published.
+func (r *NackReporter) setOwners(owners map[string]map[string]ktypes.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.owners = owners
+
+	r.resendDropped()
+
+	for owner, rejections := range r.rejected {
+		cleared := false
+
+		for rejection := range rejections {
+			if current, ok := owners[rejection.typeURL][rejection.resourceName]; !ok || current != owner {
+				delete(rejections, rejection)
+				cleared = true
+			}
+		}
+
+		if cleared {
+			r.sync(owner, nackReport{reason: kxdsv1alpha1.ReasonRejectionExpired, message: "The rejected resources are no longer published"})
+		}
+	}
+}
+
+func (r *NackReporter) report(ctx context.Context, report nackReport) error {
+	var (
+		svc      kxdsv1alpha1.XDSService
+		recorded bool
+	)
+
+	// The elected replica and the other replicas may update the status meanwhile, retry on conflicts.
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.client.Get(ctx, report.service, &svc); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		if report.event != "" && !recorded {
+			r.recorder.Event(&svc, corev1.EventTypeWarning, kxdsv1alpha1.ReasonRejectedByClient, report.event)
+			recorded = true
+		}
+
+		status := svc.Status.DeepCopy()
+		setReplicaRejections(status, r.replica, report.rejections)
+		setRejectedCondition(status, svc.Generation, report.reason, report.message)
+
+		if equality.Semantic.DeepEqual(&svc.Status, status) {
+			return nil
+		}
+
+		svc.Status = *status
+
+		return r.client.Status().Update(ctx, &svc)
+	})
+}
+
+// setReplicaRejections replaces the rejections of the clients of a replica.
+func setReplicaRejections(status *kxdsv1alpha1.XDSServiceStatus, replica string, rejections []kxdsv1alpha1.ClientRejection) {
+	var result []kxdsv1alpha1.ClientRejection
+
+	for _, rejection := range status.Rejections {
+		if rejection.Replica != replica {
+			result = append(result, rejection)
+		}
+	}
+
+	result = append(result, rejections...)
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+
+		if a.Replica != b.Replica {
+			return a.Replica < b.Replica
+		}
+
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+
+		return a.Resource < b.Resource
+	})
+
+	status.Rejections = result
+}
+
+// pruneRejections drops the rejections recorded by the replicas which are gone, as their clients reconnect to other replicas.
+func pruneRejections(status *kxdsv1alpha1.XDSServiceStatus, generation int64, replicas map[string]struct{}) {
+	var kept []kxdsv1alpha1.ClientRejection
+
+	for _, rejection := range status.Rejections {
+		// Replicas running out of a pod can't be told apart from the ones which are gone.
+		if _, ok := replicas[rejection.Replica]; ok || rejection.Replica == "" {
+			kept = append(kept, rejection)
+		}
+	}
+
+	if len(kept) == len(status.Rejections) {
+		return
+	}
+
+	status.Rejections = kept
+	setRejectedCondition(status, generation, kxdsv1alpha1.ReasonRejectionExpired, "The replicas of the rejecting clients are gone")
+}
+
+// setRejectedCondition sets the Rejected condition from the rejections of the clients of all the replicas.
+// Services which were never rejected don't get the condition, reason and message explain why it's cleared otherwise.
+func setRejectedCondition(status *kxdsv1alpha1.XDSServiceStatus, generation int64, reason, message string) {
+	if len(status.Rejections) > 0 {
+		first := status.Rejections[0]
+
+		message := rejectionMessage(first.Node, first.Type, first.Resource, first.Message)
+		if others := len(status.Rejections) - 1; others > 0 {
+			message += fmt.Sprintf(" (and %d other rejections)", others)
+		}
+
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               kxdsv1alpha1.ConditionRejected,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             kxdsv1alpha1.ReasonRejectedByClient,
+			Message:            message,
+		})
+
+		return
+	}
+
+	if !meta.IsStatusConditionTrue(status.Conditions, kxdsv1alpha1.ConditionRejected) {
+		return
+	}
+
+	if reason == "" {
+		reason, message = kxdsv1alpha1.ReasonRejectionExpired, "No client rejects the service resources"
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               kxdsv1alpha1.ConditionRejected,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func rejectionMessage(nodeID, typeURL, resourceName, message string) string {
+	return fmt.Sprintf("Node %q rejected %s %q: %s", nodeID, typeURL, resourceName, message)
+}
+
+// rejectedResourceNames returns the names of the NACKed resources, quoted by the clients in the error detail.
+// Clients don't always name the resources they rejected, the NACK can't be attributed then.
+func rejectedResourceNames(resources []*anypb.Any, message string) []string {
+	var names []string
+
+	for _, res := range resources {
+		if name := resourceName(res); strings.Contains(message, strconv.Quote(name)) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// addResourceOwner records the given service as the owner of all its resources.
+func addResourceOwner(owners map[string]map[string]ktypes.NamespacedName, owner ktypes.NamespacedName, svc xdsService) {
+	ownedResources := map[resource.Type][]types.Resource{
+		resource.ListenerType: {svc.listener},
+		resource.RouteType:    {svc.routeConfig},
+		resource.ClusterType:  svc.clusters,
+		resource.EndpointType: svc.loadAssignments,
+	}
+
+	for typeURL, items := range ownedResources {
+		if owners[typeURL] == nil {
+			owners[typeURL] = make(map[string]ktypes.NamespacedName)
+		}
+
+		for _, item := range items {
+			owners[typeURL][cache.GetResourceName(item)] = owner
+		}
+	}
+}
@@ -3,59 +3,657 @@ package kxds
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
 )
 
+// refreshRequest is the request all the events are batched on, as a refresh always publishes a whole snapshot.
+var refreshRequest = reconcile.Request{NamespacedName: types.NamespacedName{Name: "kxds-refresh"}}
+
 type Reconciller struct {
 	client    client.Client
 	refresher Refresher
+	index     *referenceIndex
+	dns       *dnsResolver
+	remotes   *remoteClusters
+
+	// minRefreshInterval is the minimum delay between two refreshes, the events received meanwhile are published by the next one.
+	minRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	dirty       bool
+	lastRefresh time.Time
+	// leader is set when this replica is the one writing the statuses.
+	leader bool
 }
 
 func NewReconciler(cl client.Client, refresher Refresher) *Reconciller {
 	return &Reconciller{
 		client:    cl,
 		refresher: refresher,
+		index:     newReferenceIndex(),
+		dns:       newDNSResolver(),
+		remotes:   newRemoteClusters(),
+		// Always publish a first snapshot.
+		dirty:  true,
+		leader: true,
+	}
+}
+
+// SetupWithManager starts watching the resources snapshots are built from.
+// All the events are batched on a single request, refreshing the cache at most once per minRefreshInterval.
+// Events of endpoint slices and pods no XDSService or XDSServer depends on are ignored.
+// All the replicas refresh their cache, only the elected one writes the statuses.
+// The hostnames of the DNS localities are resolved again every dnsRefreshInterval, the cache is refreshed if their addresses changed.
+// Remote clusters are registered by the Secrets of remoteClustersNamespace, they are disabled if it is empty.
+func (r *Reconciller) SetupWithManager(mgr ctrl.Manager, minRefreshInterval, dnsRefreshInterval time.Duration, remoteClustersNamespace string) error {
+	r.minRefreshInterval = minRefreshInterval
+	r.leader = false
+
+	c, err := controller.NewUnmanaged("kxds", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
 	}
+
+	if remoteClustersNamespace != "" {
+		if err := r.watchRemoteClusters(mgr, c, remoteClustersNamespace); err != nil {
+			return err
+		}
+	}
+
+	// Statuses are left as is until this replica is elected, then written by a new refresh.
+	if err := c.Watch(
+		source.Func(func(ctx context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+			go func() {
+				select {
+				case <-mgr.Elected():
+					r.becomeLeader()
+					queue.Add(refreshRequest)
+				case <-ctx.Done():
+				}
+			}()
+
+			return nil
+		}),
+		nil,
+	); err != nil {
+		return err
+	}
+
+	if err := c.Watch(
+		source.Func(func(ctx context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+			go func() {
+				ticker := time.NewTicker(dnsRefreshInterval)
+				defer ticker.Stop()
+
+				for {
+					select {
+					case <-ticker.C:
+						if r.refreshDNS(ctx) {
+							queue.Add(refreshRequest)
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			return nil
+		}),
+		nil,
+	); err != nil {
+		return err
+	}
+
+	// Status only updates are ignored.
+	if err := c.Watch(
+		&source.Kind{Type: &kxdsv1alpha1.XDSService{}},
+		handler.EnqueueRequestsFromMapFunc(r.requestRefresh),
+		predicate.GenerationChangedPredicate{},
+	); err != nil {
+		return err
+	}
+
+	if err := c.Watch(
+		&source.Kind{Type: &kxdsv1alpha1.XDSServer{}},
+		handler.EnqueueRequestsFromMapFunc(r.requestRefresh),
+		predicate.GenerationChangedPredicate{},
+	); err != nil {
+		return err
+	}
+
+	if err := c.Watch(
+		&source.Kind{Type: &discoveryv1.EndpointSlice{}},
+		handler.EnqueueRequestsFromMapFunc(r.mapEndpointSlice),
+	); err != nil {
+		return err
+	}
+
+	if err := c.Watch(
+		&source.Kind{Type: &corev1.Pod{}},
+		handler.EnqueueRequestsFromMapFunc(r.mapPod),
+	); err != nil {
+		return err
+	}
+
+	// Pods backing a service only matter for their weight annotation.
+	if err := c.Watch(
+		&source.Kind{Type: &corev1.Pod{}},
+		handler.EnqueueRequestsFromMapFunc(r.mapBackingPod),
+		predicate.AnnotationChangedPredicate{},
+	); err != nil {
+		return err
+	}
+
+	return mgr.Add(unelectedController{Controller: c})
+}
+
+// watchRemoteClusters watches the Secrets registering the remote clusters, and the endpoint slices of the remote clusters.
+// Only the Secrets of the given namespace carrying the remote cluster label are cached.
+func (r *Reconciller) watchRemoteClusters(mgr ctrl.Manager, c controller.Controller, namespace string) error {
+	registered, err := labels.NewRequirement(RemoteClusterLabel, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := cache.New(
+		mgr.GetConfig(),
+		cache.Options{
+			Scheme:    mgr.GetScheme(),
+			Mapper:    mgr.GetRESTMapper(),
+			Namespace: namespace,
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Secret{}: {Label: labels.NewSelector().Add(*registered)},
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.Add(unelectedCache{Cache: secrets}); err != nil {
+		return err
+	}
+
+	r.remotes.secrets = secrets
+	r.remotes.namespace = namespace
+	r.remotes.scheme = mgr.GetScheme()
+
+	if err := c.Watch(
+		source.Func(func(ctx context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+			r.remotes.start(ctx, func(clusterName string, obj client.Object) {
+				if len(r.mapRemoteEndpointSlice(clusterName, obj)) > 0 {
+					queue.Add(refreshRequest)
+				}
+			})
+
+			return nil
+		}),
+		nil,
+	); err != nil {
+		return err
+	}
+
+	return c.Watch(
+		source.NewKindWithCache(&corev1.Secret{}, secrets),
+		handler.EnqueueRequestsFromMapFunc(r.requestRefresh),
+	)
+}
+
+// unelectedController runs a controller on all the replicas, not only on the elected one.
+type unelectedController struct {
+	controller.Controller
+}
+
+func (unelectedController) NeedLeaderElection() bool {
+	return false
+}
+
+// unelectedCache runs a cache on all the replicas, not only on the elected one.
+type unelectedCache struct {
+	cache.Cache
+}
+
+func (unelectedCache) NeedLeaderElection() bool {
+	return false
+}
+
+func (r *Reconciller) becomeLeader() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.leader = true
+	r.dirty = true
+}
+
+func (r *Reconciller) isLeader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.leader
+}
+
+func (r *Reconciller) requestRefresh(client.Object) []reconcile.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dirty = true
+
+	return []reconcile.Request{refreshRequest}
+}
+
+// refreshDNS resolves the hostnames of the DNS localities again, and marks the cache dirty if their addresses changed.
+func (r *Reconciller) refreshDNS(ctx context.Context) bool {
+	if !r.dns.refresh(ctx) {
+		return false
+	}
+
+	r.requestRefresh(nil)
+
+	return true
+}
+
+func (r *Reconciller) mapEndpointSlice(obj client.Object) []reconcile.Request {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok || len(r.index.servicesReferencing("", slice)) == 0 {
+		return nil
+	}
+
+	return r.requestRefresh(obj)
+}
+
+// mapRemoteEndpointSlice requests a refresh for the endpoint slices of a remote cluster, and once a remote cluster is available.
+func (r *Reconciller) mapRemoteEndpointSlice(clusterName string, obj client.Object) []reconcile.Request {
+	if obj == nil {
+		return r.requestRefresh(nil)
+	}
+
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok || len(r.index.servicesReferencing(clusterName, slice)) == 0 {
+		return nil
+	}
+
+	return r.requestRefresh(obj)
+}
+
+func (r *Reconciller) mapPod(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || !r.index.selectsPod(pod) {
+		return nil
+	}
+
+	return r.requestRefresh(obj)
+}
+
+func (r *Reconciller) mapBackingPod(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || !r.index.backsService(pod) {
+		return nil
+	}
+
+	return r.requestRefresh(obj)
+}
+
+// startRefresh reports if the cache must be refreshed now, otherwise for how long to wait before the next refresh.
+func (r *Reconciller) startRefresh() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return 0, false
+	}
+
+	if wait := r.minRefreshInterval - time.Since(r.lastRefresh); wait > 0 {
+		return wait, false
+	}
+
+	r.dirty = false
+	r.lastRefresh = time.Now()
+
+	return 0, true
+}
+
+// abortRefresh makes sure that the next reconciliation refreshes the cache again.
+func (r *Reconciller) abortRefresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dirty = true
 }
 
 //+kubebuilder:rbac:groups=api.kxds.dev,resources=xdsservices,verbs=get;list;watch;
-//+kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch;
+//+kubebuilder:rbac:groups=api.kxds.dev,resources=xdsservices/status,verbs=get;update;patch;
+//+kubebuilder:rbac:groups=api.kxds.dev,resources=xdsservers,verbs=get;list;watch;
+//+kubebuilder:rbac:groups=api.kxds.dev,resources=xdsservers/status,verbs=get;update;patch;
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-func (r *Reconciller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// All the events are batched on the same request, which refreshes the whole cache.
+func (r *Reconciller) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	wait, refresh := r.startRefresh()
+	if !refresh {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	result, err := r.refresh(ctx)
+	if err != nil {
+		r.abortRefresh()
+	}
+
+	return result, err
+}
+
+func (r *Reconciller) refresh(ctx context.Context) (ctrl.Result, error) {
 	var (
-		endpoints corev1.EndpointsList
-		services  kxdsv1alpha1.XDSServiceList
+		endpointSlices discoveryv1.EndpointSliceList
+		services       kxdsv1alpha1.XDSServiceList
+		servers        kxdsv1alpha1.XDSServerList
+		pods           corev1.PodList
+		nodes          corev1.NodeList
 
 		logger = log.FromContext(ctx)
 	)
 
-	if err := r.client.List(ctx, &endpoints); err != nil {
-		return ctrl.Result{}, fmt.Errorf("could not gather endpoints list %w", err)
+	if err := r.client.List(ctx, &endpointSlices); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not gather endpoint slices list %w", err)
 	}
 
 	if err := r.client.List(ctx, &services); err != nil {
 		return ctrl.Result{}, fmt.Errorf("could not gather services list %w", err)
 	}
 
+	if err := r.client.List(ctx, &servers); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not gather servers list %w", err)
+	}
+
+	if err := r.client.List(ctx, &pods); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not gather pods list %w", err)
+	}
+
+	if err := r.client.List(ctx, &nodes); err != nil {
+		return ctrl.Result{}, fmt.Errorf("could not gather nodes list %w", err)
+	}
+
+	slicesByService := mapEndpointSlicesByService(endpointSlices.Items)
+
+	r.index.update(services.Items, servers.Items, slicesByService)
+
+	if err := r.remotes.sync(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	remoteEndpointSlices, err := r.remotes.endpointSlices(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var hostnames []string
+	for _, svc := range services.Items {
+		hostnames = append(hostnames, dnsHostnames(svc)...)
+	}
+
 	logger.Info("Triggering a cache refresh")
 
-	return ctrl.Result{}, r.refresher.RefreshCache(ctx, services.Items, mapEndpointsByName(endpoints.Items))
+	result, err := r.refresher.RefreshCache(
+		ctx,
+		K8sState{
+			Services:       services.Items,
+			Servers:        servers.Items,
+			EndpointSlices: slicesByService,
+			Pods:           pods.Items,
+			Nodes:          mapNodesByName(nodes.Items),
+			DNSAddresses:   r.dns.resolve(ctx, hostnames),
+
+			RemoteEndpointSlices: remoteEndpointSlices,
+		},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Only the elected replica writes the statuses, they're the same for all replicas.
+	if !r.isLeader() {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.updateStatuses(ctx, services.Items, result, mapPodNames(pods.Items)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.updateServerStatuses(ctx, servers.Items, result)
+}
+
+// updateStatuses writes the statuses of the services, replicas holds the pods currently running to prune the rejections of the ones which are gone.
+func (r *Reconciller) updateStatuses(ctx context.Context, svcs []kxdsv1alpha1.XDSService, result RefreshResult, replicas map[string]struct{}) error {
+	for _, svc := range svcs {
+		status := makeXDSServiceStatus(svc, result)
+		pruneRejections(&status, svc.Generation, replicas)
+
+		if equality.Semantic.DeepEqual(svc.Status, status) {
+			continue
+		}
+
+		svc.Status = status
+
+		if err := r.client.Status().Update(ctx, &svc); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("could not update status of service %s/%s %w", svc.Namespace, svc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func makeXDSServiceStatus(svc kxdsv1alpha1.XDSService, result RefreshResult) kxdsv1alpha1.XDSServiceStatus {
+	status := *svc.Status.DeepCopy()
+	status.ObservedGeneration = svc.Generation
+
+	err, failed := result.Errors[types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}]
+	if failed {
+		setFailedConditions(&status.Conditions, svc.Generation, err)
+
+		return status
+	}
+
+	status.ServedVersions, status.SnapshotVersion = makeServedVersions(
+		result.Versions,
+		result.ServiceScopes[types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}],
+		snapshotTypes,
+	)
+	setPublishedConditions(&status.Conditions, svc.Generation, "Service has been published")
+
+	if warnings, ok := result.Warnings[types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}]; ok {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               kxdsv1alpha1.ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: svc.Generation,
+			Reason:             kxdsv1alpha1.ReasonEndpointsUnavailable,
+			Message:            strings.Join(warnings, "; "),
+		})
+	}
+
+	return status
+}
+
+func (r *Reconciller) updateServerStatuses(ctx context.Context, srvs []kxdsv1alpha1.XDSServer, result RefreshResult) error {
+	for _, srv := range srvs {
+		status := makeXDSServerStatus(srv, result)
+
+		if equality.Semantic.DeepEqual(srv.Status, status) {
+			continue
+		}
+
+		srv.Status = status
+
+		if err := r.client.Status().Update(ctx, &srv); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("could not update status of server %s/%s %w", srv.Namespace, srv.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func makeXDSServerStatus(srv kxdsv1alpha1.XDSServer, result RefreshResult) kxdsv1alpha1.XDSServerStatus {
+	var (
+		srvName = types.NamespacedName{Name: srv.Name, Namespace: srv.Namespace}
+		status  = *srv.Status.DeepCopy()
+	)
+
+	status.ObservedGeneration = srv.Generation
+
+	err, failed := result.ServerErrors[srvName]
+	if failed {
+		setFailedConditions(&status.Conditions, srv.Generation, err)
+
+		return status
+	}
+
+	// The listeners of the servers are part of the snapshots of all the scopes.
+	scopes := make([]string, 0, len(result.Versions))
+	for scope := range result.Versions {
+		scopes = append(scopes, scope)
+	}
+
+	sort.Strings(scopes)
+
+	status.ServedVersions, status.SnapshotVersion = makeServedVersions(result.Versions, scopes, []string{resource.ListenerType})
+	status.Listeners = result.ServerListeners[srvName]
+	setPublishedConditions(&status.Conditions, srv.Generation, "Server has been published")
+
+	return status
+}
+
+// makeServedVersions lists the versions of the given resource types served to the given scopes, and returns the version they share, if any.
+func makeServedVersions(versions map[string]map[string]string, scopes []string, typeURLs []string) ([]kxdsv1alpha1.ServedVersion, string) {
+	var (
+		served   = make([]kxdsv1alpha1.ServedVersion, 0, len(scopes)*len(typeURLs))
+		distinct = make(map[string]struct{})
+	)
+
+	for _, scope := range scopes {
+		for _, typeURL := range typeURLs {
+			version := versions[scope][typeURL]
+
+			served = append(served, kxdsv1alpha1.ServedVersion{Scope: scope, Type: typeURL, Version: version})
+			distinct[version] = struct{}{}
+		}
+	}
+
+	if len(distinct) != 1 {
+		return served, ""
+	}
+
+	return served, served[0].Version
+}
+
+func setFailedConditions(conditions *[]metav1.Condition, generation int64, err error) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               kxdsv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             kxdsv1alpha1.ReasonTranslationFailed,
+		Message:            err.Error(),
+	})
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               kxdsv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             kxdsv1alpha1.ReasonTranslationFailed,
+		Message:            err.Error(),
+	})
+}
+
+func setPublishedConditions(conditions *[]metav1.Condition, generation int64, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               kxdsv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             kxdsv1alpha1.ReasonPublished,
+		Message:            message,
+	})
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               kxdsv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             kxdsv1alpha1.ReasonPublished,
+	})
+}
+
+func mapEndpointSlicesByService(items []discoveryv1.EndpointSlice) map[types.NamespacedName][]discoveryv1.EndpointSlice {
+	result := make(map[types.NamespacedName][]discoveryv1.EndpointSlice)
+
+	for _, i := range items {
+		svcName, ok := i.Labels[discoveryv1.LabelServiceName]
+		if !ok {
+			continue
+		}
+
+		key := types.NamespacedName{Name: svcName, Namespace: i.Namespace}
+
+		result[key] = append(result[key], i)
+	}
+
+	// Lists come in random order, sort the slices to translate the same state the same way.
+	for _, slices := range result {
+		sortEndpointSlices(slices)
+	}
+
+	return result
+}
+
+// sortEndpointSlices sorts endpoint slices by namespace and name.
+func sortEndpointSlices(slices []discoveryv1.EndpointSlice) {
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].Namespace != slices[j].Namespace {
+			return slices[i].Namespace < slices[j].Namespace
+		}
+
+		return slices[i].Name < slices[j].Name
+	})
+}
+
+// mapPodNames returns the namespace and name of the pods.
+func mapPodNames(items []corev1.Pod) map[string]struct{} {
+	result := make(map[string]struct{}, len(items))
+
+	for _, i := range items {
+		result[types.NamespacedName{Namespace: i.Namespace, Name: i.Name}.String()] = struct{}{}
+	}
+
+	return result
 }
 
-func mapEndpointsByName(items []corev1.Endpoints) map[types.NamespacedName]corev1.Endpoints {
-	result := make(map[types.NamespacedName]corev1.Endpoints, len(items))
+func mapNodesByName(items []corev1.Node) map[string]corev1.Node {
+	result := make(map[string]corev1.Node, len(items))
 
 	for _, i := range items {
-		result[types.NamespacedName{Name: i.Name, Namespace: i.Namespace}] = i
+		result[i.Name] = i
 	}
 
 	return result
@@ -2,48 +2,174 @@ package kxds
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
 	"strconv"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+	"google.golang.org/protobuf/proto"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// RefreshResult reports the outcome of a cache refresh.
+type RefreshResult struct {
+	// Versions holds the version served for each resource type, by client scope. Clients without scope are served the empty scope.
+	Versions map[string]map[resource.Type]string
+	// ServiceScopes holds the client scopes each published XDSService is served to.
+	ServiceScopes map[ktypes.NamespacedName][]string
+	// Errors holds the translation error of each XDSService left out of the published snapshot.
+	Errors map[ktypes.NamespacedName]error
+	// Warnings holds the problems each XDSService has been published despite, such as unavailable endpoints.
+	Warnings map[ktypes.NamespacedName][]string
+	// ServerErrors holds the translation error of each XDSServer left out of the published snapshot.
+	ServerErrors map[ktypes.NamespacedName]error
+	// ServerListeners holds the count of listeners published for each XDSServer.
+	ServerListeners map[ktypes.NamespacedName]int
+}
+
+// K8sState holds the kubernetes resources a snapshot is built from.
+type K8sState struct {
+	Services []kxdsv1alpha1.XDSService
+	Servers  []kxdsv1alpha1.XDSServer
+	// EndpointSlices holds the endpoint slices of each kubernetes service.
+	EndpointSlices map[ktypes.NamespacedName][]discoveryv1.EndpointSlice
+	Pods           []corev1.Pod
+	// Nodes holds the kubernetes nodes by name.
+	Nodes map[string]corev1.Node
+	// DNSAddresses holds the addresses resolved for the hostname of each DNS locality.
+	DNSAddresses map[string][]string
+	// RemoteEndpointSlices holds the endpoint slices of each kubernetes service of the available remote clusters, by cluster name.
+	RemoteEndpointSlices map[string]map[ktypes.NamespacedName][]discoveryv1.EndpointSlice
+
+	// endpointWeights holds the weights of the annotated pods, read from Pods once per translation.
+	endpointWeights map[ktypes.NamespacedName]uint32
+}
+
+// serviceEndpointSlices returns the endpoint slices of a kubernetes service, and reports if the service is known.
+func (s K8sState) serviceEndpointSlices(ref serviceReference) ([]discoveryv1.EndpointSlice, bool) {
+	if ref.cluster == "" {
+		slices, ok := s.EndpointSlices[ref.NamespacedName]
+		return slices, ok
+	}
+
+	slices, ok := s.RemoteEndpointSlices[ref.cluster][ref.NamespacedName]
+
+	return slices, ok
+}
+
 type Refresher interface {
-	RefreshCache(ctx context.Context, svcs []kxdsv1alpha1.XDSService, endpoints map[ktypes.NamespacedName]corev1.Endpoints) error
+	RefreshCache(ctx context.Context, state K8sState) (RefreshResult, error)
 }
 
 type cacheRefresher struct {
-	xdsCache   cache.SnapshotCache
-	hashKey    string
-	versionner versionner
+	xdsCache cache.SnapshotCache
+	hashKey  string
+
+	// scopedCache is set if snapshots are published per client scope.
+	scopedCache *ScopedSnapshotCache
+	// versionPerType is set if each resource type of a snapshot has its own version.
+	versionPerType bool
+	metrics        *RefreshMetrics
+	// nacks is given the owners of the published resources, if set.
+	nacks *NackReporter
+
+	mu           sync.Mutex
+	translations *translationCache
+}
+
+// RefresherOption configures a refresher.
+type RefresherOption func(c *cacheRefresher)
+
+// WithVersionPerType versions each resource type of a snapshot by the hash of its own resources.
+// Clients are then only sent the resource types which changed.
+func WithVersionPerType() RefresherOption {
+	return func(c *cacheRefresher) {
+		c.versionPerType = true
+	}
 }
 
-func NewCacheRefresher(xdsCache cache.SnapshotCache, hashKey string) Refresher {
-	return &cacheRefresher{
-		xdsCache:   xdsCache,
-		hashKey:    hashKey,
-		versionner: &atomicIncrementalVersionner{version: 1},
+// WithNackReporter gives the reporter the XDSService owning each published resource, to attribute the NACKs of the clients.
+func WithNackReporter(reporter *NackReporter) RefresherOption {
+	return func(c *cacheRefresher) {
+		c.nacks = reporter
 	}
 }
 
-func (c *cacheRefresher) RefreshCache(ctx context.Context, svcs []kxdsv1alpha1.XDSService, k8sEndpoints map[ktypes.NamespacedName]corev1.Endpoints) error {
+// WithRefreshMetrics records the activity of the refresher in the given metrics.
+func WithRefreshMetrics(metrics *RefreshMetrics) RefresherOption {
+	return func(c *cacheRefresher) {
+		c.metrics = metrics
+	}
+}
+
+func NewCacheRefresher(xdsCache cache.SnapshotCache, hashKey string, opts ...RefresherOption) Refresher {
+	c := &cacheRefresher{
+		xdsCache: xdsCache,
+		hashKey:  hashKey,
+		metrics:  NewRefreshMetrics(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.translations = newTranslationCache(c.metrics.translationFailures)
+
+	return c
+}
+
+// NewScopedCacheRefresher returns a refresher publishing a snapshot per client scope, holding only the services this scope may see.
+func NewScopedCacheRefresher(xdsCache *ScopedSnapshotCache, opts ...RefresherOption) Refresher {
+	c := &cacheRefresher{
+		xdsCache:    xdsCache,
+		scopedCache: xdsCache,
+		metrics:     NewRefreshMetrics(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.translations = newTranslationCache(c.metrics.translationFailures)
+
+	return c
+}
+
+func (c *cacheRefresher) RefreshCache(ctx context.Context, state K8sState) (RefreshResult, error) {
 	var (
-		listeners    []types.Resource
-		routeConfigs []types.Resource
-		clusters     []types.Resource
-		endpoints    []types.Resource
+		services        []scopedService
+		serverListeners []types.Resource
 
+		owners = make(map[string]map[string]ktypes.NamespacedName)
+
+		result = RefreshResult{
+			Versions:        make(map[string]map[resource.Type]string),
+			ServiceScopes:   make(map[ktypes.NamespacedName][]string),
+			Errors:          make(map[ktypes.NamespacedName]error),
+			Warnings:        make(map[ktypes.NamespacedName][]string),
+			ServerErrors:    make(map[ktypes.NamespacedName]error),
+			ServerListeners: make(map[ktypes.NamespacedName]int),
+		}
 		logger = log.FromContext(ctx)
 	)
 
-	for _, svc := range svcs {
-		xdsSvc, err := makeXDSService(svc, k8sEndpoints)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer func(start time.Time) {
+		c.metrics.buildDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	c.translations.translate(state, func(svc kxdsv1alpha1.XDSService, xdsSvc xdsService, err error) {
 		if err != nil {
 			logger.Error(
 				err,
@@ -54,56 +180,309 @@ func (c *cacheRefresher) RefreshCache(ctx context.Context, svcs []kxdsv1alpha1.X
 				svc.Namespace,
 			)
 
+			result.Errors[ktypes.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}] = err
+
+			return
+		}
+
+		if len(xdsSvc.warnings) > 0 {
+			result.Warnings[ktypes.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}] = xdsSvc.warnings
+		}
+
+		services = append(services, scopedService{name: ktypes.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, scopes: svc.Spec.Scopes, xdsService: xdsSvc})
+		addResourceOwner(owners, ktypes.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, xdsSvc)
+	})
+
+	if c.nacks != nil {
+		c.nacks.setOwners(owners)
+	}
+
+	knownServerListeners := make(map[string]struct{})
+
+	for _, srv := range state.Servers {
+		srvName := ktypes.NamespacedName{Name: srv.Name, Namespace: srv.Namespace}
+
+		xdsSrv, err := makeXDSServer(srv, state.Pods)
+		if err == nil {
+			err = checkListenersUnicity(xdsSrv.listeners, knownServerListeners)
+		}
+		if err != nil {
+			logger.Error(
+				err,
+				"unable to build xdsServer, skipping...",
+				"server",
+				srv.Name,
+				"namespace",
+				srv.Namespace,
+			)
+
+			result.ServerErrors[srvName] = err
+
 			continue
 		}
 
-		listeners = append(listeners, xdsSvc.listener)
-		routeConfigs = append(routeConfigs, xdsSvc.routeConfig)
-		clusters = append(clusters, xdsSvc.clusters...)
-		endpoints = append(endpoints, xdsSvc.loadAssignments...)
+		for _, l := range xdsSrv.listeners {
+			knownServerListeners[cache.GetResourceName(l)] = struct{}{}
+		}
+
+		serverListeners = append(serverListeners, xdsSrv.listeners...)
+		result.ServerListeners[srvName] = len(xdsSrv.listeners)
+	}
+
+	resources := makeSnapshotResources(services, serverListeners)
+	for typ, items := range resources {
+		c.metrics.resources.WithLabelValues(typ).Set(float64(len(items)))
+	}
+
+	if c.scopedCache == nil {
+		versions, err := c.publishSnapshot(ctx, c.hashKey, services, serverListeners)
+		if err != nil {
+			return result, err
+		}
+
+		result.Versions[""] = versions
+		for _, svc := range services {
+			result.ServiceScopes[svc.name] = []string{""}
+		}
+
+		return result, nil
+	}
+
+	for _, scope := range c.snapshotScopes(services) {
+		var visibleServices []scopedService
+
+		for _, svc := range services {
+			if svc.visibleTo(scope) {
+				visibleServices = append(visibleServices, svc)
+				result.ServiceScopes[svc.name] = append(result.ServiceScopes[svc.name], scope)
+			}
+		}
+
+		// Servers do not leak service definitions, their listeners are part of all the snapshots.
+		versions, err := c.publishSnapshot(ctx, ScopeHashKey(scope), visibleServices, serverListeners)
+		if err != nil {
+			return result, err
+		}
+
+		result.Versions[scope] = versions
 	}
 
-	version := c.versionner.GetVersion()
+	return result, nil
+}
 
-	snapshot, err := cache.NewSnapshot(
-		version,
-		map[resource.Type][]types.Resource{
-			resource.ClusterType:  clusters,
-			resource.RouteType:    routeConfigs,
-			resource.ListenerType: listeners,
-			resource.EndpointType: endpoints,
-		},
+// publishSnapshot publishes the resources of the given services and server listeners, unless the current snapshot already holds them.
+// It returns the version served for each resource type.
+func (c *cacheRefresher) publishSnapshot(ctx context.Context, key string, services []scopedService, serverListeners []types.Resource) (map[resource.Type]string, error) {
+	var (
+		resources = makeSnapshotResources(services, serverListeners)
+		logger    = log.FromContext(ctx)
 	)
+
+	snapshot, err := c.makeSnapshot(resources)
 	if err != nil {
 		logger.Error(err, "Unable to create a new snapshot")
-		return err
+		return nil, err
+	}
+
+	versions := make(map[resource.Type]string, len(snapshotTypes))
+	for _, typ := range snapshotTypes {
+		versions[typ] = snapshot.GetVersion(typ)
+	}
+
+	if current, err := c.xdsCache.GetSnapshot(key); err == nil && sameVersions(current, snapshot) {
+		logger.V(1).Info("Snapshot is up to date, skipping", "key", key)
+		return versions, nil
 	}
 
 	logger.Info(
 		"Setting a new Snapshot version",
-		"version",
-		version,
+		"key",
+		key,
 		"listeners",
-		len(listeners),
+		len(resources[resource.ListenerType]),
+		"listenersVersion",
+		snapshot.GetVersion(resource.ListenerType),
 		"routes",
-		len(routeConfigs),
+		len(resources[resource.RouteType]),
+		"routesVersion",
+		snapshot.GetVersion(resource.RouteType),
 		"clusters",
-		len(clusters),
+		len(resources[resource.ClusterType]),
+		"clustersVersion",
+		snapshot.GetVersion(resource.ClusterType),
 		"endpoints",
-		len(endpoints),
+		len(resources[resource.EndpointType]),
+		"endpointsVersion",
+		snapshot.GetVersion(resource.EndpointType),
 	)
 
-	return c.xdsCache.SetSnapshot(ctx, c.hashKey, snapshot)
+	return versions, c.xdsCache.SetSnapshot(ctx, key, snapshot)
+}
+
+// makeSnapshot versions the resources by their hash, either all together or by resource type.
+func (c *cacheRefresher) makeSnapshot(resources map[resource.Type][]types.Resource) (*cache.Snapshot, error) {
+	var snapshot cache.Snapshot
+
+	if !c.versionPerType {
+		version, err := makeResourcesVersion(resources)
+		if err != nil {
+			return nil, err
+		}
+
+		return cache.NewSnapshot(version, resources)
+	}
+
+	for typ, items := range resources {
+		version, err := makeResourcesVersion(map[resource.Type][]types.Resource{typ: items})
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.Resources[cache.GetResponseType(typ)] = cache.NewResources(version, items)
+	}
+
+	return &snapshot, nil
+}
+
+func makeSnapshotResources(services []scopedService, serverListeners []types.Resource) map[resource.Type][]types.Resource {
+	var (
+		listeners    []types.Resource
+		routeConfigs []types.Resource
+		clusters     []types.Resource
+		endpoints    []types.Resource
+	)
+
+	for _, svc := range services {
+		listeners = append(listeners, svc.listener)
+		routeConfigs = append(routeConfigs, svc.routeConfig)
+		clusters = append(clusters, svc.clusters...)
+		endpoints = append(endpoints, svc.loadAssignments...)
+	}
+
+	listeners = append(listeners, serverListeners...)
+
+	return map[resource.Type][]types.Resource{
+		resource.ClusterType:  clusters,
+		resource.RouteType:    routeConfigs,
+		resource.ListenerType: listeners,
+		resource.EndpointType: endpoints,
+	}
+}
+
+// snapshotTypes lists the resource types published in the snapshots.
+var snapshotTypes = []resource.Type{resource.ClusterType, resource.RouteType, resource.ListenerType, resource.EndpointType}
+
+// sameVersions reports if two snapshots have the same version for all the resource types.
+func sameVersions(a, b cache.ResourceSnapshot) bool {
+	for _, typ := range snapshotTypes {
+		if a.GetVersion(typ) != b.GetVersion(typ) {
+			return false
+		}
+	}
+
+	return true
 }
 
-type versionner interface {
-	GetVersion() string
+// snapshotScopes returns the scopes to publish a snapshot for: the default one, the ones declared by services and the ones clients still watch.
+func (c *cacheRefresher) snapshotScopes(services []scopedService) []string {
+	scopes := map[string]struct{}{"": {}}
+
+	for _, svc := range services {
+		for _, scope := range svc.scopes {
+			scopes[scope] = struct{}{}
+		}
+	}
+
+	declared := make(map[string]struct{}, len(scopes))
+	for scope := range scopes {
+		declared[ScopeHashKey(scope)] = struct{}{}
+	}
+
+	c.scopedCache.expireKeys(declared)
+
+	for _, key := range c.scopedCache.Keys() {
+		scopes[hashKeyScope(key)] = struct{}{}
+	}
+
+	result := make([]string, 0, len(scopes))
+	for scope := range scopes {
+		result = append(result, scope)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+type scopedService struct {
+	xdsService
+
+	name   ktypes.NamespacedName
+	scopes []string
 }
 
-type atomicIncrementalVersionner struct {
-	version uint64
+// visibleTo reports if a client of the given scope may see the service.
+func (s scopedService) visibleTo(scope string) bool {
+	if len(s.scopes) == 0 {
+		return true
+	}
+
+	for _, sc := range s.scopes {
+		if sc == scope {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (v *atomicIncrementalVersionner) GetVersion() string {
-	return strconv.FormatUint(atomic.AddUint64(&v.version, 1), 10)
+// checkListenersUnicity makes sure that a pod port is not claimed by two XDSServers.
+func checkListenersUnicity(listeners []types.Resource, known map[string]struct{}) error {
+	for _, l := range listeners {
+		name := cache.GetResourceName(l)
+
+		if _, ok := known[name]; ok {
+			return fmt.Errorf("listener %q is already published by another server", name)
+		}
+	}
+
+	return nil
+}
+
+// makeResourcesVersion hashes resources, so that all the replicas publish the same version for the same state.
+// Resources are sorted by type and name, as the order of the kubernetes resources they are built from is not stable.
+func makeResourcesVersion(resources map[resource.Type][]types.Resource) (string, error) {
+	var (
+		typeURLs = make([]resource.Type, 0, len(resources))
+		hash     = fnv.New64a()
+	)
+
+	for typ := range resources {
+		typeURLs = append(typeURLs, typ)
+	}
+
+	sort.Strings(typeURLs)
+
+	for _, typ := range typeURLs {
+		items := make([]types.Resource, len(resources[typ]))
+		copy(items, resources[typ])
+
+		sort.Slice(items, func(i, j int) bool {
+			return cache.GetResourceName(items[i]) < cache.GetResourceName(items[j])
+		})
+
+		_, _ = hash.Write([]byte(typ))
+
+		for _, res := range items {
+			// Deterministic marshalling keeps the map entries ordered.
+			b, err := proto.MarshalOptions{Deterministic: true}.Marshal(res)
+			if err != nil {
+				return "", err
+			}
+
+			_, _ = hash.Write(b)
+		}
+	}
+
+	return strconv.FormatUint(hash.Sum64(), 16), nil
 }
@@ -0,0 +1,259 @@
+package kxds
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// RemoteClusterLabel marks the Secrets registering a remote cluster, named after the Secret.
+	RemoteClusterLabel = "kxds.dev/remote-cluster"
+	// RemoteClusterKubeconfigKey is the key of the kubeconfig connecting to the remote cluster in its Secret.
+	RemoteClusterKubeconfigKey = "kubeconfig"
+
+	// remoteClusterConnectTimeout bounds each attempt to discover a remote cluster.
+	remoteClusterConnectTimeout = 10 * time.Second
+)
+
+// defaultRemoteClusterBackoff spaces the attempts to connect to an unreachable remote cluster, from 1s up to 5m.
+var defaultRemoteClusterBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      5 * time.Minute,
+}
+
+// remoteClusters keeps a connection to each remote cluster registered by a Secret, and watches its endpoint slices.
+type remoteClusters struct {
+	// secrets reads the Secrets registering the remote clusters, remote clusters are disabled if not set.
+	secrets   client.Reader
+	namespace string
+	scheme    *runtime.Scheme
+
+	mu sync.Mutex
+	// ctx bounds the lifetime of the connections, it is set once the reconciler starts.
+	ctx context.Context
+	// onEvent is called with the endpoint slices events of the remote clusters, and with a nil object once a cluster is available.
+	onEvent  func(clusterName string, obj client.Object)
+	clusters map[string]*remoteCluster
+	// backoff spaces the connection attempts of each cluster.
+	backoff wait.Backoff
+}
+
+type remoteCluster struct {
+	kubeconfig []byte
+	// reader and available are set once the endpoint slices of the cluster are synced.
+	reader    client.Reader
+	available bool
+	cancel    context.CancelFunc
+}
+
+func newRemoteClusters() *remoteClusters {
+	return &remoteClusters{
+		clusters: make(map[string]*remoteCluster),
+		backoff:  defaultRemoteClusterBackoff,
+	}
+}
+
+// start allows to connect to the remote clusters, until the given context is done.
+func (r *remoteClusters) start(ctx context.Context, onEvent func(clusterName string, obj client.Object)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx = ctx
+	r.onEvent = onEvent
+}
+
+// sync connects to the clusters registered by the Secrets, reconnects to the ones whose kubeconfig changed, and disconnects from the ones no longer registered.
+// Connections run in the background, refreshes publish the endpoints of the clusters available meanwhile.
+func (r *remoteClusters) sync(ctx context.Context) error {
+	if r.secrets == nil {
+		return nil
+	}
+
+	var secrets corev1.SecretList
+
+	if err := r.secrets.List(ctx, &secrets, client.InNamespace(r.namespace), client.HasLabels{RemoteClusterLabel}); err != nil {
+		return fmt.Errorf("could not gather remote clusters secrets list %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx == nil {
+		return nil
+	}
+
+	registered := make(map[string]struct{}, len(secrets.Items))
+
+	for _, secret := range secrets.Items {
+		registered[secret.Name] = struct{}{}
+
+		kubeconfig := secret.Data[RemoteClusterKubeconfigKey]
+
+		if current, ok := r.clusters[secret.Name]; ok {
+			if string(current.kubeconfig) == string(kubeconfig) {
+				continue
+			}
+
+			current.cancel()
+		}
+
+		remoteCtx, cancel := context.WithCancel(r.ctx)
+		remote := &remoteCluster{kubeconfig: kubeconfig, cancel: cancel}
+
+		r.clusters[secret.Name] = remote
+
+		go r.connect(remoteCtx, secret.Name, remote, r.onEvent)
+	}
+
+	for name, remote := range r.clusters {
+		if _, ok := registered[name]; ok {
+			continue
+		}
+
+		remote.cancel()
+		delete(r.clusters, name)
+	}
+
+	return nil
+}
+
+// connect watches the endpoint slices of a remote cluster until the given context is done.
+// Failed attempts are retried with an exponential backoff, an invalid kubeconfig is only retried once its Secret changes.
+func (r *remoteClusters) connect(ctx context.Context, name string, remote *remoteCluster, onEvent func(clusterName string, obj client.Object)) {
+	logger := log.FromContext(ctx).WithValues("cluster", name)
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(remote.kubeconfig)
+	if err != nil {
+		logger.Error(err, "invalid remote cluster kubeconfig")
+		return
+	}
+
+	backoff := r.backoff
+
+	for {
+		err := r.watch(ctx, name, cfg, remote, onEvent)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		delay := backoff.Step()
+
+		logger.Error(err, "unable to connect to remote cluster", "retryIn", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watch starts watching the endpoint slices of a remote cluster in the background, and marks it available once they are synced.
+func (r *remoteClusters) watch(ctx context.Context, name string, cfg *rest.Config, remote *remoteCluster, onEvent func(clusterName string, obj client.Object)) error {
+	cl, err := cluster.New(cfg, func(o *cluster.Options) {
+		o.Scheme = r.scheme
+		o.MapperProvider = func(c *rest.Config) (meta.RESTMapper, error) {
+			// Discovery ignores contexts, bound its requests by a timeout instead.
+			discoveryCfg := rest.CopyConfig(c)
+			discoveryCfg.Timeout = remoteClusterConnectTimeout
+
+			return apiutil.NewDynamicRESTMapper(discoveryCfg, apiutil.WithLazyDiscovery)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	informerCtx, cancelInformer := context.WithTimeout(ctx, remoteClusterConnectTimeout)
+	defer cancelInformer()
+
+	informer, err := cl.GetCache().GetInformer(informerCtx, &discoveryv1.EndpointSlice{})
+	if err != nil {
+		return err
+	}
+
+	notify := func(obj interface{}) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+
+		if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+			onEvent(name, slice)
+		}
+	}
+
+	informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, obj interface{}) { notify(obj) },
+		DeleteFunc: notify,
+	})
+
+	go func() {
+		if err := cl.Start(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "unable to watch remote cluster", "cluster", name)
+		}
+	}()
+
+	go func() {
+		if !cl.GetCache().WaitForCacheSync(ctx) {
+			return
+		}
+
+		r.mu.Lock()
+		remote.reader = cl.GetClient()
+		remote.available = true
+		r.mu.Unlock()
+
+		onEvent(name, nil)
+	}()
+
+	return nil
+}
+
+// endpointSlices returns the endpoint slices of each kubernetes service of the available remote clusters, by cluster name.
+func (r *remoteClusters) endpointSlices(ctx context.Context) (map[string]map[ktypes.NamespacedName][]discoveryv1.EndpointSlice, error) {
+	r.mu.Lock()
+	available := make(map[string]client.Reader, len(r.clusters))
+	for name, remote := range r.clusters {
+		if remote.available {
+			available[name] = remote.reader
+		}
+	}
+	r.mu.Unlock()
+
+	result := make(map[string]map[ktypes.NamespacedName][]discoveryv1.EndpointSlice, len(available))
+
+	for name, reader := range available {
+		var endpointSlices discoveryv1.EndpointSliceList
+
+		// A failing cluster is reported as unavailable, it must not hold back the others.
+		if err := reader.List(ctx, &endpointSlices); err != nil {
+			log.FromContext(ctx).Error(err, "could not gather endpoint slices list of remote cluster", "cluster", name)
+			continue
+		}
+
+		result[name] = mapEndpointSlicesByService(endpointSlices.Items)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package kxds
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	"github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+)
+
+// ScopedSnapshotCache is a snapshot cache keyed by the scope of the clients.
+// Clients of a scope without a snapshot are served the default snapshot, until a refresh publishes their own.
+type ScopedSnapshotCache struct {
+	cache.SnapshotCache
+
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func NewScopedSnapshotCache(logger log.Logger) *ScopedSnapshotCache {
+	return &ScopedSnapshotCache{
+		SnapshotCache: cache.NewSnapshotCache(false, ScopeHash{}, logger),
+		keys:          make(map[string]struct{}),
+	}
+}
+
+// Watches are created under the lock, for their snapshot not to expire meanwhile.
+func (c *ScopedSnapshotCache) CreateWatch(req *cache.Request, state stream.StreamState, value chan cache.Response) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ensureSnapshot(req.Node)
+
+	return c.SnapshotCache.CreateWatch(req, state, value)
+}
+
+func (c *ScopedSnapshotCache) CreateDeltaWatch(req *cache.DeltaRequest, state stream.StreamState, value chan cache.DeltaResponse) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ensureSnapshot(req.Node)
+
+	return c.SnapshotCache.CreateDeltaWatch(req, state, value)
+}
+
+func (c *ScopedSnapshotCache) Fetch(ctx context.Context, req *cache.Request) (cache.Response, error) {
+	c.mu.Lock()
+	c.ensureSnapshot(req.Node)
+	c.mu.Unlock()
+
+	return c.SnapshotCache.Fetch(ctx, req)
+}
+
+func (c *ScopedSnapshotCache) SetSnapshot(ctx context.Context, key string, snapshot cache.ResourceSnapshot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[key] = struct{}{}
+
+	return c.SnapshotCache.SetSnapshot(ctx, key, snapshot)
+}
+
+// Keys returns the keys of all the published snapshots.
+func (c *ScopedSnapshotCache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.keys))
+	for key := range c.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// expireKeys drops the snapshots no client watches anymore, except the ones of the given keys.
+// Every authenticated namespace gets a scope, expiring the scopes no service declares bounds the snapshots by the connected clients.
+func (c *ScopedSnapshotCache) expireKeys(keep map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	watched := make(map[string]struct{})
+	for _, key := range c.SnapshotCache.GetStatusKeys() {
+		if info := c.SnapshotCache.GetStatusInfo(key); info.GetNumWatches() > 0 || info.GetNumDeltaWatches() > 0 {
+			watched[key] = struct{}{}
+		}
+	}
+
+	for key := range c.keys {
+		if _, ok := keep[key]; ok {
+			continue
+		}
+
+		if _, ok := watched[key]; ok {
+			continue
+		}
+
+		c.SnapshotCache.ClearSnapshot(key)
+		delete(c.keys, key)
+	}
+}
+
+// ensureSnapshot publishes the default snapshot for the scope of a client if it has none yet, it must be called under the lock.
+// Services restricted to scopes are never part of the default snapshot, it is what a client of an unknown scope may see.
+func (c *ScopedSnapshotCache) ensureSnapshot(node *corev3.Node) {
+	key := ScopeHash{}.ID(node)
+
+	if _, ok := c.keys[key]; ok {
+		return
+	}
+
+	snapshot, err := c.SnapshotCache.GetSnapshot(DefautHashKey)
+	if err != nil {
+		return
+	}
+
+	c.keys[key] = struct{}{}
+
+	_ = c.SnapshotCache.SetSnapshot(context.Background(), key, snapshot)
+}
@@ -2,15 +2,18 @@ package kxds
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
 
 	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	lrsv3 "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v3"
+	statusv3 "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
-	"github.com/envoyproxy/go-control-plane/pkg/test/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -24,6 +27,16 @@ const (
 
 type XDSServerConfig struct {
 	BindAddr string
+	// LoadReporting serves the Load Reporting Service if set.
+	LoadReporting *LoadReportingServer
+	// Metrics records the activity of the xDS clients, unregistered metrics are used if not set.
+	Metrics *ServerMetrics
+	// AckObserver is notified of the ACKs and NACKs of the clients if set.
+	AckObserver AckObserver
+	// TLS makes the server serve TLS if set, and optionally require client certificates.
+	TLS *ServerTLSConfig
+	// TokenAuth makes the server require a kubernetes ServiceAccount token from the clients if set.
+	TokenAuth *TokenReviewAuthenticator
 }
 
 type XDSServer struct {
@@ -38,14 +51,35 @@ func NewXDSServer(cache cache.Cache, cfg XDSServerConfig) *XDSServer {
 	}
 }
 
+// NeedLeaderElection makes all the replicas serve xDS, not only the elected one.
+func (s *XDSServer) NeedLeaderElection() bool {
+	return false
+}
+
 func (s *XDSServer) Start(ctx context.Context) error {
+	if s.cfg.TokenAuth != nil {
+		// Clients would send their token in plaintext otherwise.
+		if s.cfg.TLS == nil {
+			return errors.New("token authentication requires the xDS server to serve TLS")
+		}
+
+		if err := s.cfg.TokenAuth.validate(); err != nil {
+			return err
+		}
+	}
+
+	metrics := s.cfg.Metrics
+	if metrics == nil {
+		metrics = NewServerMetrics()
+	}
+
 	var (
-		logger = log.FromContext(ctx)
-		cb     = test.Callbacks{Debug: true}
-		server = server.NewServer(ctx, s.xdsCache, &cb)
+		logger  = log.FromContext(ctx)
+		tracker = NewClientStatusTracker(metrics, s.cfg.AckObserver)
+		server  = server.NewServer(ctx, s.xdsCache, tracker)
 	)
 
-	grpcServer := grpc.NewServer(
+	grpcOpts := []grpc.ServerOption{
 		grpc.MaxConcurrentStreams(grpcMaxConcurrentStreams),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			Time:    grpcKeepaliveTime,
@@ -55,11 +89,53 @@ func (s *XDSServer) Start(ctx context.Context) error {
 			MinTime:             grpcKeepaliveMinTime,
 			PermitWithoutStream: true,
 		}),
-	)
+	}
+
+	if s.cfg.TLS != nil {
+		tlsConfig, certWatcher, err := s.cfg.TLS.makeTLSConfig()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := certWatcher.Start(ctx); err != nil {
+				logger.Error(err, "unable to watch the xDS server certificate")
+			}
+		}()
 
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	// Scopes are set from the identity of the clients, it must be known first.
+	streamInterceptors := []grpc.StreamServerInterceptor{scopeStreamInterceptor}
+
+	if s.cfg.TokenAuth != nil {
+		streamInterceptors = append([]grpc.StreamServerInterceptor{s.cfg.TokenAuth.streamInterceptor}, streamInterceptors...)
+		grpcOpts = append(grpcOpts, grpc.UnaryInterceptor(s.cfg.TokenAuth.unaryInterceptor))
+	}
+
+	grpcOpts = append(grpcOpts, grpc.ChainStreamInterceptor(streamInterceptors...))
+
+	grpcServer := grpc.NewServer(grpcOpts...)
+
+	// ADS is served in both its state of the world and incremental variants.
+	// The snapshot cache versions each resource by its hash, incremental clients only receive the resources that changed.
 	discoveryv3.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
+	statusv3.RegisterClientStatusDiscoveryServiceServer(grpcServer, tracker)
 
-	logger.Info("Starting xDS server", "bindAddress", s.cfg.BindAddr)
+	if s.cfg.LoadReporting != nil {
+		lrsv3.RegisterLoadReportingServiceServer(grpcServer, s.cfg.LoadReporting)
+	}
+
+	logger.Info(
+		"Starting xDS server",
+		"bindAddress",
+		s.cfg.BindAddr,
+		"tls",
+		s.cfg.TLS != nil,
+		"tokenAuth",
+		s.cfg.TokenAuth != nil,
+	)
 
 	lis, err := net.Listen("tcp", s.cfg.BindAddr)
 	if err != nil {
@@ -0,0 +1,80 @@
+package kxds
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// CacheTransforms strips the pods and nodes down to the fields kxds reads before they are cached.
+// Every replica caches all the pods and nodes of the cluster, keeping them whole would make its memory grow with their specs and statuses.
+func CacheTransforms() cache.TransformByObject {
+	return cache.TransformByObject{
+		&corev1.Pod{}:  transformPod,
+		&corev1.Node{}: transformNode,
+	}
+}
+
+func transformPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+
+	pruned := &corev1.Pod{
+		TypeMeta: pod.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pod.Name,
+			Namespace:         pod.Namespace,
+			UID:               pod.UID,
+			ResourceVersion:   pod.ResourceVersion,
+			DeletionTimestamp: pod.DeletionTimestamp,
+			Labels:            pod.Labels,
+		},
+		Status: corev1.PodStatus{
+			PodIP:  pod.Status.PodIP,
+			PodIPs: pod.Status.PodIPs,
+		},
+	}
+
+	if weight, ok := pod.Annotations[EndpointWeightAnnotation]; ok {
+		pruned.Annotations = map[string]string{EndpointWeightAnnotation: weight}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		pruned.Spec.Containers = append(pruned.Spec.Containers, corev1.Container{
+			Name:  container.Name,
+			Ports: container.Ports,
+		})
+	}
+
+	return pruned, nil
+}
+
+func transformNode(obj interface{}) (interface{}, error) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return obj, nil
+	}
+
+	pruned := &corev1.Node{
+		TypeMeta: node.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            node.Name,
+			UID:             node.UID,
+			ResourceVersion: node.ResourceVersion,
+		},
+	}
+
+	for _, key := range []string{corev1.LabelTopologyRegion, corev1.LabelTopologyZone} {
+		if value, ok := node.Labels[key]; ok {
+			if pruned.Labels == nil {
+				pruned.Labels = make(map[string]string, 2)
+			}
+
+			pruned.Labels[key] = value
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,235 @@
+package kxds
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+// translationCache keeps the xDS resources of each XDSService, along with the kubernetes state they have been translated from.
+// An XDSService is only translated again if its spec or one of the kubernetes resources it depends on changed.
+type translationCache struct {
+	translations map[ktypes.NamespacedName]translation
+	// failures counts the failed translations of each XDSService.
+	failures *prometheus.CounterVec
+}
+
+type translation struct {
+	inputs     translationInputs
+	xdsService xdsService
+	err        error
+}
+
+// translationInputs holds everything the translation of an XDSService depends on.
+type translationInputs struct {
+	spec kxdsv1alpha1.XDSServiceSpec
+	// endpointSlices holds the endpoint slices of the kubernetes services referenced by the XDSService.
+	endpointSlices map[serviceReference][]discoveryv1.EndpointSlice
+	// nodeTopologies holds the topology of the nodes, only set if a locality is split by zone.
+	nodeTopologies map[string]endpointTopology
+	// dnsAddresses holds the addresses resolved for the hostnames referenced by the XDSService.
+	dnsAddresses map[string][]string
+	// endpointWeights holds the weights of the pods backing the kubernetes services referenced by the XDSService.
+	endpointWeights map[ktypes.NamespacedName]uint32
+	// remoteClusters holds the availability of the remote clusters referenced by the XDSService.
+	remoteClusters map[string]bool
+}
+
+func (i translationInputs) equal(other translationInputs) bool {
+	return equality.Semantic.DeepEqual(i.spec, other.spec) &&
+		equality.Semantic.DeepEqual(i.endpointSlices, other.endpointSlices) &&
+		equality.Semantic.DeepEqual(i.nodeTopologies, other.nodeTopologies) &&
+		equality.Semantic.DeepEqual(i.dnsAddresses, other.dnsAddresses) &&
+		equality.Semantic.DeepEqual(i.endpointWeights, other.endpointWeights) &&
+		equality.Semantic.DeepEqual(i.remoteClusters, other.remoteClusters)
+}
+
+func newTranslationCache(failures *prometheus.CounterVec) *translationCache {
+	return &translationCache{
+		translations: make(map[ktypes.NamespacedName]translation),
+		failures:     failures,
+	}
+}
+
+// translate returns the xDS resources of all the given services, translating only the ones whose inputs changed.
+// Translations of the services no longer present are dropped, along with their failures series.
+func (c *translationCache) translate(state K8sState, translated func(svc kxdsv1alpha1.XDSService, xdsSvc xdsService, err error)) {
+	var (
+		translations = make(map[ktypes.NamespacedName]translation, len(state.Services))
+		topologies   = makeNodeTopologies(state.Nodes)
+	)
+
+	state.endpointWeights = makeEndpointWeights(state.Pods)
+
+	for _, svc := range state.Services {
+		var (
+			svcName = ktypes.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}
+			inputs  = makeTranslationInputs(svc, state, topologies)
+		)
+
+		tr, ok := c.translations[svcName]
+		if !ok || !tr.inputs.equal(inputs) {
+			tr.inputs = inputs
+			tr.xdsService, tr.err = makeXDSService(svc, state)
+
+			if tr.err != nil {
+				c.failures.WithLabelValues(svc.Namespace, svc.Name).Inc()
+			}
+		}
+
+		translations[svcName] = tr
+
+		translated(svc, tr.xdsService, tr.err)
+	}
+
+	// Drop the failures series of the services which have been removed.
+	for svcName := range c.translations {
+		if _, ok := translations[svcName]; !ok {
+			c.failures.DeleteLabelValues(svcName.Namespace, svcName.Name)
+		}
+	}
+
+	c.translations = translations
+}
+
+func makeTranslationInputs(svc kxdsv1alpha1.XDSService, state K8sState, topologies map[string]endpointTopology) translationInputs {
+	inputs := translationInputs{
+		spec:           *svc.Spec.DeepCopy(),
+		endpointSlices: make(map[serviceReference][]discoveryv1.EndpointSlice),
+	}
+
+	for _, svcRef := range serviceReferences(svc) {
+		slices, _ := state.serviceEndpointSlices(svcRef)
+
+		// Sort a copy of the slices, for the comparison not to depend on the order they are listed in.
+		slices = append([]discoveryv1.EndpointSlice(nil), slices...)
+		sortEndpointSlices(slices)
+
+		inputs.endpointSlices[svcRef] = slices
+
+		// Pods of remote clusters are not watched.
+		if svcRef.cluster != "" {
+			if inputs.remoteClusters == nil {
+				inputs.remoteClusters = make(map[string]bool)
+			}
+
+			_, inputs.remoteClusters[svcRef.cluster] = state.RemoteEndpointSlices[svcRef.cluster]
+
+			continue
+		}
+
+		for _, slice := range slices {
+			for _, ep := range slice.Endpoints {
+				pod, ok := lookupEndpointPod(slice.Namespace, ep)
+				if !ok || state.endpointWeights[pod] == 0 {
+					continue
+				}
+
+				if inputs.endpointWeights == nil {
+					inputs.endpointWeights = make(map[ktypes.NamespacedName]uint32)
+				}
+
+				inputs.endpointWeights[pod] = state.endpointWeights[pod]
+			}
+		}
+	}
+
+	for _, hostname := range dnsHostnames(svc) {
+		if inputs.dnsAddresses == nil {
+			inputs.dnsAddresses = make(map[string][]string)
+		}
+
+		// Unresolved hostnames are left out, to tell them apart from hostnames resolved to no address.
+		if addrs, ok := state.DNSAddresses[hostname]; ok {
+			inputs.dnsAddresses[hostname] = addrs
+		}
+	}
+
+	for _, clusterSpec := range svc.Spec.Clusters {
+		for _, locSpec := range clusterSpec.Localities {
+			if locSpec.SplitByZone {
+				inputs.nodeTopologies = topologies
+			}
+		}
+	}
+
+	return inputs
+}
+
+// makeNodeTopologies extracts the topology of the nodes, as nodes are updated way more often than their labels.
+func makeNodeTopologies(nodes map[string]corev1.Node) map[string]endpointTopology {
+	topologies := make(map[string]endpointTopology, len(nodes))
+
+	for name, node := range nodes {
+		topologies[name] = endpointTopology{
+			region: node.Labels[corev1.LabelTopologyRegion],
+			zone:   node.Labels[corev1.LabelTopologyZone],
+		}
+	}
+
+	return topologies
+}
+
+// serviceReference identifies a kubernetes service, running in the cluster of kxds if cluster is empty.
+type serviceReference struct {
+	cluster string
+	ktypes.NamespacedName
+}
+
+func (r serviceReference) String() string {
+	if r.cluster == "" {
+		return r.NamespacedName.String()
+	}
+
+	return r.cluster + "/" + r.NamespacedName.String()
+}
+
+// makeServiceReference returns the kubernetes service of a locality, services are in the namespace of the XDSService by default.
+func makeServiceReference(currentNamespace string, svc *kxdsv1alpha1.K8sService) serviceReference {
+	ref := serviceReference{
+		cluster:        svc.Cluster,
+		NamespacedName: ktypes.NamespacedName{Namespace: svc.Namespace, Name: svc.Name},
+	}
+
+	if ref.Namespace == "" {
+		ref.Namespace = currentNamespace
+	}
+
+	return ref
+}
+
+// serviceReferences returns the kubernetes services referenced by the localities of an XDSService.
+func serviceReferences(svc kxdsv1alpha1.XDSService) []serviceReference {
+	var refs []serviceReference
+
+	for _, clusterSpec := range svc.Spec.Clusters {
+		for _, locSpec := range clusterSpec.Localities {
+			if locSpec.Service == nil {
+				continue
+			}
+
+			refs = append(refs, makeServiceReference(svc.Namespace, locSpec.Service))
+		}
+	}
+
+	return refs
+}
+
+// dnsHostnames returns the hostnames referenced by the DNS localities of an XDSService.
+func dnsHostnames(svc kxdsv1alpha1.XDSService) []string {
+	var hostnames []string
+
+	for _, clusterSpec := range svc.Spec.Clusters {
+		for _, locSpec := range clusterSpec.Localities {
+			if locSpec.DNS != nil {
+				hostnames = append(hostnames, locSpec.DNS.Hostname)
+			}
+		}
+	}
+
+	return hostnames
+}
@@ -0,0 +1,77 @@
+package kxds
+
+import (
+	"context"
+	"fmt"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/validate-api-kxds-dev-v1alpha1-xdsservice,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.kxds.dev,resources=xdsservices,verbs=create;update,versions=v1alpha1,name=vxdsservice.kxds.dev,admissionReviewVersions=v1
+
+// XDSServiceValidator rejects the XDSServices that can't be translated to xDS resources.
+type XDSServiceValidator struct{}
+
+var _ admission.CustomValidator = XDSServiceValidator{}
+
+func (v XDSServiceValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return validateXDSService(ctx, obj)
+}
+
+func (v XDSServiceValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) error {
+	return validateXDSService(ctx, newObj)
+}
+
+func (v XDSServiceValidator) ValidateDelete(context.Context, runtime.Object) error {
+	return nil
+}
+
+// validateXDSService runs the translation of the service, as if all the kubernetes services and hostnames it references had no endpoints.
+func validateXDSService(ctx context.Context, obj runtime.Object) error {
+	svc, ok := obj.(*kxdsv1alpha1.XDSService)
+	if !ok {
+		return fmt.Errorf("expected an XDSService, got %T", obj)
+	}
+
+	svc = svc.DeepCopy()
+
+	// The namespace might not be set yet on the object when created.
+	if req, err := admission.RequestFromContext(ctx); err == nil && svc.Namespace == "" {
+		svc.Namespace = req.Namespace
+	}
+
+	state := K8sState{
+		EndpointSlices:       make(map[ktypes.NamespacedName][]discoveryv1.EndpointSlice),
+		DNSAddresses:         make(map[string][]string),
+		RemoteEndpointSlices: make(map[string]map[ktypes.NamespacedName][]discoveryv1.EndpointSlice),
+	}
+
+	for _, svcRef := range serviceReferences(*svc) {
+		if svcRef.cluster == "" {
+			state.EndpointSlices[svcRef.NamespacedName] = nil
+			continue
+		}
+
+		// Remote clusters can be registered after the service.
+		if state.RemoteEndpointSlices[svcRef.cluster] == nil {
+			state.RemoteEndpointSlices[svcRef.cluster] = make(map[ktypes.NamespacedName][]discoveryv1.EndpointSlice)
+		}
+
+		state.RemoteEndpointSlices[svcRef.cluster][svcRef.NamespacedName] = nil
+	}
+
+	for _, hostname := range dnsHostnames(*svc) {
+		state.DNSAddresses[hostname] = nil
+	}
+
+	if _, err := makeXDSService(*svc, state); err != nil {
+		return fmt.Errorf("invalid xds service: %w", err)
+	}
+
+	return nil
+}
@@ -3,7 +3,11 @@ package kxds
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
@@ -15,6 +19,12 @@ import (
 	faultv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
 	router "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wrrv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/load_balancing_policies/client_side_weighted_round_robin/v3"
+	leastrequestv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/load_balancing_policies/least_request/v3"
+	pickfirstv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/load_balancing_policies/pick_first/v3"
+	roundrobinv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/load_balancing_policies/round_robin/v3"
+	wrrlocalityv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/load_balancing_policies/wrr_locality/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
@@ -24,6 +34,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 	kcorev1 "k8s.io/api/core/v1"
+	kdiscoveryv1 "k8s.io/api/discovery/v1"
 	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
 
@@ -35,9 +46,11 @@ type xdsService struct {
 	routeConfig     types.Resource
 	clusters        []types.Resource
 	loadAssignments []types.Resource
+	// warnings lists the problems the service has been published despite, such as unavailable endpoints.
+	warnings []string
 }
 
-func makeXDSService(svc kxdsv1alpha1.XDSService, k8sEndpoints map[ktypes.NamespacedName]kcorev1.Endpoints) (xdsService, error) {
+func makeXDSService(svc kxdsv1alpha1.XDSService, state K8sState) (xdsService, error) {
 	var (
 		err error
 
@@ -55,7 +68,7 @@ func makeXDSService(svc kxdsv1alpha1.XDSService, k8sEndpoints map[ktypes.Namespa
 		return xdsSvc, err
 	}
 
-	xdsSvc.routeConfig, err = makeRouteConfig(resourcePrefix, routeConfigName, listenerName, svc.Spec.Routes)
+	xdsSvc.routeConfig, err = makeRouteConfig(resourcePrefix, routeConfigName, listenerName, svc.Spec)
 	if err != nil {
 		return xdsSvc, err
 	}
@@ -63,19 +76,23 @@ func makeXDSService(svc kxdsv1alpha1.XDSService, k8sEndpoints map[ktypes.Namespa
 	for i, clusterSpec := range svc.Spec.Clusters {
 		clusterName := resourcePrefix + clusterSpec.Name
 
-		xdsSvc.clusters[i] = makeCluster(clusterName, clusterSpec)
+		xdsSvc.clusters[i], err = makeCluster(clusterName, clusterSpec)
+		if err != nil {
+			return xdsSvc, err
+		}
 
-		loadAssignment, err := makeLoadAssignment(
+		loadAssignment, warnings, err := makeLoadAssignment(
 			clusterName,
 			svc.Namespace,
 			clusterSpec.Localities,
-			k8sEndpoints,
+			state,
 		)
 		if err != nil {
 			return xdsSvc, err
 		}
 
 		xdsSvc.loadAssignments = append(xdsSvc.loadAssignments, loadAssignment)
+		xdsSvc.warnings = append(xdsSvc.warnings, warnings...)
 	}
 
 	return xdsSvc, nil
@@ -126,6 +143,18 @@ func makeFilter(filter kxdsv1alpha1.Filter) (*hcm.HttpFilter, error) {
 				TypedConfig: mustAny(faultFilter),
 			},
 		}, nil
+	case filter.RBAC != nil:
+		rbacFilter, err := makeRBACFilter(filter.RBAC)
+		if err != nil {
+			return nil, err
+		}
+
+		return &hcm.HttpFilter{
+			Name: wellknown.HTTPRoleBasedAccessControl,
+			ConfigType: &hcm.HttpFilter_TypedConfig{
+				TypedConfig: mustAny(rbacFilter),
+			},
+		}, nil
 	default:
 		return nil, errors.New("malformed filter")
 	}
@@ -196,6 +225,11 @@ func makeFaultFilter(f *kxdsv1alpha1.FaultFilter) (*faultv3.HTTPFault, error) {
 }
 
 func makeListener(listenerName string, svc kxdsv1alpha1.XDSService, routeConfigName string) (*listener.Listener, error) {
+	// gRPC clients reject listeners configuring server only filters.
+	if hasRBACFilter(svc.Spec.Filters) {
+		return nil, errors.New("rbac filter is only supported on servers")
+	}
+
 	filters, err := makeFilters(svc.Spec.Filters)
 
 	if err != nil {
@@ -226,15 +260,37 @@ func makeListener(listenerName string, svc kxdsv1alpha1.XDSService, routeConfigN
 	}, nil
 }
 
-func makeRouteConfig(resourcePrefix, routeConfigName, listenerName string, routeSpecs []kxdsv1alpha1.Route) (*route.RouteConfiguration, error) {
-	routes := make([]*route.Route, len(routeSpecs))
+func makeRouteConfig(resourcePrefix, routeConfigName, listenerName string, spec kxdsv1alpha1.XDSServiceSpec) (*route.RouteConfiguration, error) {
+	var (
+		routes       = make([]*route.Route, len(spec.Routes))
+		clusterNames = make(map[string]struct{}, len(spec.Clusters))
+	)
+
+	for _, clusterSpec := range spec.Clusters {
+		clusterNames[clusterSpec.Name] = struct{}{}
+	}
 
-	for i, routeSpec := range routeSpecs {
+	for i, routeSpec := range spec.Routes {
 		match, err := makeRouteMatch(routeSpec)
 		if err != nil {
 			return nil, err
 		}
 
+		hashPolicies, err := makeHashPolicies(routeSpec.HashPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		retryPolicy, err := makeRetryPolicy(routeSpec.RetryPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		weightedClusters, err := makeWeightedClusters(resourcePrefix, routeSpec, clusterNames)
+		if err != nil {
+			return nil, err
+		}
+
 		routes[i] = &route.Route{
 			Match: match,
 			Action: &route.Route_Route{
@@ -244,26 +300,114 @@ func makeRouteConfig(resourcePrefix, routeConfigName, listenerName string, route
 						GrpcTimeoutHeaderMax: makeDuration(routeSpec.GrpcTimeoutHeaderMax),
 					},
 					ClusterSpecifier: &route.RouteAction_WeightedClusters{
-						WeightedClusters: makeWeightedClusters(resourcePrefix, routeSpec),
+						WeightedClusters: weightedClusters,
 					},
+					HashPolicy:  hashPolicies,
+					RetryPolicy: retryPolicy,
 				},
 			},
 		}
 	}
 
+	vhostRetryPolicy, err := makeRetryPolicy(spec.RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// gRPC clients match the virtual hosts against the authority of their channel.
+	// Older versions use the dialed target as is, recent ones escape its "/", which the authority can't hold.
+	domains := []string{listenerName, url.PathEscape(listenerName)}
+
 	return &route.RouteConfiguration{
 		Name:             routeConfigName,
 		ValidateClusters: &wrapperspb.BoolValue{Value: true},
 		VirtualHosts: []*route.VirtualHost{
 			{
-				Name:    resourcePrefix + "vhost",
-				Domains: []string{listenerName},
-				Routes:  routes,
+				Name:        resourcePrefix + "vhost",
+				Domains:     domains,
+				Routes:      routes,
+				RetryPolicy: vhostRetryPolicy,
 			},
 		},
 	}, nil
 }
 
+func makeRetryPolicy(spec *kxdsv1alpha1.RetryPolicy) (*route.RetryPolicy, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	if len(spec.RetryOn) == 0 {
+		return nil, errors.New("retry policy must retry on at least one status code")
+	}
+
+	retryOn := make([]string, len(spec.RetryOn))
+
+	for i, code := range spec.RetryOn {
+		retryOn[i] = string(code)
+	}
+
+	policy := route.RetryPolicy{
+		RetryOn: strings.Join(retryOn, ","),
+	}
+
+	if spec.NumRetries != nil {
+		policy.NumRetries = wrapperspb.UInt32(*spec.NumRetries)
+	}
+
+	if spec.BackOff != nil {
+		if spec.BackOff.BaseInterval == nil {
+			return nil, errors.New("retry backoff requires a base interval")
+		}
+
+		if spec.BackOff.MaxInterval != nil && spec.BackOff.MaxInterval.Duration < spec.BackOff.BaseInterval.Duration {
+			return nil, errors.New("retry backoff max interval is lower than base interval")
+		}
+
+		policy.RetryBackOff = &route.RetryPolicy_RetryBackOff{
+			BaseInterval: makeDuration(spec.BackOff.BaseInterval),
+			MaxInterval:  makeDuration(spec.BackOff.MaxInterval),
+		}
+	}
+
+	return &policy, nil
+}
+
+func makeHashPolicies(specs []kxdsv1alpha1.HashPolicy) ([]*route.RouteAction_HashPolicy, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	policies := make([]*route.RouteAction_HashPolicy, len(specs))
+
+	for i, spec := range specs {
+		policy := route.RouteAction_HashPolicy{
+			Terminal: spec.Terminal,
+		}
+
+		switch {
+		case spec.Header != nil:
+			policy.PolicySpecifier = &route.RouteAction_HashPolicy_Header_{
+				Header: &route.RouteAction_HashPolicy_Header{
+					HeaderName: spec.Header.Name,
+				},
+			}
+		case spec.FilterState != nil:
+			policy.PolicySpecifier = &route.RouteAction_HashPolicy_FilterState_{
+				FilterState: &route.RouteAction_HashPolicy_FilterState{
+					Key: spec.FilterState.Key,
+				},
+			}
+		default:
+			return nil, errors.New("malformed hash policy")
+		}
+
+		policies[i] = &policy
+	}
+
+	return policies, nil
+}
+
 func makeRouteMatch(spec kxdsv1alpha1.Route) (*route.RouteMatch, error) {
 	var match route.RouteMatch
 
@@ -378,13 +522,17 @@ func makeRegexMatcher(spec *kxdsv1alpha1.RegexMatcher) (*matcher.RegexMatcher, e
 	}, nil
 }
 
-func makeWeightedClusters(resourcePrefix string, routeSpec kxdsv1alpha1.Route) *route.WeightedCluster {
+func makeWeightedClusters(resourcePrefix string, routeSpec kxdsv1alpha1.Route, clusterNames map[string]struct{}) (*route.WeightedCluster, error) {
 	var (
 		totalWeight     uint32
 		weighedClusters = make([]*route.WeightedCluster_ClusterWeight, len(routeSpec.Clusters))
 	)
 
 	for i, clusterRef := range routeSpec.Clusters {
+		if _, ok := clusterNames[clusterRef.Name]; !ok {
+			return nil, fmt.Errorf("route references unknown cluster %q", clusterRef.Name)
+		}
+
 		totalWeight += clusterRef.Weight
 		weighedClusters[i] = &route.WeightedCluster_ClusterWeight{
 			Name:   resourcePrefix + clusterRef.Name,
@@ -395,10 +543,10 @@ func makeWeightedClusters(resourcePrefix string, routeSpec kxdsv1alpha1.Route) *
 	return &route.WeightedCluster{
 		TotalWeight: wrapperspb.UInt32(totalWeight),
 		Clusters:    weighedClusters,
-	}
+	}, nil
 }
 
-func makeCluster(clusterName string, spec kxdsv1alpha1.Cluster) *cluster.Cluster {
+func makeCluster(clusterName string, spec kxdsv1alpha1.Cluster) (*cluster.Cluster, error) {
 	c := cluster.Cluster{
 		Name:                 clusterName,
 		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
@@ -410,7 +558,28 @@ func makeCluster(clusterName string, spec kxdsv1alpha1.Cluster) *cluster.Cluster
 			},
 			ServiceName: clusterName,
 		},
-		LbPolicy: cluster.Cluster_ROUND_ROBIN,
+	}
+
+	if err := setLBPolicy(&c, spec.LBPolicy); err != nil {
+		return nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+	}
+
+	if spec.TLS != nil {
+		transportSocket, err := makeUpstreamTransportSocket(spec.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+		}
+
+		c.TransportSocket = transportSocket
+	}
+
+	// Clients report their load to the management server they got the cluster from.
+	if spec.LoadReporting {
+		c.LrsServer = &core.ConfigSource{
+			ConfigSourceSpecifier: &core.ConfigSource_Self{
+				Self: &core.SelfConfigSource{},
+			},
+		}
 	}
 
 	// gRPC xDS only supports max requests, and will always look to the first value of the first threshold.
@@ -424,109 +593,669 @@ func makeCluster(clusterName string, spec kxdsv1alpha1.Cluster) *cluster.Cluster
 		}
 	}
 
-	return &c
+	return &c, nil
 }
 
-func makeLoadAssignment(clusterName, currentNamespace string, localities []kxdsv1alpha1.Locality, k8sEndpoints map[ktypes.NamespacedName]kcorev1.Endpoints) (*endpoint.ClusterLoadAssignment, error) {
-	xdsLocalities := make([]*endpoint.LocalityLbEndpoints, len(localities))
+func setLBPolicy(c *cluster.Cluster, spec *kxdsv1alpha1.LBPolicy) error {
+	switch {
+	case spec == nil, spec.RoundRobin != nil:
+		c.LbPolicy = cluster.Cluster_ROUND_ROBIN
+	case spec.RingHash != nil:
+		if spec.RingHash.MinRingSize != nil &&
+			spec.RingHash.MaxRingSize != nil &&
+			*spec.RingHash.MinRingSize > *spec.RingHash.MaxRingSize {
+			return errors.New("ring hash min ring size is greater than max ring size")
+		}
 
-	for i, locSpec := range localities {
-		if locSpec.Service == nil {
-			return nil, errors.New("unsupported non k8s service locality")
+		ringHashConfig := cluster.Cluster_RingHashLbConfig{
+			// gRPC only supports XX_HASH.
+			HashFunction: cluster.Cluster_RingHashLbConfig_XX_HASH,
 		}
 
-		targetNamespace := locSpec.Service.Namespace
+		if spec.RingHash.MinRingSize != nil {
+			ringHashConfig.MinimumRingSize = wrapperspb.UInt64(*spec.RingHash.MinRingSize)
+		}
 
-		if targetNamespace == "" {
-			targetNamespace = currentNamespace
+		if spec.RingHash.MaxRingSize != nil {
+			ringHashConfig.MaximumRingSize = wrapperspb.UInt64(*spec.RingHash.MaxRingSize)
 		}
 
-		k8sEndpoint, ok := k8sEndpoints[ktypes.NamespacedName{Namespace: targetNamespace, Name: locSpec.Service.Name}]
-		if !ok {
-			return nil, errors.New("no k8s endpoints found")
+		c.LbPolicy = cluster.Cluster_RING_HASH
+		c.LbConfig = &cluster.Cluster_RingHashLbConfig_{
+			RingHashLbConfig: &ringHashConfig,
+		}
+	case spec.WeightedRoundRobin != nil:
+		c.LoadBalancingPolicy = makeLoadBalancingPolicy(
+			makeWRRLocalityPolicy(
+				&core.TypedExtensionConfig{
+					Name: "envoy.load_balancing_policies.client_side_weighted_round_robin",
+					TypedConfig: mustAny(
+						&wrrv3.ClientSideWeightedRoundRobin{
+							BlackoutPeriod:         makeDuration(spec.WeightedRoundRobin.BlackoutPeriod),
+							WeightExpirationPeriod: makeDuration(spec.WeightedRoundRobin.WeightExpirationPeriod),
+							WeightUpdatePeriod:     makeDuration(spec.WeightedRoundRobin.WeightUpdatePeriod),
+						},
+					),
+				},
+			),
+		)
+	case spec.LeastRequest != nil:
+		var leastRequestConfig leastrequestv3.LeastRequest
+
+		if spec.LeastRequest.ChoiceCount != nil {
+			if *spec.LeastRequest.ChoiceCount < 2 {
+				return errors.New("least request choice count is lower than 2")
+			}
+
+			leastRequestConfig.ChoiceCount = wrapperspb.UInt32(*spec.LeastRequest.ChoiceCount)
 		}
 
+		c.LoadBalancingPolicy = makeLoadBalancingPolicy(
+			makeWRRLocalityPolicy(
+				&core.TypedExtensionConfig{
+					Name:        "envoy.load_balancing_policies.least_request",
+					TypedConfig: mustAny(&leastRequestConfig),
+				},
+				// gRPC clients skip least request unless GRPC_EXPERIMENTAL_ENABLE_LEAST_REQUEST is true, they fall back to round robin.
+				&core.TypedExtensionConfig{
+					Name:        "envoy.load_balancing_policies.round_robin",
+					TypedConfig: mustAny(&roundrobinv3.RoundRobin{}),
+				},
+			),
+		)
+	case spec.PickFirst != nil:
+		// Pick first ignores the localities: it connects to the first reachable endpoint of the cluster.
+		c.LoadBalancingPolicy = makeLoadBalancingPolicy(
+			&core.TypedExtensionConfig{
+				Name: "envoy.load_balancing_policies.pick_first",
+				TypedConfig: mustAny(
+					&pickfirstv3.PickFirst{
+						ShuffleAddressList: spec.PickFirst.ShuffleAddressList,
+					},
+				),
+			},
+		)
+	default:
+		return errors.New("malformed lb policy")
+	}
+
+	return nil
+}
+
+// makeLoadBalancingPolicy lists the given policies, clients use the first one they support.
+func makeLoadBalancingPolicy(policies ...*core.TypedExtensionConfig) *cluster.LoadBalancingPolicy {
+	lbPolicy := cluster.LoadBalancingPolicy{
+		Policies: make([]*cluster.LoadBalancingPolicy_Policy, len(policies)),
+	}
+
+	for i, policy := range policies {
+		lbPolicy.Policies[i] = &cluster.LoadBalancingPolicy_Policy{TypedExtensionConfig: policy}
+	}
+
+	return &lbPolicy
+}
+
+// makeWRRLocalityPolicy picks a locality by its weight, then an endpoint within the locality with the first given policy the client supports.
+func makeWRRLocalityPolicy(endpointPickingPolicies ...*core.TypedExtensionConfig) *core.TypedExtensionConfig {
+	return &core.TypedExtensionConfig{
+		Name: "envoy.load_balancing_policies.wrr_locality",
+		TypedConfig: mustAny(
+			&wrrlocalityv3.WrrLocality{
+				EndpointPickingPolicy: makeLoadBalancingPolicy(endpointPickingPolicies...),
+			},
+		),
+	}
+}
+
+func makeUpstreamTransportSocket(spec *kxdsv1alpha1.ClusterTLS) (*core.TransportSocket, error) {
+	if spec.CACertificate.InstanceName == "" {
+		return nil, errors.New("tls requires a CA certificate provider instance")
+	}
+
+	sanMatchers := make([]*matcher.StringMatcher, len(spec.SubjectAltNames))
+
+	for i, sanSpec := range spec.SubjectAltNames {
 		var err error
 
-		xdsLocalities[i], err = makeK8sLocality(locSpec, k8sEndpoint)
+		sanMatchers[i], err = makeStringMatcher(sanSpec)
 		if err != nil {
-			return nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+			return nil, err
 		}
+	}
+
+	tlsContext := tlsv3.UpstreamTlsContext{
+		CommonTlsContext: &tlsv3.CommonTlsContext{
+			ValidationContextType: &tlsv3.CommonTlsContext_ValidationContext{
+				ValidationContext: &tlsv3.CertificateValidationContext{
+					CaCertificateProviderInstance: makeCertificateProviderInstance(&spec.CACertificate),
+					MatchSubjectAltNames:          sanMatchers,
+				},
+			},
+		},
+	}
 
+	if spec.Certificate != nil {
+		tlsContext.CommonTlsContext.TlsCertificateProviderInstance = makeCertificateProviderInstance(spec.Certificate)
+	}
+
+	return &core.TransportSocket{
+		Name: wellknown.TransportSocketTls,
+		ConfigType: &core.TransportSocket_TypedConfig{
+			TypedConfig: mustAny(&tlsContext),
+		},
+	}, nil
+}
+
+func makeCertificateProviderInstance(spec *kxdsv1alpha1.CertificateProviderInstance) *tlsv3.CertificateProviderPluginInstance {
+	return &tlsv3.CertificateProviderPluginInstance{
+		InstanceName:    spec.InstanceName,
+		CertificateName: spec.CertificateName,
+	}
+}
+
+func makeStringMatcher(spec kxdsv1alpha1.StringMatcher) (*matcher.StringMatcher, error) {
+	stringMatcher := matcher.StringMatcher{
+		IgnoreCase: spec.IgnoreCase,
+	}
+
+	switch {
+	case spec.Exact != nil:
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Exact{
+			Exact: *spec.Exact,
+		}
+	case spec.Prefix != nil:
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Prefix{
+			Prefix: *spec.Prefix,
+		}
+	case spec.Suffix != nil:
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Suffix{
+			Suffix: *spec.Suffix,
+		}
+	case spec.Contains != nil:
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Contains{
+			Contains: *spec.Contains,
+		}
+	case spec.Regex != nil:
+		regexMatcher, err := makeRegexMatcher(spec.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		stringMatcher.MatchPattern = &matcher.StringMatcher_SafeRegex{
+			SafeRegex: regexMatcher,
+		}
+	default:
+		return nil, errors.New("invalid string matcher")
+	}
+
+	return &stringMatcher, nil
+}
+
+// makeLoadAssignment builds the endpoints of a cluster, along with warnings about the localities published without their endpoints.
+func makeLoadAssignment(clusterName, currentNamespace string, localities []kxdsv1alpha1.Locality, state K8sState) (*endpoint.ClusterLoadAssignment, []string, error) {
+	var (
+		xdsLocalities []*endpoint.LocalityLbEndpoints
+		warnings      []string
+	)
+
+	if err := checkLocalityPriorities(currentNamespace, localities); err != nil {
+		return nil, nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+	}
+
+	for i, locSpec := range localities {
+		if err := checkLocalitySource(locSpec); err != nil {
+			return nil, nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+		}
+
+		switch {
+		case locSpec.Service != nil:
+			var (
+				svcRef = makeServiceReference(currentNamespace, locSpec.Service)
+
+				slices []kdiscoveryv1.EndpointSlice
+				ok     bool
+			)
+
+			// Localities of unavailable remote clusters are published without endpoints, not to take down the other localities.
+			if _, available := state.RemoteEndpointSlices[svcRef.cluster]; svcRef.cluster != "" && !available {
+				warnings = append(warnings, fmt.Sprintf("cluster %q: remote cluster %q is not available", clusterName, svcRef.cluster))
+			} else if slices, ok = state.serviceEndpointSlices(svcRef); !ok {
+				return nil, nil, errors.New("no k8s endpoints found")
+			}
+
+			// Nodes and pods of remote clusters are not watched, their endpoints topology only comes from their slices.
+			nodes, weights := state.Nodes, state.endpointWeights
+			if svcRef.cluster != "" {
+				nodes, weights = nil, nil
+			}
+
+			k8sLocalities, err := makeK8sLocalities(locSpec, slices, nodes, weights)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+			}
+
+			xdsLocalities = append(xdsLocalities, k8sLocalities...)
+		case len(locSpec.Static) > 0:
+			staticLocality, err := makeStaticLocality(i, locSpec)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not build cluster %q: %w", clusterName, err)
+			}
+
+			xdsLocalities = append(xdsLocalities, staticLocality)
+		default:
+			// Unresolved hostnames are published without endpoints until they resolve, not to take down the other localities.
+			addrs, ok := state.DNSAddresses[locSpec.DNS.Hostname]
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("cluster %q: hostname %q has not been resolved", clusterName, locSpec.DNS.Hostname))
+			}
+
+			xdsLocalities = append(xdsLocalities, makeDNSLocality(locSpec, addrs))
+		}
 	}
 
 	return &endpoint.ClusterLoadAssignment{
 		ClusterName: clusterName,
 		Endpoints:   xdsLocalities,
-	}, nil
+	}, warnings, nil
 }
 
-func makeK8sLocality(locSpec kxdsv1alpha1.Locality, k8sEndpoint kcorev1.Endpoints) (*endpoint.LocalityLbEndpoints, error) {
-	var xdsEndpoints []*endpoint.LbEndpoint
+// checkLocalitySource makes sure that a locality has exactly one source of endpoints.
+func checkLocalitySource(locSpec kxdsv1alpha1.Locality) error {
+	var sources int
 
-	for _, ep := range k8sEndpoint.Subsets {
-		port, ok := lookupK8sPort(locSpec.Service.Port, ep)
-		if !ok {
-			return nil, errors.New("no desired port found on the k8s endpoint")
+	if locSpec.Service != nil {
+		sources++
+	}
+
+	if len(locSpec.Static) > 0 {
+		sources++
+	}
+
+	if locSpec.DNS != nil {
+		sources++
+	}
+
+	if sources != 1 {
+		return errors.New("a locality must have exactly one of service, static or dns")
+	}
+
+	if locSpec.SplitByZone && locSpec.Service == nil {
+		return errors.New("only service localities can be split by zone")
+	}
+
+	return nil
+}
+
+// checkLocalityPriorities makes sure that a service or a hostname is referenced once per priority, and that priorities have no gaps.
+func checkLocalityPriorities(currentNamespace string, localities []kxdsv1alpha1.Locality) error {
+	type prioritizedService struct {
+		priority uint32
+		service  serviceReference
+	}
+
+	type prioritizedHostname struct {
+		priority uint32
+		hostname string
+	}
+
+	var (
+		maxPriority uint32
+		priorities  = make(map[uint32]struct{})
+		services    = make(map[prioritizedService]struct{})
+		hostnames   = make(map[prioritizedHostname]struct{})
+	)
+
+	for _, locSpec := range localities {
+		if locSpec.Service != nil {
+			key := prioritizedService{
+				priority: locSpec.Priority,
+				service:  makeServiceReference(currentNamespace, locSpec.Service),
+			}
+
+			if _, ok := services[key]; ok {
+				return fmt.Errorf("service %q is referenced twice with priority %d", key.service, key.priority)
+			}
+
+			services[key] = struct{}{}
 		}
 
-		xdsEndpoints = append(
-			xdsEndpoints,
-			makeEndpointsFromSubset(ep, port)...,
-		)
+		if locSpec.DNS != nil {
+			key := prioritizedHostname{priority: locSpec.Priority, hostname: locSpec.DNS.Hostname}
+
+			if _, ok := hostnames[key]; ok {
+				return fmt.Errorf("hostname %q is referenced twice with priority %d", key.hostname, key.priority)
+			}
+
+			hostnames[key] = struct{}{}
+		}
+
+		priorities[locSpec.Priority] = struct{}{}
+
+		if locSpec.Priority > maxPriority {
+			maxPriority = locSpec.Priority
+		}
+	}
+
+	for p := uint32(0); p < maxPriority; p++ {
+		if _, ok := priorities[p]; !ok {
+			return fmt.Errorf("no locality has priority %d", p)
+		}
+	}
+
+	return nil
+}
+
+// makeStaticLocality publishes the endpoints of a static locality, named after its index as it has no other identity.
+func makeStaticLocality(index int, locSpec kxdsv1alpha1.Locality) (*endpoint.LocalityLbEndpoints, error) {
+	lbEndpoints := make([]*endpoint.LbEndpoint, len(locSpec.Static))
+
+	for i, epSpec := range locSpec.Static {
+		addr, port, err := parseStaticAddress(epSpec.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static endpoint %q: %w", epSpec.Address, err)
+		}
+
+		weight := epSpec.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		lbEndpoints[i] = makeLbEndpoint(addr, port, core.HealthStatus_HEALTHY)
+		lbEndpoints[i].LoadBalancingWeight = wrapperspb.UInt32(weight)
 	}
 
 	return &endpoint.LocalityLbEndpoints{
-		Locality:            &core.Locality{SubZone: locSpec.Service.Name},
+		Locality: &core.Locality{
+			SubZone: "static-" + strconv.Itoa(index),
+		},
 		LoadBalancingWeight: wrapperspb.UInt32(locSpec.Weight),
 		Priority:            locSpec.Priority,
-		LbEndpoints:         xdsEndpoints,
+		LbEndpoints:         lbEndpoints,
 	}, nil
+}
+
+// parseStaticAddress parses an ip:port address, gRPC clients only connect to IP addresses.
+func parseStaticAddress(address string) (string, uint32, error) {
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if net.ParseIP(host) == nil {
+		return "", 0, errors.New("address must be an IP")
+	}
 
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, fmt.Errorf("invalid port %q", rawPort)
+	}
+
+	return host, uint32(port), nil
 }
 
-func makeEndpointsFromSubset(ep kcorev1.EndpointSubset, port uint32) []*endpoint.LbEndpoint {
-	eps := make([]*endpoint.LbEndpoint, len(ep.Addresses))
+// makeDNSLocality publishes the addresses resolved for the hostname of a DNS locality.
+// A locality is published even without any address, to keep the priorities gapless.
+func makeDNSLocality(locSpec kxdsv1alpha1.Locality, addrs []string) *endpoint.LocalityLbEndpoints {
+	lbEndpoints := make([]*endpoint.LbEndpoint, len(addrs))
 
-	for i, ep := range ep.Addresses {
-		eps[i] = &endpoint.LbEndpoint{
-			HostIdentifier: &endpoint.LbEndpoint_Endpoint{
-				Endpoint: &endpoint.Endpoint{
-					Address: &core.Address{
-						Address: &core.Address_SocketAddress{
-							SocketAddress: &core.SocketAddress{
-								Protocol: core.SocketAddress_TCP,
-								Address:  ep.IP,
-								PortSpecifier: &core.SocketAddress_PortValue{
-									PortValue: port,
-								},
-							},
-						},
-					},
-				},
-			},
+	for i, addr := range addrs {
+		lbEndpoints[i] = makeLbEndpoint(addr, locSpec.DNS.Port, core.HealthStatus_HEALTHY)
+	}
+
+	return &endpoint.LocalityLbEndpoints{
+		Locality: &core.Locality{
+			SubZone: locSpec.DNS.Hostname,
+		},
+		LoadBalancingWeight: wrapperspb.UInt32(locSpec.Weight),
+		Priority:            locSpec.Priority,
+		LbEndpoints:         lbEndpoints,
+	}
+}
+
+// EndpointWeightAnnotation sets the load balancing weight of the endpoint of a pod in its locality.
+// Pods without it, or with an invalid weight, get the default weight of one.
+const EndpointWeightAnnotation = "kxds.dev/weight"
+
+// makeEndpointWeights reads the weights of the annotated pods.
+func makeEndpointWeights(pods []kcorev1.Pod) map[ktypes.NamespacedName]uint32 {
+	weights := make(map[ktypes.NamespacedName]uint32)
+
+	for _, pod := range pods {
+		rawWeight, ok := pod.Annotations[EndpointWeightAnnotation]
+		if !ok {
+			continue
+		}
+
+		weight, err := strconv.ParseUint(rawWeight, 10, 32)
+		if err != nil || weight == 0 {
+			continue
 		}
 
+		weights[ktypes.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = uint32(weight)
 	}
 
-	return eps
+	return weights
 }
 
-func lookupK8sPort(k8sSvc kxdsv1alpha1.K8sPort, eps kcorev1.EndpointSubset) (uint32, bool) {
-	if k8sSvc.Name != "" {
-		for _, p := range eps.Ports {
-			if p.Name == k8sSvc.Name {
-				return uint32(p.Port), true
+// lookupEndpointPod returns the pod an endpoint of a slice of the given namespace targets, if any.
+func lookupEndpointPod(namespace string, ep kdiscoveryv1.Endpoint) (ktypes.NamespacedName, bool) {
+	if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+		return ktypes.NamespacedName{}, false
+	}
+
+	pod := ktypes.NamespacedName{Namespace: ep.TargetRef.Namespace, Name: ep.TargetRef.Name}
+	if pod.Namespace == "" {
+		pod.Namespace = namespace
+	}
+
+	return pod, true
+}
+
+// endpointTopology is the zone and region an endpoint runs in.
+type endpointTopology struct {
+	region string
+	zone   string
+}
+
+func makeK8sLocalities(locSpec kxdsv1alpha1.Locality, slices []kdiscoveryv1.EndpointSlice, nodes map[string]kcorev1.Node, weights map[ktypes.NamespacedName]uint32) ([]*endpoint.LocalityLbEndpoints, error) {
+	var (
+		xdsEndpoints = make(map[endpointTopology][]*endpoint.LbEndpoint)
+
+		// An endpoint can transiently belong to multiple slices.
+		seen = make(map[string]struct{})
+	)
+
+	for _, slice := range slices {
+		// gRPC clients only connect to IP addresses.
+		if slice.AddressType == kdiscoveryv1.AddressTypeFQDN || len(slice.Endpoints) == 0 {
+			continue
+		}
+
+		port, ok := lookupK8sPort(locSpec.Service.Port, slice.Ports)
+		if !ok {
+			return nil, errors.New("no desired port found on the k8s endpoint")
+		}
+
+		for _, ep := range slice.Endpoints {
+			if len(ep.Addresses) == 0 {
+				continue
 			}
 
+			// Addresses are fungible, only use the first one.
+			addr := ep.Addresses[0]
+
+			key := net.JoinHostPort(addr, strconv.FormatUint(uint64(port), 10))
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+
+			var topology endpointTopology
+			if locSpec.SplitByZone {
+				topology = lookupEndpointTopology(ep, nodes)
+			}
+
+			lbEndpoint := makeLbEndpoint(addr, port, makeHealthStatus(ep.Conditions))
+			if pod, ok := lookupEndpointPod(slice.Namespace, ep); ok && weights[pod] > 0 {
+				lbEndpoint.LoadBalancingWeight = wrapperspb.UInt32(weights[pod])
+			}
+
+			xdsEndpoints[topology] = append(xdsEndpoints[topology], lbEndpoint)
+		}
+	}
+
+	// Always publish a locality, even empty, to keep the priorities gapless.
+	if len(xdsEndpoints) == 0 {
+		xdsEndpoints[endpointTopology{}] = nil
+	}
+
+	topologies := make([]endpointTopology, 0, len(xdsEndpoints))
+	for topology := range xdsEndpoints {
+		topologies = append(topologies, topology)
+	}
+
+	sort.Slice(topologies, func(i, j int) bool {
+		if topologies[i].region != topologies[j].region {
+			return topologies[i].region < topologies[j].region
+		}
+
+		return topologies[i].zone < topologies[j].zone
+	})
+
+	// Localities of remote services are named apart from the local ones, as clients reject duplicate localities within a priority.
+	subZone := locSpec.Service.Name
+	if locSpec.Service.Cluster != "" {
+		subZone = locSpec.Service.Cluster + "/" + subZone
+	}
+
+	var (
+		xdsLocalities = make([]*endpoint.LocalityLbEndpoints, len(topologies))
+		total         = len(seen)
+	)
+
+	for i, topology := range topologies {
+		sortLbEndpoints(xdsEndpoints[topology])
+
+		xdsLocalities[i] = &endpoint.LocalityLbEndpoints{
+			Locality: &core.Locality{
+				Region:  topology.region,
+				Zone:    topology.zone,
+				SubZone: subZone,
+			},
+			LoadBalancingWeight: wrapperspb.UInt32(splitLocalityWeight(locSpec.Weight, len(xdsEndpoints[topology]), total)),
+			Priority:            locSpec.Priority,
+			LbEndpoints:         xdsEndpoints[topology],
+		}
+	}
+
+	return xdsLocalities, nil
+}
+
+// splitLocalityWeight returns the share of the weight of a locality going to a zone, in proportion to its endpoints.
+// Shares are rounded down, and zones with endpoints always keep a weight of at least one.
+func splitLocalityWeight(weight uint32, endpoints, total int) uint32 {
+	if total == 0 {
+		return weight
+	}
+
+	share := uint64(weight) * uint64(endpoints) / uint64(total)
+	if share == 0 {
+		return 1
+	}
+
+	return uint32(share)
+}
+
+// sortLbEndpoints sorts endpoints by address and port, as slices list them in no particular order.
+func sortLbEndpoints(lbEndpoints []*endpoint.LbEndpoint) {
+	sort.Slice(lbEndpoints, func(i, j int) bool {
+		a := lbEndpoints[i].GetEndpoint().GetAddress().GetSocketAddress()
+		b := lbEndpoints[j].GetEndpoint().GetAddress().GetSocketAddress()
+
+		if a.GetAddress() != b.GetAddress() {
+			return a.GetAddress() < b.GetAddress()
 		}
 
-		return 0, false
+		return a.GetPortValue() < b.GetPortValue()
+	})
+}
+
+// lookupEndpointTopology reads the zone of an endpoint from its slice, and falls back on the topology labels of its node.
+func lookupEndpointTopology(ep kdiscoveryv1.Endpoint, nodes map[string]kcorev1.Node) endpointTopology {
+	var (
+		topology endpointTopology
+		node     kcorev1.Node
+	)
+
+	if ep.NodeName != nil {
+		node = nodes[*ep.NodeName]
 	}
 
-	for _, p := range eps.Ports {
-		if p.Port == k8sSvc.Number {
-			return uint32(p.Port), true
+	topology.region = node.Labels[kcorev1.LabelTopologyRegion]
+	topology.zone = node.Labels[kcorev1.LabelTopologyZone]
+
+	if ep.Zone != nil && *ep.Zone != "" {
+		topology.zone = *ep.Zone
+	}
+
+	return topology
+}
+
+// makeHealthStatus maps the conditions of a k8s endpoint to an xDS health status.
+// Terminating endpoints still serving are drained, unknown conditions must be interpreted as ready or serving.
+func makeHealthStatus(conditions kdiscoveryv1.EndpointConditions) core.HealthStatus {
+	var (
+		ready       = conditions.Ready == nil || *conditions.Ready
+		serving     = conditions.Serving == nil || *conditions.Serving
+		terminating = conditions.Terminating != nil && *conditions.Terminating
+	)
+
+	switch {
+	case terminating && serving:
+		return core.HealthStatus_DRAINING
+	case terminating:
+		return core.HealthStatus_UNHEALTHY
+	case ready:
+		return core.HealthStatus_HEALTHY
+	default:
+		return core.HealthStatus_UNHEALTHY
+	}
+}
+
+func makeLbEndpoint(addr string, port uint32, healthStatus core.HealthStatus) *endpoint.LbEndpoint {
+	return &endpoint.LbEndpoint{
+		HealthStatus: healthStatus,
+		HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+			Endpoint: &endpoint.Endpoint{
+				Address: &core.Address{
+					Address: &core.Address_SocketAddress{
+						SocketAddress: &core.SocketAddress{
+							Protocol: core.SocketAddress_TCP,
+							Address:  addr,
+							PortSpecifier: &core.SocketAddress_PortValue{
+								PortValue: port,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func lookupK8sPort(k8sSvc kxdsv1alpha1.K8sPort, ports []kdiscoveryv1.EndpointPort) (uint32, bool) {
+	for _, p := range ports {
+		if p.Port == nil {
+			continue
+		}
+
+		if k8sSvc.Name != "" && p.Name != nil && *p.Name == k8sSvc.Name {
+			return uint32(*p.Port), true
+		}
+
+		if k8sSvc.Name == "" && *p.Port == k8sSvc.Number {
+			return uint32(*p.Port), true
 		}
 	}
 
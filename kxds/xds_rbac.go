@@ -0,0 +1,193 @@
+package kxds
+
+import (
+	"errors"
+	"fmt"
+
+	rbacconfig "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	rbacv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+func makeRBACFilter(spec *kxdsv1alpha1.RBACFilter) (*rbacv3.RBAC, error) {
+	rules, err := makeRBACRules(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rbacv3.RBAC{Rules: rules}, nil
+}
+
+func makeRBACPerRoute(spec *kxdsv1alpha1.RBACFilter) (*rbacv3.RBACPerRoute, error) {
+	rbac, err := makeRBACFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rbacv3.RBACPerRoute{Rbac: rbac}, nil
+}
+
+func makeRBACRules(spec *kxdsv1alpha1.RBACFilter) (*rbacconfig.RBAC, error) {
+	var rules rbacconfig.RBAC
+
+	switch spec.Action {
+	case "", "allow":
+		rules.Action = rbacconfig.RBAC_ALLOW
+	case "deny":
+		rules.Action = rbacconfig.RBAC_DENY
+	default:
+		return nil, fmt.Errorf("unsupported rbac action %q", spec.Action)
+	}
+
+	rules.Policies = make(map[string]*rbacconfig.Policy, len(spec.Policies))
+
+	for _, policySpec := range spec.Policies {
+		if _, ok := rules.Policies[policySpec.Name]; ok {
+			return nil, fmt.Errorf("duplicate rbac policy %q", policySpec.Name)
+		}
+
+		policy, err := makeRBACPolicy(policySpec)
+		if err != nil {
+			return nil, fmt.Errorf("could not build rbac policy %q: %w", policySpec.Name, err)
+		}
+
+		rules.Policies[policySpec.Name] = policy
+	}
+
+	return &rules, nil
+}
+
+func makeRBACPolicy(spec kxdsv1alpha1.RBACPolicy) (*rbacconfig.Policy, error) {
+	if len(spec.Permissions) == 0 || len(spec.Principals) == 0 {
+		return nil, errors.New("a policy requires at least one permission and one principal")
+	}
+
+	policy := rbacconfig.Policy{
+		Permissions: make([]*rbacconfig.Permission, len(spec.Permissions)),
+		Principals:  make([]*rbacconfig.Principal, len(spec.Principals)),
+	}
+
+	for i, permissionSpec := range spec.Permissions {
+		var err error
+
+		policy.Permissions[i], err = makeRBACPermission(permissionSpec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, principalSpec := range spec.Principals {
+		var err error
+
+		policy.Principals[i], err = makeRBACPrincipal(principalSpec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &policy, nil
+}
+
+func makeRBACPermission(spec kxdsv1alpha1.RBACPermission) (*rbacconfig.Permission, error) {
+	switch {
+	case spec.Any:
+		return &rbacconfig.Permission{
+			Rule: &rbacconfig.Permission_Any{Any: true},
+		}, nil
+	case spec.Path != nil:
+		pathMatcher, err := makePathMatcher(*spec.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rbacconfig.Permission{
+			Rule: &rbacconfig.Permission_UrlPath{UrlPath: pathMatcher},
+		}, nil
+	case spec.Header != nil:
+		headerMatcher, err := makeHeaderMatcher(*spec.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rbacconfig.Permission{
+			Rule: &rbacconfig.Permission_Header{Header: headerMatcher},
+		}, nil
+	default:
+		return nil, errors.New("malformed rbac permission")
+	}
+}
+
+func makeRBACPrincipal(spec kxdsv1alpha1.RBACPrincipal) (*rbacconfig.Principal, error) {
+	switch {
+	case spec.Any:
+		return &rbacconfig.Principal{
+			Identifier: &rbacconfig.Principal_Any{Any: true},
+		}, nil
+	case spec.Authenticated != nil:
+		stringMatcher, err := makeStringMatcher(*spec.Authenticated)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rbacconfig.Principal{
+			Identifier: &rbacconfig.Principal_Authenticated_{
+				Authenticated: &rbacconfig.Principal_Authenticated{
+					PrincipalName: stringMatcher,
+				},
+			},
+		}, nil
+	case spec.Header != nil:
+		headerMatcher, err := makeHeaderMatcher(*spec.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rbacconfig.Principal{
+			Identifier: &rbacconfig.Principal_Header{Header: headerMatcher},
+		}, nil
+	default:
+		return nil, errors.New("malformed rbac principal")
+	}
+}
+
+func makePathMatcher(spec kxdsv1alpha1.PathMatcher) (*matcher.PathMatcher, error) {
+	var stringMatcher matcher.StringMatcher
+
+	switch {
+	case spec.Regex != nil:
+		regexMatcher, err := makeRegexMatcher(spec.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		stringMatcher.MatchPattern = &matcher.StringMatcher_SafeRegex{
+			SafeRegex: regexMatcher,
+		}
+	case spec.Path != "":
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Exact{
+			Exact: spec.Path,
+		}
+	default:
+		stringMatcher.MatchPattern = &matcher.StringMatcher_Prefix{
+			Prefix: spec.Prefix,
+		}
+	}
+
+	return &matcher.PathMatcher{
+		Rule: &matcher.PathMatcher_Path{
+			Path: &stringMatcher,
+		},
+	}, nil
+}
+
+func hasRBACFilter(filters []kxdsv1alpha1.Filter) bool {
+	for _, f := range filters {
+		if f.RBAC != nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,253 @@
+package kxds
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
+)
+
+// serverListenerNamePrefix is the default value of the server_listener_resource_name_template of the gRPC bootstrap.
+const serverListenerNamePrefix = "grpc/server?xds.resource.listening_address="
+
+type xdsServer struct {
+	listeners []types.Resource
+}
+
+func makeXDSServer(srv kxdsv1alpha1.XDSServer, pods []kcorev1.Pod) (xdsServer, error) {
+	var (
+		xdsSrv xdsServer
+
+		resourcePrefix = "kxds.server" + "." + srv.Name + "." + srv.Namespace + "."
+	)
+
+	selector, err := kmetav1.LabelSelectorAsSelector(&srv.Spec.PodSelector)
+	if err != nil {
+		return xdsSrv, fmt.Errorf("invalid pod selector: %w", err)
+	}
+
+	filterChain, err := makeServerFilterChain(resourcePrefix, srv.Spec)
+	if err != nil {
+		return xdsSrv, err
+	}
+
+	for _, pod := range pods {
+		if !isServingPod(pod, srv.Namespace, selector) {
+			continue
+		}
+
+		port, ok := lookupContainerPort(srv.Spec.Port, pod)
+		if !ok {
+			return xdsSrv, fmt.Errorf("no desired port found on pod %q", pod.Name)
+		}
+
+		for _, podIP := range pod.Status.PodIPs {
+			xdsSrv.listeners = append(
+				xdsSrv.listeners,
+				makeServerListener(podIP.IP, port, filterChain),
+			)
+		}
+	}
+
+	return xdsSrv, nil
+}
+
+func isServingPod(pod kcorev1.Pod, namespace string, selector labels.Selector) bool {
+	return pod.Namespace == namespace &&
+		pod.DeletionTimestamp == nil &&
+		selector.Matches(labels.Set(pod.Labels))
+}
+
+// makeServerListener builds the listener of a server bound to the given address.
+// gRPC servers look their listener up by the exact address they bind, wildcard addresses can't be told apart between servers sharing a port.
+func makeServerListener(ip string, port uint32, filterChain *listener.FilterChain) *listener.Listener {
+	return &listener.Listener{
+		Name: serverListenerNamePrefix + net.JoinHostPort(ip, strconv.FormatUint(uint64(port), 10)),
+		Address: &core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					Protocol: core.SocketAddress_TCP,
+					Address:  ip,
+					PortSpecifier: &core.SocketAddress_PortValue{
+						PortValue: port,
+					},
+				},
+			},
+		},
+		FilterChains: []*listener.FilterChain{filterChain},
+	}
+}
+
+func makeServerFilterChain(resourcePrefix string, spec kxdsv1alpha1.XDSServerSpec) (*listener.FilterChain, error) {
+	filters, err := makeFilters(spec.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	routeConfig, err := makeServerRouteConfig(resourcePrefix, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	httpConnManager := &hcm.HttpConnectionManager{
+		CommonHttpProtocolOptions: &core.HttpProtocolOptions{
+			MaxStreamDuration: makeDuration(spec.MaxStreamDuration),
+		},
+		RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{
+			RouteConfig: routeConfig,
+		},
+		HttpFilters: filters,
+	}
+
+	filterChain := listener.FilterChain{
+		Name: resourcePrefix + "filterchain",
+		Filters: []*listener.Filter{
+			{
+				Name: wellknown.HTTPConnectionManager,
+				ConfigType: &listener.Filter_TypedConfig{
+					TypedConfig: mustAny(httpConnManager),
+				},
+			},
+		},
+	}
+
+	if spec.TLS != nil {
+		filterChain.TransportSocket, err = makeDownstreamTransportSocket(spec.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &filterChain, nil
+}
+
+func makeServerRouteConfig(resourcePrefix string, spec kxdsv1alpha1.XDSServerSpec) (*route.RouteConfiguration, error) {
+	var (
+		routeSpecs = spec.Routes
+		hasRBAC    = hasRBACFilter(spec.Filters)
+	)
+
+	// Accept all calls if no routes are specified.
+	if len(routeSpecs) == 0 {
+		routeSpecs = []kxdsv1alpha1.ServerRoute{
+			{
+				Path: kxdsv1alpha1.PathMatcher{
+					Prefix: "/",
+				},
+				CaseSensitive: true,
+			},
+		}
+	}
+
+	routes := make([]*route.Route, len(routeSpecs))
+
+	for i, routeSpec := range routeSpecs {
+		match, err := makeRouteMatch(
+			kxdsv1alpha1.Route{
+				Path:          routeSpec.Path,
+				Headers:       routeSpec.Headers,
+				CaseSensitive: routeSpec.CaseSensitive,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		routes[i] = &route.Route{
+			Match: match,
+			// gRPC servers only support the non forwarding action.
+			Action: &route.Route_NonForwardingAction{
+				NonForwardingAction: &route.NonForwardingAction{},
+			},
+		}
+
+		if routeSpec.RBAC != nil {
+			if !hasRBAC {
+				return nil, errors.New("overriding the rbac filter on a route requires an rbac filter on the server")
+			}
+
+			rbacPerRoute, err := makeRBACPerRoute(routeSpec.RBAC)
+			if err != nil {
+				return nil, err
+			}
+
+			routes[i].TypedPerFilterConfig = map[string]*anypb.Any{
+				wellknown.HTTPRoleBasedAccessControl: mustAny(rbacPerRoute),
+			}
+		}
+	}
+
+	return &route.RouteConfiguration{
+		Name: resourcePrefix + "routeconfig",
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    resourcePrefix + "vhost",
+				Domains: []string{"*"},
+				Routes:  routes,
+			},
+		},
+	}, nil
+}
+
+func makeDownstreamTransportSocket(spec *kxdsv1alpha1.ServerTLS) (*core.TransportSocket, error) {
+	if spec.Certificate.InstanceName == "" {
+		return nil, errors.New("tls requires a certificate provider instance")
+	}
+
+	if spec.RequireClientCertificate && spec.CACertificate == nil {
+		return nil, errors.New("requiring a client certificate requires a CA certificate provider instance")
+	}
+
+	tlsContext := tlsv3.DownstreamTlsContext{
+		CommonTlsContext: &tlsv3.CommonTlsContext{
+			TlsCertificateProviderInstance: makeCertificateProviderInstance(&spec.Certificate),
+		},
+		RequireClientCertificate: wrapperspb.Bool(spec.RequireClientCertificate),
+	}
+
+	if spec.CACertificate != nil {
+		tlsContext.CommonTlsContext.ValidationContextType = &tlsv3.CommonTlsContext_ValidationContext{
+			ValidationContext: &tlsv3.CertificateValidationContext{
+				CaCertificateProviderInstance: makeCertificateProviderInstance(spec.CACertificate),
+			},
+		}
+	}
+
+	return &core.TransportSocket{
+		Name: wellknown.TransportSocketTls,
+		ConfigType: &core.TransportSocket_TypedConfig{
+			TypedConfig: mustAny(&tlsContext),
+		},
+	}, nil
+}
+
+func lookupContainerPort(portSpec kxdsv1alpha1.K8sPort, pod kcorev1.Pod) (uint32, bool) {
+	if portSpec.Name == "" {
+		return uint32(portSpec.Number), portSpec.Number != 0
+	}
+
+	for _, container := range pod.Spec.Containers {
+		for _, p := range container.Ports {
+			if p.Name == portSpec.Name {
+				return uint32(p.ContainerPort), true
+			}
+		}
+	}
+
+	return 0, false
+}
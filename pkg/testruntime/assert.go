@@ -9,8 +9,12 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	echo "github.com/jlevesy/kxds/pkg/echoserver/proto"
 )
@@ -47,13 +51,31 @@ func WithinDelay(d time.Duration, assert func(t *testing.T)) func(t *testing.T)
 }
 
 type Caller struct {
-	m   Method
-	req *echo.EchoRequest
-	ctx context.Context
+	m        Method
+	req      *echo.EchoRequest
+	ctx      context.Context
+	creds    credentials.TransportCredentials
+	callOpts []grpc.CallOption
+	timeout  time.Duration
+	warmUp   time.Duration
 }
 
 func (c *Caller) Do(cl echo.EchoClient) (*echo.EchoReply, error) {
-	return c.m(c.ctx, cl, c.req)
+	if c.timeout == 0 {
+		return c.m(c.ctx, cl, c.req, c.callOpts...)
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+
+	return c.m(ctx, cl, c.req, c.callOpts...)
+}
+
+// warmUpOn keeps calling during the warm up duration, discarding the results.
+func (c *Caller) warmUpOn(cl echo.EchoClient) {
+	for deadline := time.Now().Add(c.warmUp); time.Now().Before(deadline); {
+		_, _ = c.Do(cl)
+	}
 }
 
 type CallerOpt func(c *Caller)
@@ -73,6 +95,28 @@ func WithContext(ctx context.Context) CallerOpt {
 	}
 }
 
+// WithTransportCredentials makes the caller dial using the given credentials instead of the xDS ones.
+func WithTransportCredentials(creds credentials.TransportCredentials) CallerOpt {
+	return func(c *Caller) {
+		c.creds = creds
+	}
+}
+
+// WithWaitForReady makes the calls wait for the connection to be ready, up to the given timeout.
+func WithWaitForReady(timeout time.Duration) CallerOpt {
+	return func(c *Caller) {
+		c.timeout = timeout
+		c.callOpts = append(c.callOpts, grpc.WaitForReady(true))
+	}
+}
+
+// WithWarmUp makes the caller keep calling for the given duration before the calls are counted, for the clients to learn the load of the backends.
+func WithWarmUp(d time.Duration) CallerOpt {
+	return func(c *Caller) {
+		c.warmUp = d
+	}
+}
+
 func BuildCaller(method Method, opts ...CallerOpt) Caller {
 	caller := Caller{
 		m: method,
@@ -89,14 +133,14 @@ func BuildCaller(method Method, opts ...CallerOpt) Caller {
 	return caller
 }
 
-type Method func(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest) (*echo.EchoReply, error)
+type Method func(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest, opts ...grpc.CallOption) (*echo.EchoReply, error)
 
-func MethodEcho(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest) (*echo.EchoReply, error) {
-	return cl.Echo(ctx, req)
+func MethodEcho(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest, opts ...grpc.CallOption) (*echo.EchoReply, error) {
+	return cl.Echo(ctx, req, opts...)
 }
 
-func MethodEchoPremium(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest) (*echo.EchoReply, error) {
-	return cl.EchoPremium(ctx, req)
+func MethodEchoPremium(ctx context.Context, cl echo.EchoClient, req *echo.EchoRequest, opts ...grpc.CallOption) (*echo.EchoReply, error) {
+	return cl.EchoPremium(ctx, req, opts...)
 }
 
 type call struct {
@@ -107,17 +151,30 @@ type call struct {
 
 type CallsAssertion func(t *testing.T, calls []call)
 
+// dial uses the caller credentials if any, otherwise the xDS credentials, falling back to plaintext if the cluster does not configure TLS.
+func dial(addr string, caller Caller) (*grpc.ClientConn, error) {
+	if caller.creds != nil {
+		return grpc.Dial(addr, grpc.WithTransportCredentials(caller.creds))
+	}
+
+	creds, err := xdscreds.NewClientCredentials(
+		xdscreds.ClientOptions{
+			FallbackCreds: insecure.NewCredentials(),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+}
+
 func CallOnce(addr string, caller Caller, assertions ...CallsAssertion) func(t *testing.T) {
 	return CallN(addr, caller, 1, assertions...)
 }
 func CallN(addr string, caller Caller, count int, assertions ...CallsAssertion) func(t *testing.T) {
 	return func(t *testing.T) {
-		conn, err := grpc.Dial(
-			addr,
-			grpc.WithTransportCredentials(
-				insecure.NewCredentials(),
-			),
-		)
+		conn, err := dial(addr, caller)
 		require.NoError(t, err)
 
 		defer conn.Close()
@@ -127,6 +184,8 @@ func CallN(addr string, caller Caller, count int, assertions ...CallsAssertion)
 			calls  = make([]call, count)
 		)
 
+		caller.warmUpOn(client)
+
 		for i := 0; i < count; i++ {
 			var c call
 
@@ -149,12 +208,7 @@ func CallN(addr string, caller Caller, count int, assertions ...CallsAssertion)
 
 func CallNParallel(addr string, caller Caller, count int, assertions ...CallsAssertion) func(t *testing.T) {
 	return func(t *testing.T) {
-		conn, err := grpc.Dial(
-			addr,
-			grpc.WithTransportCredentials(
-				insecure.NewCredentials(),
-			),
-		)
+		conn, err := dial(addr, caller)
 		require.NoError(t, err)
 
 		defer conn.Close()
@@ -166,6 +220,8 @@ func CallNParallel(addr string, caller Caller, count int, assertions ...CallsAss
 			group errgroup.Group
 		)
 
+		caller.warmUpOn(client)
+
 		for i := 0; i < count; i++ {
 			i := i
 			group.Go(func() error {
@@ -196,6 +252,53 @@ func CallNParallel(addr string, caller Caller, count int, assertions ...CallsAss
 	}
 }
 
+// CallNConcurrently spreads the calls between the given number of workers, each one waiting for its call to end before issuing the next one.
+func CallNConcurrently(addr string, caller Caller, count, workers int, assertions ...CallsAssertion) func(t *testing.T) {
+	return func(t *testing.T) {
+		conn, err := dial(addr, caller)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		var (
+			client = echo.NewEchoClient(conn)
+			calls  = make([]call, count)
+
+			group errgroup.Group
+		)
+
+		caller.warmUpOn(client)
+
+		for w := 0; w < workers; w++ {
+			w := w
+			group.Go(func() error {
+				for i := w; i < count; i += workers {
+					var c call
+
+					resp, err := caller.Do(client)
+
+					c.addr = addr
+					c.err = err
+
+					if err == nil {
+						c.backendID = resp.ServerId
+					}
+
+					calls[i] = c
+				}
+
+				return nil
+			})
+		}
+
+		require.NoError(t, group.Wait())
+
+		for _, assert := range assertions {
+			assert(t, calls)
+		}
+	}
+}
+
 func NoCallErrors(t *testing.T, calls []call) {
 	for _, c := range calls {
 		require.NoError(t, c.err)
@@ -208,6 +311,15 @@ func MustFail(t *testing.T, calls []call) {
 	}
 }
 
+func MustFailWithCode(code codes.Code) CallsAssertion {
+	return func(t *testing.T, calls []call) {
+		for _, c := range calls {
+			require.Error(t, c.err)
+			assert.Equal(t, code, status.Code(c.err), c.err.Error())
+		}
+	}
+}
+
 type AggregatedCallAssertion func(t *testing.T, counts map[string]int)
 
 func AggregateByError(asserts ...AggregatedCallAssertion) CallsAssertion {
@@ -265,3 +377,9 @@ func AssertAggregatedValueWithinDelta(backendID string, wantCount int, delta flo
 		assert.InDelta(t, wantCount, aggs[backendID], delta, backendID)
 	}
 }
+
+func AssertAggregatedKeyCount(wantCount int) AggregatedCallAssertion {
+	return func(t *testing.T, aggs map[string]int) {
+		assert.Len(t, aggs, wantCount)
+	}
+}
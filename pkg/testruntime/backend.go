@@ -1,15 +1,23 @@
 package testruntime
 
 import (
+	"context"
 	"net"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
 	"github.com/jlevesy/kxds/pkg/echoserver"
 	echo "github.com/jlevesy/kxds/pkg/echoserver/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+	"google.golang.org/grpc/orca"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/xds"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -18,14 +26,42 @@ type Backends []Backend
 
 type Config struct {
 	BackendCount int
+	// TLS makes the backends serve mTLS using the given certificates.
+	TLS *Certificates
+	// XDS makes the backends xDS enabled gRPC servers, configured by the XDSServer resources.
+	XDS bool
+	// ORCA allows the backends to report their load to the clients in the trailers of their answers, see ORCABehavior.
+	ORCA bool
 }
 
 func StartBackends(cfg Config) (Backends, error) {
 	var (
 		err      error
 		backends = make([]Backend, cfg.BackendCount)
+
+		idPrefix   = "backend-"
+		serverOpts []grpc.ServerOption
 	)
 
+	if cfg.ORCA {
+		serverOpts = append(serverOpts, orca.CallMetricsServerOption(nil))
+	}
+
+	newServer := newGRPCServer(insecure.NewCredentials(), serverOpts...)
+
+	if cfg.TLS != nil {
+		idPrefix = "tls-backend-"
+		newServer = newGRPCServer(credentials.NewTLS(cfg.TLS.ServerTLSConfig()), serverOpts...)
+	}
+
+	if cfg.XDS {
+		idPrefix = "xds-backend-"
+		newServer, err = newXDSServer(serverOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err = corev1.AddToScheme(scheme.Scheme); err != nil {
 		return nil, err
 	}
@@ -35,7 +71,7 @@ func StartBackends(cfg Config) (Backends, error) {
 	}
 
 	for id := 0; id < cfg.BackendCount; id++ {
-		backends[id], err = newBackend("backend-" + strconv.Itoa(id))
+		backends[id], err = newBackend(idPrefix+strconv.Itoa(id), newServer)
 		if err != nil {
 			return nil, err
 		}
@@ -88,17 +124,120 @@ func HangBehavior(d time.Duration) Behavior {
 	}
 }
 
+// FailingBehavior fails the first calls received by each backend with the given status code.
+func FailingBehavior(failures int32, code codes.Code) Behavior {
+	return func(id string) echo.EchoServer {
+		var calls int32
+
+		reply := func(req *echo.EchoRequest, variant string) (*echo.EchoReply, error) {
+			if atomic.AddInt32(&calls, 1) <= failures {
+				return nil, status.Error(code, "injected failure")
+			}
+
+			return &echo.EchoReply{ServerId: id, Payload: req.Payload, Variant: variant}, nil
+		}
+
+		return &echoserver.Server{
+			EchoFunc: func(req *echo.EchoRequest) (*echo.EchoReply, error) {
+				return reply(req, "standard")
+			},
+			EchoPremiumFunc: func(req *echo.EchoRequest) (*echo.EchoReply, error) {
+				return reply(req, "premium")
+			},
+		}
+	}
+}
+
+// ORCABehavior answers like the default behavior, and reports the given CPU utilization of each backend to the clients through ORCA.
+// Backends missing from the map report no load. The backends must be started with ORCA enabled.
+func ORCABehavior(cpuUtilization map[string]float64) Behavior {
+	return func(id string) echo.EchoServer {
+		return &loadReportingServer{
+			EchoServer:     DefaultBehavior()(id),
+			cpuUtilization: cpuUtilization[id],
+		}
+	}
+}
+
+type loadReportingServer struct {
+	echo.EchoServer
+
+	cpuUtilization float64
+}
+
+func (s *loadReportingServer) Echo(ctx context.Context, req *echo.EchoRequest) (*echo.EchoReply, error) {
+	s.reportLoad(ctx)
+
+	return s.EchoServer.Echo(ctx, req)
+}
+
+func (s *loadReportingServer) EchoPremium(ctx context.Context, req *echo.EchoRequest) (*echo.EchoReply, error) {
+	s.reportLoad(ctx)
+
+	return s.EchoServer.EchoPremium(ctx, req)
+}
+
+func (s *loadReportingServer) reportLoad(ctx context.Context) {
+	recorder := orca.CallMetricsRecorderFromContext(ctx)
+	if recorder == nil || s.cpuUtilization == 0 {
+		return
+	}
+
+	// Clients weight the backends by their QPS over their utilization, an identical QPS makes the weights follow the utilization.
+	recorder.SetQPS(1)
+	recorder.SetCPUUtilization(s.cpuUtilization)
+}
+
+// GRPCServer is implemented by both the regular and the xDS enabled gRPC servers.
+type GRPCServer interface {
+	grpc.ServiceRegistrar
+
+	Serve(lis net.Listener) error
+	Stop()
+}
+
+type serverFactory func() (GRPCServer, string, error)
+
+func newGRPCServer(creds credentials.TransportCredentials, opts ...grpc.ServerOption) serverFactory {
+	return func() (GRPCServer, string, error) {
+		return grpc.NewServer(append([]grpc.ServerOption{grpc.Creds(creds)}, opts...)...), ":0", nil
+	}
+}
+
+// newXDSServer builds xDS enabled servers. They use the credentials provided by the listener
+// and fall back to plaintext otherwise.
+// Their listen address must be an IP, as it is used to build the listener resource name.
+func newXDSServer(opts ...grpc.ServerOption) (serverFactory, error) {
+	creds, err := xdscreds.NewServerCredentials(
+		xdscreds.ServerOptions{
+			FallbackCreds: insecure.NewCredentials(),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (GRPCServer, string, error) {
+		srv, err := xds.NewGRPCServer(append([]grpc.ServerOption{grpc.Creds(creds)}, opts...)...)
+
+		return srv, "127.0.0.1:0", err
+	}, nil
+}
+
 type Backend struct {
 	ID       string
 	Listener net.Listener
-	Server   *grpc.Server
+	Server   GRPCServer
 	Impl     *echoserver.SwapableServer
 }
 
-func newBackend(id string) (Backend, error) {
-	srv := grpc.NewServer(grpc.Creds(insecure.NewCredentials()))
+func newBackend(id string, newServer serverFactory) (Backend, error) {
+	srv, addr, err := newServer()
+	if err != nil {
+		return Backend{}, err
+	}
 
-	listener, err := net.Listen("tcp", ":0")
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return Backend{}, err
 	}
@@ -123,6 +262,8 @@ func newBackend(id string) (Backend, error) {
 
 func (b *Backend) SetBehavior(bh Behavior) { b.Impl.Swap(bh(b.ID)) }
 
+func (b *Backend) Addr() string { return b.Listener.Addr().String() }
+
 func (b *Backend) PortNumber() int32 {
 	_, p, err := net.SplitHostPort(b.Listener.Addr().String())
 	if err != nil {
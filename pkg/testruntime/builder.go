@@ -1,12 +1,11 @@
 package testruntime
 
 import (
-	"net"
-	"strconv"
 	"time"
 
 	kxdsv1alpha1 "github.com/jlevesy/kxds/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -34,12 +33,30 @@ func WithLocalityPriority(priority uint32) LocalityOption {
 	}
 }
 
+func WithLocalitySplitByZone() LocalityOption {
+	return func(l *kxdsv1alpha1.Locality) {
+		l.SplitByZone = true
+	}
+}
+
 func WithK8sService(s kxdsv1alpha1.K8sService) LocalityOption {
 	return func(l *kxdsv1alpha1.Locality) {
 		l.Service = &s
 	}
 }
 
+func WithStaticEndpoints(eps ...kxdsv1alpha1.StaticEndpoint) LocalityOption {
+	return func(l *kxdsv1alpha1.Locality) {
+		l.Static = eps
+	}
+}
+
+func WithDNSEndpoints(hostname string, port uint32) LocalityOption {
+	return func(l *kxdsv1alpha1.Locality) {
+		l.DNS = &kxdsv1alpha1.DNSEndpoints{Hostname: hostname, Port: port}
+	}
+}
+
 func BuildLocality(opts ...LocalityOption) kxdsv1alpha1.Locality {
 	l := kxdsv1alpha1.Locality{
 		Weight: 1,
@@ -54,12 +71,30 @@ func BuildLocality(opts ...LocalityOption) kxdsv1alpha1.Locality {
 
 type ClusterOption func(c *kxdsv1alpha1.Cluster)
 
+func WithLoadReporting() ClusterOption {
+	return func(c *kxdsv1alpha1.Cluster) {
+		c.LoadReporting = true
+	}
+}
+
 func WithMaxRequests(req uint32) ClusterOption {
 	return func(c *kxdsv1alpha1.Cluster) {
 		c.MaxRequests = &req
 	}
 }
 
+func WithLBPolicy(p kxdsv1alpha1.LBPolicy) ClusterOption {
+	return func(c *kxdsv1alpha1.Cluster) {
+		c.LBPolicy = &p
+	}
+}
+
+func WithTLS(t kxdsv1alpha1.ClusterTLS) ClusterOption {
+	return func(c *kxdsv1alpha1.Cluster) {
+		c.TLS = &t
+	}
+}
+
 func WithLocalities(ls ...kxdsv1alpha1.Locality) ClusterOption {
 	return func(c *kxdsv1alpha1.Cluster) {
 		c.Localities = ls
@@ -137,6 +172,18 @@ func WithClusterRefs(refs ...kxdsv1alpha1.ClusterRef) RouteOption {
 	}
 }
 
+func WithHashPolicies(ps ...kxdsv1alpha1.HashPolicy) RouteOption {
+	return func(r *kxdsv1alpha1.Route) {
+		r.HashPolicy = ps
+	}
+}
+
+func WithRetryPolicy(p kxdsv1alpha1.RetryPolicy) RouteOption {
+	return func(r *kxdsv1alpha1.Route) {
+		r.RetryPolicy = &p
+	}
+}
+
 func WithPathMatcher(pm kxdsv1alpha1.PathMatcher) RouteOption {
 	return func(r *kxdsv1alpha1.Route) {
 		r.Path = pm
@@ -194,12 +241,24 @@ func WithClusters(cs ...kxdsv1alpha1.Cluster) XDSServiceOpt {
 	}
 }
 
+func WithDefaultRetryPolicy(p kxdsv1alpha1.RetryPolicy) XDSServiceOpt {
+	return func(s *kxdsv1alpha1.XDSService) {
+		s.Spec.RetryPolicy = &p
+	}
+}
+
 func WithMaxStreamDuration(d time.Duration) XDSServiceOpt {
 	return func(s *kxdsv1alpha1.XDSService) {
 		s.Spec.MaxStreamDuration = &metav1.Duration{Duration: d}
 	}
 }
 
+func WithScopes(scopes ...string) XDSServiceOpt {
+	return func(s *kxdsv1alpha1.XDSService) {
+		s.Spec.Scopes = scopes
+	}
+}
+
 func BuildXDSService(name, namespace string, opts ...XDSServiceOpt) kxdsv1alpha1.XDSService {
 	s := kxdsv1alpha1.XDSService{
 		ObjectMeta: metav1.ObjectMeta{
@@ -215,33 +274,199 @@ func BuildXDSService(name, namespace string, opts ...XDSServiceOpt) kxdsv1alpha1
 	return s
 }
 
-func BuildEndpoints(name, namespace string, backends []Backend) corev1.Endpoints {
-	subsets := make([]corev1.EndpointSubset, len(backends))
+// BuildEndpointSlices builds the endpoint slices of a service, one per backend as they all listen on a different port.
+func BuildEndpointSlices(name, namespace string, backends []Backend) []discoveryv1.EndpointSlice {
+	slices := make([]discoveryv1.EndpointSlice, len(backends))
 
 	for i, b := range backends {
-		_, p, _ := net.SplitHostPort(b.Listener.Addr().String())
-		pp, _ := strconv.Atoi(p)
-
-		subsets[i] = corev1.EndpointSubset{
-			Addresses: []corev1.EndpointAddress{
+		slices[i] = discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-" + b.ID,
+				Namespace: namespace,
+				Labels: map[string]string{
+					discoveryv1.LabelServiceName: name,
+				},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
 				{
-					IP: "127.0.0.1",
+					Addresses: []string{"127.0.0.1"},
+					Conditions: discoveryv1.EndpointConditions{
+						Ready: Ptr(true),
+					},
 				},
 			},
-			Ports: []corev1.EndpointPort{
+			Ports: []discoveryv1.EndpointPort{
 				{
-					Port: int32(pp),
-					Name: "grpc",
+					Name: Ptr("grpc"),
+					Port: Ptr(b.PortNumber()),
 				},
 			},
 		}
 	}
 
-	return corev1.Endpoints{
+	// Services without endpoints still have an empty slice.
+	if len(slices) == 0 {
+		slices = append(slices, discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-empty",
+				Namespace: namespace,
+				Labels: map[string]string{
+					discoveryv1.LabelServiceName: name,
+				},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+		})
+	}
+
+	return slices
+}
+
+// WithEndpointConditions sets the conditions of all the endpoints of the given slices.
+func WithEndpointConditions(conditions discoveryv1.EndpointConditions, slices []discoveryv1.EndpointSlice) []discoveryv1.EndpointSlice {
+	for i := range slices {
+		for j := range slices[i].Endpoints {
+			slices[i].Endpoints[j].Conditions = conditions
+		}
+	}
+
+	return slices
+}
+
+// WithEndpointZone sets the zone of all the endpoints of the given slices.
+func WithEndpointZone(zone string, slices []discoveryv1.EndpointSlice) []discoveryv1.EndpointSlice {
+	for i := range slices {
+		for j := range slices[i].Endpoints {
+			slices[i].Endpoints[j].Zone = Ptr(zone)
+		}
+	}
+
+	return slices
+}
+
+// WithEndpointNode sets the node of all the endpoints of the given slices.
+func WithEndpointNode(nodeName string, slices []discoveryv1.EndpointSlice) []discoveryv1.EndpointSlice {
+	for i := range slices {
+		for j := range slices[i].Endpoints {
+			slices[i].Endpoints[j].NodeName = Ptr(nodeName)
+		}
+	}
+
+	return slices
+}
+
+// WithEndpointPod makes the endpoints of the given slices target a pod of their namespace.
+func WithEndpointPod(podName string, slices []discoveryv1.EndpointSlice) []discoveryv1.EndpointSlice {
+	for i := range slices {
+		for j := range slices[i].Endpoints {
+			slices[i].Endpoints[j].TargetRef = &corev1.ObjectReference{
+				Kind:      "Pod",
+				Name:      podName,
+				Namespace: slices[i].Namespace,
+			}
+		}
+	}
+
+	return slices
+}
+
+// BuildNode builds a node running in the given region and zone.
+func BuildNode(name, region, zone string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				corev1.LabelTopologyRegion: region,
+				corev1.LabelTopologyZone:   zone,
+			},
+		},
+	}
+}
+
+// JoinEndpointSlices flattens the endpoint slices of multiple services.
+func JoinEndpointSlices(slices ...[]discoveryv1.EndpointSlice) []discoveryv1.EndpointSlice {
+	var result []discoveryv1.EndpointSlice
+
+	for _, s := range slices {
+		result = append(result, s...)
+	}
+
+	return result
+}
+
+type XDSServerOpt func(s *kxdsv1alpha1.XDSServer)
+
+func WithPodSelector(labels map[string]string) XDSServerOpt {
+	return func(s *kxdsv1alpha1.XDSServer) {
+		s.Spec.PodSelector = metav1.LabelSelector{MatchLabels: labels}
+	}
+}
+
+func WithServerPort(p kxdsv1alpha1.K8sPort) XDSServerOpt {
+	return func(s *kxdsv1alpha1.XDSServer) {
+		s.Spec.Port = p
+	}
+}
+
+func WithServerFilters(fs ...kxdsv1alpha1.Filter) XDSServerOpt {
+	return func(s *kxdsv1alpha1.XDSServer) {
+		s.Spec.Filters = fs
+	}
+}
+
+func WithServerRoutes(rs ...kxdsv1alpha1.ServerRoute) XDSServerOpt {
+	return func(s *kxdsv1alpha1.XDSServer) {
+		s.Spec.Routes = rs
+	}
+}
+
+func WithServerTLS(t kxdsv1alpha1.ServerTLS) XDSServerOpt {
+	return func(s *kxdsv1alpha1.XDSServer) {
+		s.Spec.TLS = &t
+	}
+}
+
+func BuildXDSServer(name, namespace string, opts ...XDSServerOpt) kxdsv1alpha1.XDSServer {
+	s := kxdsv1alpha1.XDSServer{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
 		},
-		Subsets: subsets,
+	}
+
+	for _, o := range opts {
+		o(&s)
+	}
+
+	return s
+}
+
+// BuildPod builds a pod running the given backend, exposing its port as "grpc".
+func BuildPod(name, namespace string, labels map[string]string, backend Backend) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "backend",
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "grpc",
+							ContainerPort: backend.PortNumber(),
+						},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			PodIP: "127.0.0.1",
+			PodIPs: []corev1.PodIP{
+				{IP: "127.0.0.1"},
+			},
+		},
 	}
 }
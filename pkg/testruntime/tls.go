@@ -0,0 +1,174 @@
+package testruntime
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CertificatesDir is where the test certificates are written.
+	// It must match the file_watcher certificate provider defined in the test xDS bootstrap.
+	CertificatesDir = "/tmp/kxds-testruntime/certs"
+
+	// CertificateProviderInstance is the name of the certificate provider instance defined in the test xDS bootstrap.
+	CertificateProviderInstance = "kxds-test"
+	// ServerCertificateProviderInstance is the name of the certificate provider instance serving the server certificate.
+	ServerCertificateProviderInstance = "kxds-test-server"
+
+	// ServerDNSName is the DNS SAN of the backends certificate.
+	ServerDNSName = "backend.kxds.test"
+	// ServerURI is the URI SAN of the backends certificate.
+	ServerURI = "spiffe://kxds.test/ns/default/sa/backend"
+	// ClientDNSName is the DNS SAN of the client certificate.
+	ClientDNSName = "client.kxds.test"
+	// ClientURI is the URI SAN of the client certificate.
+	ClientURI = "spiffe://kxds.test/ns/default/sa/client"
+)
+
+// Certificates holds a test PKI: a CA, a server certificate for the backends and a client certificate.
+type Certificates struct {
+	CAPool *x509.CertPool
+	Server tls.Certificate
+	Client tls.Certificate
+}
+
+// ServerTLSConfig returns a TLS configuration serving the server certificate and requiring a client certificate signed by the CA.
+func (c *Certificates) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.Server},
+		ClientCAs:    c.CAPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ClientTLSConfig returns a TLS configuration presenting the client certificate and verifying the server certificate.
+func (c *Certificates) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.Client},
+		RootCAs:      c.CAPool,
+		ServerName:   ServerDNSName,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// GenerateCertificates generates a new test PKI and writes the CA, the client and the server certificates in dir.
+func GenerateCertificates(dir string) (*Certificates, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kxds test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert, serverKey, err := issueCertificate(ca, caKey, 2, ServerDNSName, ServerURI, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, clientKey, err := issueCertificate(ca, caKey, 3, ClientDNSName, ClientURI, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	for name, content := range map[string][]byte{
+		"ca.pem":         pemEncode("CERTIFICATE", caDER),
+		"client.pem":     clientCert,
+		"client-key.pem": clientKey,
+		"server.pem":     serverCert,
+		"server-key.pem": serverKey,
+	} {
+		if err = os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	certs := Certificates{
+		CAPool: x509.NewCertPool(),
+	}
+
+	certs.CAPool.AddCert(ca)
+
+	certs.Server, err = tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certs.Client, err = tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certs, nil
+}
+
+func issueCertificate(ca *x509.Certificate, caKey *ecdsa.PrivateKey, serial int64, dnsName, uri string, usage x509.ExtKeyUsage) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{dnsName},
+		URIs:         []*url.URL{parsedURI},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER), nil
+}
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
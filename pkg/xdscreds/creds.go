@@ -0,0 +1,155 @@
+// Package xdscreds registers the kxds channel credentials of the gRPC xDS bootstrap.
+// They connect the xDS clients to a kxds server serving TLS, optionally presenting a client certificate and a kubernetes ServiceAccount token.
+//
+// Import it for its side effects, and reference it from the bootstrap:
+//
+//	"channel_creds": [
+//	  {
+//	    "type": "kxds",
+//	    "config": {
+//	      "ca_certificate_file": "/var/run/kxds/ca.crt",
+//	      "certificate_file": "/var/run/kxds/tls.crt",
+//	      "private_key_file": "/var/run/kxds/tls.key",
+//	      "token_file": "/var/run/secrets/tokens/kxds-token"
+//	    }
+//	  }
+//	]
+package xdscreds
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/xds/bootstrap"
+)
+
+// Name is the type of the credentials in the bootstrap.
+const Name = "kxds"
+
+func init() {
+	bootstrap.RegisterCredentials(builder{})
+}
+
+// Config is the config of the credentials in the bootstrap.
+type Config struct {
+	// CACertificateFile is the CA verifying the server certificate, the system roots are used if not set.
+	CACertificateFile string `json:"ca_certificate_file,omitempty"`
+	// CertificateFile and PrivateKeyFile are the client certificate presented to the server if set.
+	// They are read again on each handshake.
+	CertificateFile string `json:"certificate_file,omitempty"`
+	PrivateKeyFile  string `json:"private_key_file,omitempty"`
+	// ServerName overrides the name verified against the server certificate, the host of the server URI by default.
+	ServerName string `json:"server_name,omitempty"`
+	// TokenFile is a kubernetes ServiceAccount token sent as a bearer token if set.
+	// It is read again on each call, so projected tokens can be rotated.
+	TokenFile string `json:"token_file,omitempty"`
+}
+
+type builder struct{}
+
+func (builder) Name() string {
+	return Name
+}
+
+// Build returns the credentials described by the bootstrap, they hold no resources to release.
+func (builder) Build(rawConfig json.RawMessage) (credentials.Bundle, func(), error) {
+	var cfg Config
+
+	if len(rawConfig) > 0 {
+		if err := json.Unmarshal(rawConfig, &cfg); err != nil {
+			return nil, nil, fmt.Errorf("could not parse %s credentials config: %w", Name, err)
+		}
+	}
+
+	bundle, err := NewBundle(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bundle, func() {}, nil
+}
+
+// NewBundle returns the credentials described by the given config.
+func NewBundle(cfg Config) (credentials.Bundle, error) {
+	tlsConfig := &tls.Config{
+		ServerName: cfg.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CACertificateFile != "" {
+		content, err := os.ReadFile(cfg.CACertificateFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificate found in %q", cfg.CACertificateFile)
+		}
+	}
+
+	if (cfg.CertificateFile == "") != (cfg.PrivateKeyFile == "") {
+		return nil, errors.New("both a certificate and a key are required to present a client certificate")
+	}
+
+	if cfg.CertificateFile != "" {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			return &cert, nil
+		}
+	}
+
+	b := bundle{transport: credentials.NewTLS(tlsConfig)}
+
+	if cfg.TokenFile != "" {
+		b.perRPC = tokenCredentials{path: cfg.TokenFile}
+	}
+
+	return &b, nil
+}
+
+type bundle struct {
+	transport credentials.TransportCredentials
+	perRPC    credentials.PerRPCCredentials
+}
+
+func (b *bundle) TransportCredentials() credentials.TransportCredentials {
+	return b.transport
+}
+
+func (b *bundle) PerRPCCredentials() credentials.PerRPCCredentials {
+	return b.perRPC
+}
+
+func (b *bundle) NewWithMode(string) (credentials.Bundle, error) {
+	return nil, errors.New("kxds credentials do not support modes")
+}
+
+// tokenCredentials sends the content of a token file as a bearer token.
+type tokenCredentials struct {
+	path string
+}
+
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": "Bearer " + strings.TrimSpace(string(token))}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}